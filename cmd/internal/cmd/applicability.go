@@ -0,0 +1,351 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/goccy/go-yaml"
+	"github.com/spf13/cobra"
+)
+
+var policyApplicabilityCmd = &cobra.Command{
+	Use:   "applicability [policies...]",
+	Short: "Compute which policies and requirements apply to a resource",
+	Long: `Decide which policies, controls, and assessment requirements apply to one
+resource, so that evaluators know what to run against it.
+
+The resource file holds a #Resource and the attributes applicability is
+decided on:
+
+  resource:
+    id: payments-db
+    name: Payments Database
+    type: Software
+    environment: production
+  dimensions:            # as in a policy scope
+    technologies: [Database Systems]
+    geopolitical: [United States]
+    sensitivity: [Confidential]
+  applicability: [prod]  # applicability-groups the resource belongs to
+
+A log whose target is the resource may be given instead; dimensions and
+applicability can also be set with flags, which add to the file.
+
+A policy applies when, for every dimension its scope.in lists, the resource
+has one of the listed values, and no value of the resource is listed in
+scope.out. Dimensions the resource does not describe do not exclude it.
+Assessment requirements of an applicable policy (see policy compile) apply
+when one of their applicability groups is the resource's; a resource
+without applicability groups gets all of them. Requirements of controls
+that mitigate a threat of a risk the policy accepts for this resource are
+listed as excluded.`,
+	Args:          cobra.MinimumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE:          runPolicyApplicability,
+}
+
+var policyApplicabilityFlags struct {
+	resourcePath  string
+	applicability []string
+	format        string
+	outputPath    string
+	mirrorDir     string
+	cacheDir      string
+	fetch         bool
+}
+
+// scopeDimensions are the keys of #Dimensions, in declaration order.
+var scopeDimensions = []string{"technologies", "geopolitical", "sensitivity", "users", "groups"}
+
+func newPolicyApplicabilityCmd() *cobra.Command {
+	flags := policyApplicabilityCmd.Flags()
+	flags.StringVarP(&policyApplicabilityFlags.resourcePath, "resource", "r", "", "Resource description (YAML or JSON)")
+	for _, dim := range scopeDimensions {
+		flags.StringSlice(dim, nil, fmt.Sprintf("Add %s values to the resource", dim))
+	}
+	flags.StringSliceVar(&policyApplicabilityFlags.applicability, "applicability", nil, "Add applicability group ids to the resource")
+	flags.StringVarP(&policyApplicabilityFlags.format, "format", "f", "", "Output format: yaml or json (default: from the output extension, else yaml)")
+	flags.StringVarP(&policyApplicabilityFlags.outputPath, "output", "o", "", "Output path for the report (default: stdout)")
+	flags.StringVar(&policyApplicabilityFlags.mirrorDir, "mirror", "", "Read-only directory mirroring http(s) artifacts as host/path")
+	flags.StringVar(&policyApplicabilityFlags.cacheDir, "cache", "", "Directory where downloaded http(s) artifacts are cached")
+	flags.BoolVar(&policyApplicabilityFlags.fetch, "fetch", false, "Download http(s) artifacts missing from the mirror and cache")
+	return policyApplicabilityCmd
+}
+
+func runPolicyApplicability(cmd *cobra.Command, args []string) error {
+	res := &resourceProfile{Dimensions: make(map[string][]string)}
+	if path := policyApplicabilityFlags.resourcePath; path != "" {
+		var err error
+		if res, err = loadResourceProfile(path); err != nil {
+			return err
+		}
+	}
+	for _, dim := range scopeDimensions {
+		values, _ := cmd.Flags().GetStringSlice(dim)
+		res.Dimensions[dim] = append(res.Dimensions[dim], values...)
+	}
+	res.Applicability = append(res.Applicability, policyApplicabilityFlags.applicability...)
+
+	resolver := newArtifactResolver(policyApplicabilityFlags.mirrorDir, policyApplicabilityFlags.cacheDir, policyApplicabilityFlags.fetch)
+	report := &applicabilityReport{Resource: res.ID}
+	failed := 0
+	for _, file := range args {
+		doc, err := readDocument(file)
+		if err != nil {
+			return err
+		}
+		src, err := loadArtifactSource(cuecontext.New(), file)
+		if err != nil {
+			src = nil
+		}
+		pa, diags := policyApplicability(file, doc, src, res, resolver)
+		if len(diags) > 0 {
+			if err := writeTextDiagnostics(os.Stderr, []ValidationResult{{File: file, Diagnostics: diags}}); err != nil {
+				return err
+			}
+		}
+		if hasErrors(diags) {
+			failed++
+			continue
+		}
+		report.Policies = append(report.Policies, pa)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d policies do not apply cleanly", failed, len(args))
+	}
+
+	out := policyApplicabilityFlags.outputPath
+	format := policyApplicabilityFlags.format
+	if format == "" {
+		format = "yaml"
+		if out != "" && out != "-" {
+			format = documentFormat(out)
+		}
+	}
+	data, err := encodeDocument(report, format)
+	if err != nil {
+		return err
+	}
+	if out == "" || out == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(out, data, 0644); err != nil {
+		return fmt.Errorf("write %s: %w", out, err)
+	}
+	return nil
+}
+
+// resourceProfile is what applicability is decided against: a resource, the
+// scope dimension values that describe it, and the applicability groups it
+// belongs to.
+type resourceProfile struct {
+	ID            string
+	Dimensions    map[string][]string
+	Applicability []string
+}
+
+// loadResourceProfile reads a resource description, or the target of a log.
+func loadResourceProfile(path string) (*resourceProfile, error) {
+	doc, err := readDocument(path)
+	if err != nil {
+		return nil, err
+	}
+	resource := mapMap(doc, "resource")
+	if resource == nil {
+		resource = mapMap(doc, "target")
+	}
+	if resource == nil {
+		return nil, fmt.Errorf("%s: no resource or target", path)
+	}
+	res := &resourceProfile{
+		ID:            mapString(resource, "id"),
+		Dimensions:    make(map[string][]string),
+		Applicability: stringList(mapList(doc, "applicability")),
+	}
+	dims := mapMap(doc, "dimensions")
+	for _, item := range dims {
+		key := fmt.Sprint(item.Key)
+		if !containsString(scopeDimensions, key) {
+			return nil, fmt.Errorf("%s: unknown dimension %q (expected one of %s)", path, key, strings.Join(scopeDimensions, ", "))
+		}
+		values, _ := item.Value.([]interface{})
+		res.Dimensions[key] = stringList(values)
+	}
+	return res, nil
+}
+
+// inScope reports whether the resource falls within scope, with the reasons
+// that decided it.
+func (res *resourceProfile) inScope(scope yaml.MapSlice) (bool, []string) {
+	var reasons []string
+	in, out := mapMap(scope, "in"), mapMap(scope, "out")
+	for _, dim := range scopeDimensions {
+		want := stringList(mapList(in, dim))
+		if len(want) == 0 {
+			continue
+		}
+		have := res.Dimensions[dim]
+		if len(have) == 0 {
+			reasons = append(reasons, fmt.Sprintf("%s not described; assumed in scope", dim))
+			continue
+		}
+		if matched := intersectFold(have, want); len(matched) == 0 {
+			return false, append(reasons, fmt.Sprintf("%s %s not in scope.in", dim, strings.Join(have, ", ")))
+		}
+	}
+	for _, dim := range scopeDimensions {
+		if matched := intersectFold(res.Dimensions[dim], stringList(mapList(out, dim))); len(matched) > 0 {
+			return false, append(reasons, fmt.Sprintf("%s %s excluded by scope.out", dim, strings.Join(matched, ", ")))
+		}
+	}
+	return true, reasons
+}
+
+// applies reports whether a requirement with the given applicability groups
+// applies to the resource.
+func (res *resourceProfile) applies(applicability []string) bool {
+	return len(res.Applicability) == 0 || len(applicability) == 0 || len(intersectFold(applicability, res.Applicability)) > 0
+}
+
+// intersectFold returns the values of a that are also in b, ignoring case.
+func intersectFold(a, b []string) []string {
+	var out []string
+	for _, x := range a {
+		for _, y := range b {
+			if strings.EqualFold(x, y) {
+				out = append(out, x)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// applicabilityReport lists, per policy, what applies to one resource.
+type applicabilityReport struct {
+	Resource string                `json:"resource,omitempty" yaml:"resource,omitempty"`
+	Policies []policyApplicableSet `json:"policies" yaml:"policies"`
+}
+
+type policyApplicableSet struct {
+	Policy       string                  `json:"policy" yaml:"policy"`
+	File         string                  `json:"file" yaml:"file"`
+	Applies      bool                    `json:"applies" yaml:"applies"`
+	Reasons      []string                `json:"reasons,omitempty" yaml:"reasons,omitempty"`
+	Requirements []applicableRequirement `json:"requirements,omitempty" yaml:"requirements,omitempty"`
+	Excluded     []applicableRequirement `json:"excluded,omitempty" yaml:"excluded,omitempty"`
+}
+
+type applicableRequirement struct {
+	Catalog     string `json:"catalog" yaml:"catalog"`
+	Control     string `json:"control" yaml:"control"`
+	Requirement string `json:"requirement" yaml:"requirement"`
+	Reason      string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// policyApplicability compiles the policy doc and splits its requirements
+// into those that apply to res and those that do not.
+func policyApplicability(file string, doc yaml.MapSlice, src *artifactSource, res *resourceProfile, resolver *artifactResolver) (policyApplicableSet, []Diagnostic) {
+	set := policyApplicableSet{Policy: mapString(mapMap(doc, "metadata"), "id"), File: file}
+	set.Applies, set.Reasons = res.inScope(mapMap(doc, "scope"))
+	if !set.Applies {
+		return set, nil
+	}
+
+	effective, diags := compilePolicy(file, doc, src, resolver)
+	if hasErrors(diags) {
+		return set, diags
+	}
+	accepted, reasons := acceptedThreats(file, doc, res, resolver)
+	set.Reasons = append(set.Reasons, reasons...)
+
+	for _, cat := range effective.Catalogs {
+		for _, ctl := range cat.Controls {
+			reason := ""
+			for _, t := range ctl.threats {
+				if risk, ok := accepted[threatKey(resolver, cat.index, t)]; ok {
+					reason = fmt.Sprintf("risk accepted by %s", risk)
+					break
+				}
+			}
+			for _, ar := range ctl.Requirements {
+				req := applicableRequirement{Catalog: cat.ReferenceID, Control: ctl.ID, Requirement: ar.ID, Reason: reason}
+				if reason == "" && !res.applies(ar.Applicability) {
+					req.Reason = fmt.Sprintf("applicability %s does not match resource applicability %s", strings.Join(ar.Applicability, ", "), strings.Join(res.Applicability, ", "))
+				}
+				if req.Reason != "" {
+					set.Excluded = append(set.Excluded, req)
+					continue
+				}
+				set.Requirements = append(set.Requirements, req)
+			}
+		}
+	}
+	return set, diags
+}
+
+// acceptedThreats returns the threats of the risks the policy accepts for
+// res, keyed by threatKey, with the id of the accepting entry.
+func acceptedThreats(file string, doc yaml.MapSlice, res *resourceProfile, resolver *artifactResolver) (map[string]string, []string) {
+	self := indexEntries(doc)
+	self.Dir = filepath.Dir(file)
+
+	accepted := make(map[string]string)
+	var reasons []string
+	for _, acc := range listMaps(mapList(mapMap(doc, "risks"), "accepted")) {
+		id := mapString(acc, "id")
+		if scope := mapMap(acc, "scope"); scope != nil {
+			if ok, _ := res.inScope(scope); !ok {
+				continue
+			}
+		}
+		risk := mapMap(acc, "risk")
+		idx, err := resolver.follow(self, mapString(risk, "reference-id"))
+		if err != nil {
+			reasons = append(reasons, fmt.Sprintf("accepted risk %s not applied: %v", id, err))
+			continue
+		}
+		entry := findEntry(idx.Doc, "risks", mapString(risk, "entry-id"))
+		if entry == nil {
+			reasons = append(reasons, fmt.Sprintf("accepted risk %s not applied: %s is not a risk of %s", id, mapString(risk, "entry-id"), idx.ID))
+			continue
+		}
+		for _, mapping := range listMaps(mapList(entry, "threats")) {
+			for _, t := range listMaps(mapList(mapping, "entries")) {
+				ref := entryRef{RefID: mapString(mapping, "reference-id"), EntryID: mapString(t, "reference-id")}
+				accepted[threatKey(resolver, idx, ref)] = id
+			}
+		}
+	}
+	return accepted, reasons
+}
+
+// threatKey identifies a threat by the id of its catalog and its entry id,
+// so that mappings through different mapping-reference ids compare equal.
+// References that cannot be resolved fall back to the mapping-reference id.
+func threatKey(resolver *artifactResolver, from *entryIndex, ref entryRef) string {
+	artifact := ref.RefID
+	if from != nil {
+		if idx, err := resolver.follow(from, ref.RefID); err == nil {
+			artifact = idx.ID
+		}
+	}
+	return artifact + "/" + ref.EntryID
+}
+
+// findEntry returns the entry with id in the top-level collection of doc.
+func findEntry(doc yaml.MapSlice, collection, id string) yaml.MapSlice {
+	for _, entry := range listMaps(mapList(doc, collection)) {
+		if mapString(entry, "id") == id {
+			return entry
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPolicyApplicability(t *testing.T) {
+	file := "testdata/scoped-policy.yaml"
+	doc, err := readDocument(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		edit     func(*resourceProfile)
+		applies  bool
+		required string
+		excluded string
+	}{
+		{
+			name:     "in scope",
+			edit:     func(*resourceProfile) {},
+			applies:  true,
+			required: "FB-02.AR01,FC-01.AR01,FB-01.AR01",
+			excluded: "RC-001.AR01,FX-01.AR01",
+		},
+		{
+			name:    "excluded by scope.out",
+			edit:    func(r *resourceProfile) { r.Dimensions["sensitivity"] = []string{"public"} },
+			applies: false,
+		},
+		{
+			name:    "outside scope.in",
+			edit:    func(r *resourceProfile) { r.Dimensions["geopolitical"] = []string{"Canada"} },
+			applies: false,
+		},
+		{
+			name:     "no applicability groups",
+			edit:     func(r *resourceProfile) { r.Applicability = nil },
+			applies:  true,
+			required: "FB-02.AR01,FC-01.AR01,FB-01.AR01,FX-01.AR01",
+			excluded: "RC-001.AR01",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := loadResourceProfile("testdata/scoped-resource.yaml")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.edit(res)
+
+			set, diags := policyApplicability(file, doc, nil, res, newArtifactResolver("", "", false))
+			if hasErrors(diags) {
+				t.Fatalf("unexpected diagnostics: %v", diags)
+			}
+			if set.Applies != tt.applies {
+				t.Fatalf("applies = %v, want %v (reasons: %v)", set.Applies, tt.applies, set.Reasons)
+			}
+			if got := requirementIDs(set.Requirements); got != tt.required {
+				t.Errorf("requirements = %s, want %s", got, tt.required)
+			}
+			if got := requirementIDs(set.Excluded); got != tt.excluded {
+				t.Errorf("excluded = %s, want %s", got, tt.excluded)
+			}
+		})
+	}
+}
+
+func requirementIDs(reqs []applicableRequirement) string {
+	ids := make([]string, 0, len(reqs))
+	for _, r := range reqs {
+		ids = append(ids, r.Requirement)
+	}
+	return strings.Join(ids, ",")
+}
@@ -0,0 +1,431 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/spf13/cobra"
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Work with Gemara audit logs",
+}
+
+var auditDraftCmd = &cobra.Command{
+	Use:   "draft [policy] [logs-or-directories...]",
+	Short: "Draft an AuditLog from a period's evaluation and enforcement logs",
+	Long: `Pre-populate an AuditLog for one target, with a Policy as its criteria,
+from the EvaluationLogs and EnforcementLogs of a period. Each control the
+compiled policy requires (see policy compile) gets results:
+
+  Gap          assessment requirements no log evaluated (Not Run does not
+               count as an evaluation);
+  Finding      the control Failed in each of its last --persistent
+               evaluations;
+  Strength     the control Passed in every evaluation, and was evaluated at
+               least --persistent times;
+  Observation  anything else: mixed results, Needs Review, or too few
+               evaluations to conclude.
+
+Evidence points at the logs each result is based on, including the
+EnforcementLog actions that cite the control. The draft is marked with
+metadata.draft: true; auditors are expected to edit its conclusions.
+
+Directories are searched recursively for logs, which are kept when their
+date (see trend) falls within --from and --to. Logs must share a target
+unless --target selects one. The draft is validated before it is written.`,
+	Args:          cobra.MinimumNArgs(2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE:          runAuditDraft,
+}
+
+var auditDraftFlags struct {
+	schemaDir  string
+	target     string
+	from       string
+	to         string
+	persistent int
+	id         string
+	format     string
+	outputPath string
+	mirrorDir  string
+	cacheDir   string
+	fetch      bool
+}
+
+const (
+	auditGap         = "Gap"
+	auditFinding     = "Finding"
+	auditObservation = "Observation"
+	auditStrength    = "Strength"
+)
+
+func newAuditCmd() *cobra.Command {
+	flags := auditDraftCmd.Flags()
+	flags.StringVarP(&auditDraftFlags.schemaDir, "schema", "s", "..", "Path to the CUE package directory")
+	flags.StringVar(&auditDraftFlags.target, "target", "", "Audit only the logs of this target id")
+	flags.StringVar(&auditDraftFlags.from, "from", "", "Start of the period, RFC 3339 or YYYY-MM-DD (default: unbounded)")
+	flags.StringVar(&auditDraftFlags.to, "to", "", "End of the period, RFC 3339 or YYYY-MM-DD (default: unbounded)")
+	flags.IntVar(&auditDraftFlags.persistent, "persistent", 2, "Evaluations needed before a failure is a Finding or a pass a Strength")
+	flags.StringVar(&auditDraftFlags.id, "id", "", "metadata.id of the AuditLog (default: <policy id>-audit-draft)")
+	flags.StringVarP(&auditDraftFlags.format, "format", "f", "", "Output format: yaml or json (default: from the output or policy extension)")
+	flags.StringVarP(&auditDraftFlags.outputPath, "output", "o", "", "Output path for the AuditLog (default: stdout)")
+	flags.StringVar(&auditDraftFlags.mirrorDir, "mirror", "", "Read-only directory mirroring http(s) artifacts as host/path")
+	flags.StringVar(&auditDraftFlags.cacheDir, "cache", "", "Directory where downloaded http(s) artifacts are cached")
+	flags.BoolVar(&auditDraftFlags.fetch, "fetch", false, "Download http(s) artifacts missing from the mirror and cache")
+	auditCmd.AddCommand(auditDraftCmd)
+	return auditCmd
+}
+
+func runAuditDraft(cmd *cobra.Command, args []string) error {
+	policyFile := args[0]
+	if auditDraftFlags.persistent < 1 {
+		return fmt.Errorf("--persistent must be at least 1")
+	}
+	from, err := parsePeriodBound(auditDraftFlags.from, false)
+	if err != nil {
+		return fmt.Errorf("invalid --from: %w", err)
+	}
+	to, err := parsePeriodBound(auditDraftFlags.to, true)
+	if err != nil {
+		return fmt.Errorf("invalid --to: %w", err)
+	}
+
+	policy, err := readDocument(policyFile)
+	if err != nil {
+		return err
+	}
+	if typ := mapString(mapMap(policy, "metadata"), "type"); typ != "Policy" {
+		return fmt.Errorf("%s is a %s, expected a Policy", policyFile, typ)
+	}
+	logs, err := collectLogs(args[1:], "EvaluationLog", "EnforcementLog")
+	if err != nil {
+		return err
+	}
+	var kept []datedLog
+	for _, l := range logs {
+		if (!from.IsZero() && l.Date.Before(from)) || (!to.IsZero() && l.Date.After(to)) {
+			continue
+		}
+		if auditDraftFlags.target != "" && mapString(mapMap(l.Doc, "target"), "id") != auditDraftFlags.target {
+			continue
+		}
+		kept = append(kept, l)
+	}
+
+	resolver := newArtifactResolver(auditDraftFlags.mirrorDir, auditDraftFlags.cacheDir, auditDraftFlags.fetch)
+	effective, _, err := compilePolicyFile(policyFile, policy, resolver)
+	if err != nil {
+		return err
+	}
+
+	d := &auditDrafter{
+		policyFile: policyFile,
+		policy:     policy,
+		effective:  effective,
+		persistent: auditDraftFlags.persistent,
+		id:         auditDraftFlags.id,
+		outDir:     outputDir(auditDraftFlags.outputPath),
+	}
+	doc, err := d.draft(kept)
+	if err != nil {
+		return err
+	}
+
+	out := auditDraftFlags.outputPath
+	format := outputFormat(auditDraftFlags.format, out, policyFile)
+	data, err := encodeDocument(doc, format)
+	if err != nil {
+		return err
+	}
+	if err := writeGenerated(auditDraftFlags.schemaDir, "", out, "audit-draft."+format, data); err != nil {
+		return fmt.Errorf("audit draft: %w", err)
+	}
+	return nil
+}
+
+// parsePeriodBound parses an RFC 3339 time or a date; a date as the end of
+// a period includes the whole day.
+func parsePeriodBound(s string, end bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither RFC 3339 nor YYYY-MM-DD", s)
+	}
+	if end {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
+
+// auditDrafter builds an AuditLog draft for one compiled policy.
+type auditDrafter struct {
+	policyFile string
+	policy     yaml.MapSlice
+	effective  *effectivePolicy
+	persistent int
+	id         string
+	// outDir is where the draft is written; file:// urls it references
+	// are relative to it.
+	outDir string
+}
+
+// controlEvaluation is one evaluation of a control: the log, the control's
+// aggregate result in it, and the requirements it evaluated.
+type controlEvaluation struct {
+	Log       datedLog
+	Result    string
+	Evaluated []string
+}
+
+// draft derives the AuditLog from logs, which must share a target.
+func (d *auditDrafter) draft(logs []datedLog) (yaml.MapSlice, error) {
+	sort.SliceStable(logs, func(i, j int) bool { return logs[i].Date.Before(logs[j].Date) })
+	var evaluations, enforcements []datedLog
+	var target yaml.MapSlice
+	for _, l := range logs {
+		t := mapMap(l.Doc, "target")
+		if target == nil {
+			target = t
+		} else if other := mapString(t, "id"); other != mapString(target, "id") {
+			return nil, fmt.Errorf("logs evaluate both %q and %q (select one with --target)", mapString(target, "id"), other)
+		}
+		if mapString(mapMap(l.Doc, "metadata"), "type") == "EvaluationLog" {
+			evaluations = append(evaluations, l)
+		} else {
+			enforcements = append(enforcements, l)
+		}
+	}
+	if len(evaluations) == 0 {
+		return nil, fmt.Errorf("no EvaluationLog in the period")
+	}
+
+	history := make(map[string][]controlEvaluation)
+	for _, l := range evaluations {
+		for _, eval := range listMaps(mapList(l.Doc, "evaluations")) {
+			control := mapMap(eval, "control")
+			cat, ctl := findEffectiveControl(d.effective.Catalogs, mapString(control, "reference-id"), mapString(control, "entry-id"))
+			if ctl == nil {
+				continue
+			}
+			ce := controlEvaluation{Log: l}
+			var results []string
+			for _, a := range listMaps(mapList(eval, "assessment-logs")) {
+				r := mapString(a, "result")
+				results = append(results, r)
+				if r != "Not Run" {
+					ce.Evaluated = append(ce.Evaluated, mapString(mapMap(a, "requirement"), "entry-id"))
+				}
+			}
+			ce.Result = aggregateResult(results)
+			key := cat.ReferenceID + "/" + ctl.ID
+			history[key] = append(history[key], ce)
+		}
+	}
+
+	var results []interface{}
+	counts := make(map[string]int)
+	used := make(map[string]datedLog)
+	for _, cat := range d.effective.Catalogs {
+		for _, ctl := range cat.Controls {
+			for _, r := range d.controlResults(cat, ctl, history[cat.ReferenceID+"/"+ctl.ID], enforcements, used) {
+				results = append(results, r)
+				counts[mapString(r, "type")]++
+			}
+		}
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("%s requires no controls to audit", d.policyFile)
+	}
+
+	policyID := d.effective.Policy
+	summary := fmt.Sprintf("Draft audit of %s against %s from %d evaluation and %d enforcement log(s) dated %s to %s: "+
+		"%d finding(s), %d gap(s), %d observation(s), %d strength(s). The results were derived from the logs and must be reviewed.",
+		mapString(target, "id"), policyID, len(evaluations), len(enforcements),
+		logs[0].Date.UTC().Format("2006-01-02"), logs[len(logs)-1].Date.UTC().Format("2006-01-02"),
+		counts[auditFinding], counts[auditGap], counts[auditObservation], counts[auditStrength])
+
+	return yaml.MapSlice{
+		{Key: "metadata", Value: d.metadata(used)},
+		{Key: "target", Value: target},
+		{Key: "summary", Value: summary},
+		{Key: "criteria", Value: []interface{}{yaml.MapSlice{{Key: "reference-id", Value: policyID}}}},
+		{Key: "results", Value: results},
+	}, nil
+}
+
+// controlResults classifies one control from its evaluations, recording
+// the logs cited as evidence in used.
+func (d *auditDrafter) controlResults(cat effectiveCatalog, ctl effectiveControl, history []controlEvaluation, enforcements []datedLog, used map[string]datedLog) []yaml.MapSlice {
+	label := ctl.ID
+	if ctl.Title != "" {
+		label += " " + ctl.Title
+	}
+	evaluated := make(map[string]bool)
+	var sequence []string
+	var evidence []interface{}
+	for _, ce := range history {
+		for _, id := range ce.Evaluated {
+			evaluated[id] = true
+		}
+		if ce.Result == "Not Run" {
+			continue
+		}
+		sequence = append(sequence, ce.Result)
+		evidence = append(evidence, logEvidence(ce.Log, fmt.Sprintf("%s %s on %s.", ctl.ID, ce.Result, ce.Log.Date.UTC().Format("2006-01-02"))))
+		used[ce.Log.id()] = ce.Log
+	}
+
+	var missing []string
+	for _, ar := range ctl.Requirements {
+		if !evaluated[ar.ID] {
+			missing = append(missing, ar.ID)
+		}
+	}
+	var out []yaml.MapSlice
+	if len(missing) > 0 {
+		desc := fmt.Sprintf("No log in the period evaluated %s of %s.", strings.Join(missing, ", "), label)
+		out = append(out, auditResult(ctl.ID+"-gap", auditGap, label+" was not fully evaluated", desc, cat.ReferenceID, missing, nil))
+	}
+	if len(sequence) == 0 {
+		return out
+	}
+
+	ids := make(map[string]bool)
+	ids[ctl.ID] = true
+	for _, ar := range ctl.Requirements {
+		ids[ar.ID] = true
+	}
+	for _, l := range enforcements {
+		for _, action := range listMaps(mapList(l.Doc, "actions")) {
+			if !citesEntry(action, ids) {
+				continue
+			}
+			desc := mapString(action, "disposition") + " action"
+			if msg := mapString(action, "message"); msg != "" {
+				desc += ": " + msg
+			}
+			evidence = append(evidence, logEvidence(l, desc))
+			used[l.id()] = l
+		}
+	}
+
+	sort.SliceStable(evidence, func(i, j int) bool {
+		return mapString(evidence[i].(yaml.MapSlice), "collected") < mapString(evidence[j].(yaml.MapSlice), "collected")
+	})
+
+	n := len(sequence)
+	typ, title := auditObservation, label+" needs review"
+	desc := fmt.Sprintf("%s was evaluated %d time(s) in the period: %s.", label, n, strings.Join(sequence, ", "))
+	switch {
+	case n >= d.persistent && allResults(sequence[n-d.persistent:], "Failed"):
+		typ, title = auditFinding, label+" fails persistently"
+		desc += fmt.Sprintf(" It Failed in each of its last %d evaluations.", d.persistent)
+	case n >= d.persistent && allResults(sequence, "Passed", "Not Applicable") && containsString(sequence, "Passed"):
+		typ, title = auditStrength, label+" passes consistently"
+		desc += " It Passed in every evaluation."
+	}
+	return append(out, auditResult(ctl.ID+"-"+strings.ToLower(typ), typ, title, desc, cat.ReferenceID, []string{ctl.ID}, evidence))
+}
+
+func auditResult(id, typ, title, desc, refID string, entries []string, evidence []interface{}) yaml.MapSlice {
+	var list []interface{}
+	for _, e := range entries {
+		list = append(list, yaml.MapSlice{{Key: "reference-id", Value: e}})
+	}
+	r := yaml.MapSlice{
+		{Key: "id", Value: id},
+		{Key: "title", Value: title},
+		{Key: "type", Value: typ},
+		{Key: "description", Value: desc},
+		{Key: "criteria-reference", Value: yaml.MapSlice{{Key: "reference-id", Value: refID}, {Key: "entries", Value: list}}},
+	}
+	if len(evidence) > 0 {
+		r = append(r, yaml.MapItem{Key: "evidence", Value: evidence})
+	}
+	return r
+}
+
+// logEvidence cites a log as evidence collected at its date.
+func logEvidence(l datedLog, desc string) yaml.MapSlice {
+	return yaml.MapSlice{
+		{Key: "type", Value: mapString(mapMap(l.Doc, "metadata"), "type")},
+		{Key: "collected", Value: l.Date.UTC().Format(time.RFC3339)},
+		{Key: "location", Value: yaml.MapSlice{{Key: "reference-id", Value: l.id()}}},
+		{Key: "description", Value: desc},
+	}
+}
+
+// citesEntry reports whether an EnforcementLog action has a finding whose
+// requirement or log entry is one of ids.
+func citesEntry(action yaml.MapSlice, ids map[string]bool) bool {
+	for _, f := range listMaps(mapList(mapMap(action, "justification"), "assessments")) {
+		if ids[mapString(mapMap(f, "requirement"), "entry-id")] || ids[mapString(mapMap(f, "log"), "entry-id")] {
+			return true
+		}
+	}
+	return false
+}
+
+// allResults reports whether every result is one of want.
+func allResults(results []string, want ...string) bool {
+	for _, r := range results {
+		if !containsString(want, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// metadata describes the draft, referencing the policy, the catalogs the
+// results point into, and the logs cited as evidence.
+func (d *auditDrafter) metadata(used map[string]datedLog) yaml.MapSlice {
+	policyMeta := mapMap(d.policy, "metadata")
+	id := d.id
+	if id == "" {
+		id = d.effective.Policy + "-audit-draft"
+	}
+	meta := yaml.MapSlice{
+		{Key: "id", Value: id},
+		{Key: "type", Value: "AuditLog"},
+		{Key: "gemara-version", Value: mapString(policyMeta, "gemara-version")},
+		{Key: "description", Value: fmt.Sprintf("Draft audit against %s, generated from evaluation and enforcement logs.", d.effective.Policy)},
+		{Key: "author", Value: yaml.MapSlice{
+			{Key: "id", Value: "gemara-docs"},
+			{Key: "name", Value: "gemara-docs audit draft"},
+			{Key: "type", Value: "Software"},
+		}},
+		{Key: "draft", Value: true},
+	}
+
+	var notes []string
+	meta = mergeByID(&notes, meta, "mapping-references", artifactReference(d.policyFile, d.policy, d.outDir), d.policyFile)
+	for _, cat := range d.effective.Catalogs {
+		if ref := findEntry(policyMeta, "mapping-references", cat.ReferenceID); ref != nil {
+			meta = mergeByID(&notes, meta, "mapping-references", rebaseReference(ref, filepath.Dir(d.policyFile), d.outDir), d.policyFile)
+		}
+	}
+	var ids []string
+	for id := range used {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		l := used[id]
+		meta = mergeByID(&notes, meta, "mapping-references", artifactReference(l.File, l.Doc, d.outDir), l.File)
+	}
+	return meta
+}
@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-yaml"
+)
+
+func draftAudit(t *testing.T, from time.Time) yaml.MapSlice {
+	t.Helper()
+	file := "testdata/disposition-policy.yaml"
+	policy, err := readDocument(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	effective, diags := compilePolicy(file, policy, nil, newArtifactResolver("", "", false))
+	if hasErrors(diags) {
+		t.Fatalf("policy does not compile: %+v", diags)
+	}
+	logs, err := collectLogs([]string{
+		"testdata/disposition-evaluation-log.yaml",
+		"testdata/audit-evaluation-log.yaml",
+		"testdata/linked-enforcement-log.yaml",
+	}, "EvaluationLog", "EnforcementLog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kept []datedLog
+	for _, l := range logs {
+		if !l.Date.Before(from) {
+			kept = append(kept, l)
+		}
+	}
+	d := &auditDrafter{policyFile: file, policy: policy, effective: effective, persistent: 2}
+	doc, err := d.draft(kept)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := encodeDocument(doc, "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validateGenerated("../../..", "", "audit-draft.yaml", data); err != nil {
+		t.Fatalf("draft does not validate: %v\n%s", err, data)
+	}
+	return doc
+}
+
+func auditResultTypes(doc yaml.MapSlice) map[string]string {
+	types := make(map[string]string)
+	for _, r := range listMaps(mapList(doc, "results")) {
+		types[mapString(r, "id")] = mapString(r, "type")
+	}
+	return types
+}
+
+func TestAuditDraft(t *testing.T) {
+	doc := draftAudit(t, time.Time{})
+
+	want := map[string]string{
+		"RC-001-observation": auditObservation,
+		"LV-01-finding":      auditFinding,
+		"LV-02-strength":     auditStrength,
+		"LV-03-observation":  auditObservation,
+	}
+	got := auditResultTypes(doc)
+	if len(got) != len(want) {
+		t.Errorf("results %v, want %v", got, want)
+	}
+	for id, typ := range want {
+		if got[id] != typ {
+			t.Errorf("result %s is %q, want %q", id, got[id], typ)
+		}
+	}
+
+	meta := mapMap(doc, "metadata")
+	if draft, _ := mapGet(meta, "draft"); draft != true {
+		t.Errorf("draft is %v, want true", draft)
+	}
+	for _, id := range []string{"DISPOSITION-POLICY", "LEVELS", "DISPOSITION-LOG", "AUDIT-LOG", "LINKED-ENFORCEMENT"} {
+		if findEntry(meta, "mapping-references", id) == nil {
+			t.Errorf("no mapping-reference %s", id)
+		}
+	}
+
+	finding := findEntry(doc, "results", "LV-01-finding")
+	var sources []string
+	for _, e := range listMaps(mapList(finding, "evidence")) {
+		sources = append(sources, mapString(mapMap(e, "location"), "reference-id"))
+	}
+	if got, want := strings.Join(sources, ","), "DISPOSITION-LOG,LINKED-ENFORCEMENT,AUDIT-LOG"; got != want {
+		t.Errorf("finding evidence %s, want %s", got, want)
+	}
+}
+
+func TestAuditDraftGaps(t *testing.T) {
+	doc := draftAudit(t, time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC))
+
+	got := auditResultTypes(doc)
+	for id, typ := range map[string]string{
+		"RC-001-gap":        auditGap,
+		"LV-01-gap":         auditGap,
+		"LV-01-observation": auditObservation,
+		"LV-02-observation": auditObservation,
+	} {
+		if got[id] != typ {
+			t.Errorf("result %s is %q, want %q", id, got[id], typ)
+		}
+	}
+	if _, ok := got["RC-001-observation"]; ok {
+		t.Error("RC-001 was only Not Run but has an observation")
+	}
+
+	gap := findEntry(doc, "results", "LV-01-gap")
+	entries := listMaps(mapList(mapMap(gap, "criteria-reference"), "entries"))
+	if len(entries) != 1 || mapString(entries[0], "reference-id") != "LV-01.AR01" {
+		t.Errorf("LV-01 gap entries %v, want LV-01.AR01", entries)
+	}
+}
@@ -0,0 +1,512 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/goccy/go-yaml"
+	"github.com/spf13/cobra"
+)
+
+var policyConflictsCmd = &cobra.Command{
+	Use:   "conflicts [policies...]",
+	Short: "Find contradictions between policies stacked on the same resources",
+	Long: `Analyze a stack of policies for contradictions. The stack is the policies
+given and, recursively, the policies they list under imports.policies; a
+single policy that imports others is a stack of its own.
+
+  exclusions     one policy excludes a control, assessment requirement, or
+                 guideline that another requires: compiles in (see policy
+                 compile), plans an assessment for, constrains, or
+                 modifies;
+  modifications  two policies modify the same assessment requirement of
+                 the same catalog in ways that clash: one removes what the
+                 other keeps, one replaces what the other modifies, or both
+                 set text, recommendation, or applicability to different
+                 values;
+  constraints    two policies constrain the same entry with a constraint
+                 of the same id but different text, or with the same
+                 wording but different numbers (a warning: "at least 2
+                 reviewers" against "at least 1 reviewer");
+  risks          one policy accepts a risk that another mitigates; an
+                 acceptance whose target-id links it to a mitigation covers
+                 residual risk and is not a conflict.
+
+Catalogs are matched by the id they declare, so policies may name them with
+different mapping references. Every conflict is reported against one
+policy with the location of the other as related. Warnings only fail the
+run with --strict.`,
+	Args:          cobra.MinimumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE:          runPolicyConflicts,
+}
+
+var policyConflictsFlags struct {
+	format     string
+	outputPath string
+	mirrorDir  string
+	cacheDir   string
+	fetch      bool
+	strict     bool
+}
+
+func newPolicyConflictsCmd() *cobra.Command {
+	flags := policyConflictsCmd.Flags()
+	flags.StringVarP(&policyConflictsFlags.format, "format", "f", "text", "Output format: text, json, sarif, or github")
+	flags.StringVarP(&policyConflictsFlags.outputPath, "output", "o", "", "Write the report to a file instead of stdout")
+	flags.StringVar(&policyConflictsFlags.mirrorDir, "mirror", "", "Read-only directory mirroring http(s) artifacts as host/path")
+	flags.StringVar(&policyConflictsFlags.cacheDir, "cache", "", "Directory where downloaded http(s) artifacts are cached")
+	flags.BoolVar(&policyConflictsFlags.fetch, "fetch", false, "Download http(s) artifacts missing from the mirror and cache")
+	flags.BoolVar(&policyConflictsFlags.strict, "strict", false, "Fail on warnings as well as errors")
+	return policyConflictsCmd
+}
+
+func runPolicyConflicts(cmd *cobra.Command, args []string) error {
+	resolver := newArtifactResolver(policyConflictsFlags.mirrorDir, policyConflictsFlags.cacheDir, policyConflictsFlags.fetch)
+	stack, diags, err := stackPolicies(args, resolver)
+	if err != nil {
+		return err
+	}
+	if len(diags) > 0 {
+		if err := writeTextDiagnostics(os.Stderr, []ValidationResult{{File: args[0], Diagnostics: diags}}); err != nil {
+			return err
+		}
+	}
+	if hasErrors(diags) {
+		return fmt.Errorf("the policy stack does not compile")
+	}
+
+	conflicts := checkConflicts(stack, resolver)
+	var results []ValidationResult
+	for _, p := range stack {
+		r := ValidationResult{File: p.file, Definition: "policy conflicts"}
+		for _, d := range conflicts {
+			if d.File == p.file {
+				r.Diagnostics = append(r.Diagnostics, d)
+			}
+		}
+		r.Valid = !hasErrors(r.Diagnostics)
+		results = append(results, r)
+	}
+	if err := writeReport(policyConflictsFlags.outputPath, func(w io.Writer) error {
+		return writeDiagnostics(w, policyConflictsFlags.format, results)
+	}); err != nil {
+		return err
+	}
+	if hasErrors(conflicts) || (policyConflictsFlags.strict && len(conflicts) > 0) {
+		return fmt.Errorf("%d conflict(s) among %d policies", len(conflicts), len(stack))
+	}
+	return nil
+}
+
+// stackedPolicy is one compiled policy of a stack.
+type stackedPolicy struct {
+	file      string
+	doc       yaml.MapSlice
+	src       *artifactSource
+	self      *entryIndex
+	effective *effectivePolicy
+}
+
+// stackPolicies loads and compiles the policies in files and those they
+// import, each once, in breadth-first order. Problems compiling or importing
+// are returned as diagnostics.
+func stackPolicies(files []string, resolver *artifactResolver) ([]*stackedPolicy, []Diagnostic, error) {
+	type pending struct {
+		file string
+		doc  yaml.MapSlice
+	}
+	var queue []pending
+	for _, file := range files {
+		doc, err := readDocument(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		if typ := mapString(mapMap(doc, "metadata"), "type"); typ != "Policy" {
+			return nil, nil, fmt.Errorf("%s is a %s, expected a Policy", file, typ)
+		}
+		queue = append(queue, pending{file, doc})
+	}
+
+	var stack []*stackedPolicy
+	var diags []Diagnostic
+	seen := make(map[string]bool)
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		self := indexEntries(next.doc)
+		if seen[self.ID] {
+			continue
+		}
+		seen[self.ID] = true
+		self.Dir = filepath.Dir(next.file)
+
+		p := &stackedPolicy{file: next.file, doc: next.doc, self: self}
+		if src, err := loadArtifactSource(cuecontext.New(), next.file); err == nil {
+			p.src = src
+		}
+		effective, compileDiags := compilePolicy(p.file, p.doc, p.src, resolver)
+		p.effective = effective
+		diags = append(diags, compileDiags...)
+		stack = append(stack, p)
+
+		for i, imp := range listMaps(mapList(mapMap(p.doc, "imports"), "policies")) {
+			path := []string{"imports", "policies", strconv.Itoa(i), "reference-id"}
+			refID := mapString(imp, "reference-id")
+			idx, err := resolver.follow(self, refID)
+			switch {
+			case err != nil:
+				diags = append(diags, p.diagnostic(rulePolicy, severityError, path, refID, fmt.Sprintf("cannot load import: %v", err)))
+			case idx.Type != "Policy":
+				diags = append(diags, p.diagnostic(rulePolicy, severityError, path, refID, fmt.Sprintf("%s is a %s, expected a Policy", refID, idx.Type)))
+			default:
+				queue = append(queue, pending{importedFile(resolver, self, refID), idx.Doc})
+			}
+		}
+	}
+	sortDiagnostics(diags)
+	return stack, diags, nil
+}
+
+// importedFile is where the artifact from imports as refID is read from:
+// a local path when there is one, else its url.
+func importedFile(resolver *artifactResolver, from *entryIndex, refID string) string {
+	if path, ok := resolver.local[refID]; ok {
+		return path
+	}
+	raw := from.URLs[refID]
+	if u, err := url.Parse(raw); err == nil && u.Scheme == "file" {
+		return filePath(u, from.Dir)
+	}
+	return raw
+}
+
+func (p *stackedPolicy) diagnostic(rule, severity string, path []string, value, msg string) Diagnostic {
+	return diagnosticAt(p.file, p.src, rule, severity, path, value, msg)
+}
+
+func (p *stackedPolicy) related(path []string, msg string) RelatedLocation {
+	r := RelatedLocation{File: p.file, Path: formatPath(path), Message: msg}
+	r.Line, r.Column = p.src.position(path)
+	return r
+}
+
+// policyDecl is one exclusion, modification, constraint, or risk of a
+// policy, keyed by the artifact it applies to and the entry it targets.
+type policyDecl struct {
+	policy *stackedPolicy
+	path   []string
+	scope  string
+	target string
+	m      yaml.MapSlice
+}
+
+// policyDecls are the declarations of one policy that may conflict.
+type policyDecls struct {
+	exclusions, modifications, constraints, mitigated, accepted []policyDecl
+}
+
+// conflictCheck compares the declarations of the policies of a stack.
+type conflictCheck struct {
+	resolver *artifactResolver
+	decls    map[*stackedPolicy]*policyDecls
+	diags    []Diagnostic
+}
+
+// checkConflicts returns a diagnostic for every contradiction between two
+// policies of the stack.
+func checkConflicts(stack []*stackedPolicy, resolver *artifactResolver) []Diagnostic {
+	c := &conflictCheck{resolver: resolver, decls: make(map[*stackedPolicy]*policyDecls)}
+	for _, p := range stack {
+		c.decls[p] = c.collect(p)
+	}
+	for i, p := range stack {
+		for j, q := range stack {
+			if i == j {
+				continue
+			}
+			for _, e := range c.decls[p].exclusions {
+				c.checkExclusion(e, q)
+			}
+			for _, a := range c.decls[p].accepted {
+				c.checkAcceptance(a, q)
+			}
+			if i < j {
+				c.checkModifications(p, q)
+				c.checkConstraints(p, q)
+			}
+		}
+	}
+	sortDiagnostics(c.diags)
+	return c.diags
+}
+
+// scopeID is the id the artifact imported as refID declares, so that
+// policies naming it differently still match.
+func (c *conflictCheck) scopeID(p *stackedPolicy, refID string) string {
+	if idx, err := c.resolver.follow(p.self, refID); err == nil && idx.ID != "" {
+		return idx.ID
+	}
+	return refID
+}
+
+func (c *conflictCheck) collect(p *stackedPolicy) *policyDecls {
+	d := &policyDecls{}
+	imports := mapMap(p.doc, "imports")
+	for _, kind := range []string{"catalogs", "guidance"} {
+		for i, imp := range listMaps(mapList(imports, kind)) {
+			base := []string{"imports", kind, strconv.Itoa(i)}
+			scope := c.scopeID(p, mapString(imp, "reference-id"))
+			for j, id := range stringList(mapList(imp, "exclusions")) {
+				d.exclusions = append(d.exclusions, policyDecl{p, appendPath(base, "exclusions", strconv.Itoa(j)), scope, id, nil})
+			}
+			for j, mod := range listMaps(mapList(imp, "assessment-requirement-modifications")) {
+				target := mapString(mod, "target-id")
+				if mapString(mod, "modification-type") == "Add" {
+					target = mapString(mod, "id")
+				}
+				d.modifications = append(d.modifications, policyDecl{p, appendPath(base, "assessment-requirement-modifications", strconv.Itoa(j)), scope, target, mod})
+			}
+			for j, con := range listMaps(mapList(imp, "constraints")) {
+				d.constraints = append(d.constraints, policyDecl{p, appendPath(base, "constraints", strconv.Itoa(j)), scope, mapString(con, "target-id"), con})
+			}
+		}
+	}
+	risks := mapMap(p.doc, "risks")
+	for _, kind := range []string{"mitigated", "accepted"} {
+		for i, r := range listMaps(mapList(risks, kind)) {
+			risk := mapMap(r, "risk")
+			decl := policyDecl{p, []string{"risks", kind, strconv.Itoa(i)}, c.scopeID(p, mapString(risk, "reference-id")), mapString(risk, "entry-id"), r}
+			if kind == "mitigated" {
+				d.mitigated = append(d.mitigated, decl)
+			} else if mapString(r, "target-id") == "" {
+				d.accepted = append(d.accepted, decl)
+			}
+		}
+	}
+	return d
+}
+
+// checkExclusion reports when q requires the entry e excludes.
+func (c *conflictCheck) checkExclusion(e policyDecl, q *stackedPolicy) {
+	ids, ok := requiredEntries(q.effective, e.scope, e.target)
+	if !ok {
+		return
+	}
+	path, why := c.requiredAt(q, e.scope, ids)
+	p := e.policy
+	d := p.diagnostic(rulePolicyConflict, severityError, e.path, e.target,
+		fmt.Sprintf("%s excludes %s of %s, which %s requires (%s)", p.self.ID, e.target, e.scope, q.self.ID, why))
+	d.Related = []RelatedLocation{q.related(path, fmt.Sprintf("%s requires %s here", q.self.ID, e.target))}
+	c.diags = append(c.diags, d)
+}
+
+// requiredEntries reports whether the compiled policy keeps the control,
+// assessment requirement, or guideline id of scope, returning it with the
+// assessment requirements it comprises.
+func requiredEntries(effective *effectivePolicy, scope, id string) ([]string, bool) {
+	for _, cat := range effective.Catalogs {
+		if cat.ID != scope {
+			continue
+		}
+		for _, ctl := range cat.Controls {
+			if ctl.ID == id {
+				ids := []string{id}
+				for _, ar := range ctl.Requirements {
+					ids = append(ids, ar.ID)
+				}
+				return ids, true
+			}
+			if ctl.requirement(id) >= 0 {
+				return []string{id}, true
+			}
+		}
+	}
+	for _, g := range effective.Guidance {
+		if g.ID != scope {
+			continue
+		}
+		for _, gl := range g.Guidelines {
+			if gl.ID == id {
+				return []string{id}, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// requiredAt is the most specific place q requires one of ids: an
+// assessment plan, a constraint or modification, or else the import.
+func (c *conflictCheck) requiredAt(q *stackedPolicy, scope string, ids []string) ([]string, string) {
+	for i, plan := range listMaps(mapList(mapMap(q.doc, "adherence"), "assessment-plans")) {
+		if containsString(ids, mapString(plan, "requirement-id")) {
+			return []string{"adherence", "assessment-plans", strconv.Itoa(i), "requirement-id"}, "assessment plan " + mapString(plan, "id")
+		}
+	}
+	decls := c.decls[q]
+	for _, d := range append(append([]policyDecl(nil), decls.constraints...), decls.modifications...) {
+		if d.scope == scope && containsString(ids, d.target) {
+			what := "constraint "
+			if mapString(d.m, "modification-type") != "" {
+				what = "modification "
+			}
+			return appendPath(d.path, "target-id"), what + mapString(d.m, "id")
+		}
+	}
+	imports := mapMap(q.doc, "imports")
+	for _, kind := range []string{"catalogs", "guidance"} {
+		for i, imp := range listMaps(mapList(imports, kind)) {
+			if c.scopeID(q, mapString(imp, "reference-id")) == scope {
+				return []string{"imports", kind, strconv.Itoa(i), "reference-id"}, "imported without exclusion"
+			}
+		}
+	}
+	return nil, "imported"
+}
+
+// checkAcceptance reports when q mitigates the risk a accepts.
+func (c *conflictCheck) checkAcceptance(a policyDecl, q *stackedPolicy) {
+	for _, m := range c.decls[q].mitigated {
+		if m.scope != a.scope || m.target != a.target {
+			continue
+		}
+		p := a.policy
+		d := p.diagnostic(rulePolicyConflict, severityError, appendPath(a.path, "risk"), a.target,
+			fmt.Sprintf("%s accepts risk %s of %s (%s), which %s mitigates (%s)", p.self.ID, a.target, a.scope, mapString(a.m, "id"), q.self.ID, mapString(m.m, "id")))
+		d.Related = []RelatedLocation{q.related(appendPath(m.path, "risk"), fmt.Sprintf("%s mitigates %s here", q.self.ID, a.target))}
+		c.diags = append(c.diags, d)
+	}
+}
+
+// checkModifications reports modifications of p and q that target the same
+// assessment requirement and clash.
+func (c *conflictCheck) checkModifications(p, q *stackedPolicy) {
+	for _, a := range c.decls[p].modifications {
+		for _, b := range c.decls[q].modifications {
+			if a.scope != b.scope || a.target != b.target {
+				continue
+			}
+			why := modificationClash(a.m, b.m)
+			if why == "" {
+				continue
+			}
+			d := p.diagnostic(rulePolicyConflict, severityError, appendPath(a.path, "target-id"), a.target,
+				fmt.Sprintf("modification %s of %s and modification %s of %s clash on %s: %s",
+					mapString(a.m, "id"), p.self.ID, mapString(b.m, "id"), q.self.ID, a.target, why))
+			d.Related = []RelatedLocation{q.related(appendPath(b.path, "target-id"), fmt.Sprintf("%s modifies %s here", q.self.ID, a.target))}
+			c.diags = append(c.diags, d)
+		}
+	}
+}
+
+// modificationClash explains why two modifications of the same target
+// cannot both apply, or returns "" when they agree.
+func modificationClash(a, b yaml.MapSlice) string {
+	ka, kb := mapString(a, "modification-type"), mapString(b, "modification-type")
+	switch {
+	case ka == "Remove" && kb == "Remove":
+		return ""
+	case ka == "Remove":
+		return "one removes it, the other applies " + kb
+	case kb == "Remove":
+		return "one removes it, the other applies " + ka
+	case (ka == "Replace") != (kb == "Replace"):
+		return "one replaces it, the other modifies it"
+	case ka == "Replace" && mapString(a, "id") != mapString(b, "id"):
+		return fmt.Sprintf("it is replaced by %s and by %s", mapString(a, "id"), mapString(b, "id"))
+	case ka == "Add" && mapString(a, "target-id") != mapString(b, "target-id"):
+		return fmt.Sprintf("it is added to %s and to %s", mapString(a, "target-id"), mapString(b, "target-id"))
+	}
+	var fields []string
+	for _, f := range []string{"text", "recommendation"} {
+		if va, vb := mapString(a, f), mapString(b, f); va != "" && vb != "" && va != vb {
+			fields = append(fields, f)
+		}
+	}
+	if va, vb := stringList(mapList(a, "applicability")), stringList(mapList(b, "applicability")); len(va) > 0 && len(vb) > 0 && !sameStrings(va, vb) {
+		fields = append(fields, "applicability")
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	return "they set different " + strings.Join(fields, ", ")
+}
+
+// checkConstraints reports constraints of p and q on the same entry that
+// contradict each other.
+func (c *conflictCheck) checkConstraints(p, q *stackedPolicy) {
+	for _, a := range c.decls[p].constraints {
+		for _, b := range c.decls[q].constraints {
+			if a.scope != b.scope || a.target != b.target {
+				continue
+			}
+			ta, tb := mapString(a.m, "text"), mapString(b.m, "text")
+			if ta == tb {
+				continue
+			}
+			severity, why := severityError, ""
+			if id := mapString(a.m, "id"); id == mapString(b.m, "id") {
+				why = fmt.Sprintf("constraint %s on %s reads %q in %s but %q in %s", id, a.target, ta, p.self.ID, tb, q.self.ID)
+			} else {
+				wa, na := constraintShape(ta)
+				wb, nb := constraintShape(tb)
+				if wa != wb || na == nb {
+					continue
+				}
+				severity = severityWarning
+				why = fmt.Sprintf("constraints %s of %s and %s of %s on %s set different values: %q and %q",
+					mapString(a.m, "id"), p.self.ID, mapString(b.m, "id"), q.self.ID, a.target, ta, tb)
+			}
+			d := p.diagnostic(rulePolicyConflict, severity, appendPath(a.path, "text"), a.target, why)
+			d.Related = []RelatedLocation{q.related(appendPath(b.path, "text"), fmt.Sprintf("%s constrains %s here", q.self.ID, a.target))}
+			c.diags = append(c.diags, d)
+		}
+	}
+}
+
+var constraintNumber = regexp.MustCompile(`^\d+(\.\d+)?$`)
+
+// constraintShape splits constraint text into its wording, with numbers
+// replaced by #, and its numbers. Case, punctuation, and plurals are folded
+// so that "at least 1 reviewer" and "At least 2 reviewers." have the same
+// wording.
+func constraintShape(text string) (wording, numbers string) {
+	var words, nums []string
+	for _, w := range strings.Fields(strings.ToLower(text)) {
+		w = strings.Trim(w, ".,;:!?()\"'")
+		if constraintNumber.MatchString(w) {
+			words = append(words, "#")
+			nums = append(nums, w)
+			continue
+		}
+		words = append(words, strings.TrimSuffix(w, "s"))
+	}
+	return strings.Join(words, " "), strings.Join(nums, " ")
+}
+
+// sameStrings reports whether a and b hold the same strings in any order.
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = append([]string(nil), a...), append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
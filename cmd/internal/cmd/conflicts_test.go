@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+)
+
+func TestCheckConflicts(t *testing.T) {
+	resolver := newArtifactResolver("", "", false)
+	stack, diags, err := stackPolicies([]string{"testdata/conflict-team-policy.yaml"}, resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hasErrors(diags) {
+		t.Fatalf("stack does not compile: %+v", diags)
+	}
+	if len(stack) != 2 || stack[1].file != "testdata/conflict-baseline-policy.yaml" {
+		t.Fatalf("stack = %d policies, want the team policy and the baseline it imports", len(stack))
+	}
+
+	byPath := make(map[string]Diagnostic)
+	for _, d := range checkConflicts(stack, resolver) {
+		if d.File != "testdata/conflict-team-policy.yaml" || d.Rule != rulePolicyConflict {
+			t.Errorf("unexpected diagnostic: %+v", d)
+		}
+		if len(d.Related) != 1 || d.Related[0].File != "testdata/conflict-baseline-policy.yaml" || d.Related[0].Line == 0 {
+			t.Errorf("%s: related = %+v, want a location in the baseline", d.Path, d.Related)
+		}
+		byPath[d.Path] = d
+	}
+	if len(byPath) != 5 {
+		t.Errorf("got %d conflicts, want 5: %+v", len(byPath), byPath)
+	}
+
+	for path, want := range map[string]struct{ severity, message, related string }{
+		"imports.catalogs[0].exclusions[0]": {severityError, "excludes LV-03 of LEVELS-CONTROLS, which CONFLICT-BASELINE requires (assessment plan sign-check)",
+			`adherence."assessment-plans"[0]."requirement-id"`},
+		"imports.catalogs[0].constraints[0].text": {severityError, "constraint review-count on LV-01 reads",
+			"imports.catalogs[0].constraints[0].text"},
+		"imports.catalogs[0].constraints[1].text": {severityWarning, "set different values",
+			"imports.catalogs[0].constraints[0].text"},
+		`imports.catalogs[0]."assessment-requirement-modifications"[0]."target-id"`: {severityError, "one removes it, the other applies Modify",
+			`imports.catalogs[0]."assessment-requirement-modifications"[0]."target-id"`},
+		"risks.accepted[0].risk": {severityError, "which CONFLICT-BASELINE mitigates (MITIGATE-TAMPER)",
+			"risks.mitigated[0].risk"},
+	} {
+		d, ok := byPath[path]
+		if !ok {
+			t.Errorf("no conflict at %s", path)
+			continue
+		}
+		if d.Severity != want.severity || !strings.Contains(d.Message, want.message) || d.Related[0].Path != want.related {
+			t.Errorf("%s = %+v", path, d)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := writeTextDiagnostics(&buf, []ValidationResult{{File: "testdata/conflict-team-policy.yaml", Diagnostics: []Diagnostic{byPath["risks.accepted[0].risk"]}}}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "    related: testdata/conflict-baseline-policy.yaml:") {
+		t.Errorf("text output lacks the related location:\n%s", buf.String())
+	}
+}
+
+func TestModificationClash(t *testing.T) {
+	mod := func(kind, id, text string) yaml.MapSlice {
+		m := yaml.MapSlice{{Key: "id", Value: id}, {Key: "modification-type", Value: kind}}
+		if text != "" {
+			m = append(m, yaml.MapItem{Key: "text", Value: text})
+		}
+		return m
+	}
+	for _, tc := range []struct {
+		a, b  yaml.MapSlice
+		clash bool
+	}{
+		{mod("Remove", "a", ""), mod("Remove", "b", ""), false},
+		{mod("Modify", "a", "X"), mod("Override", "b", "X"), false},
+		{mod("Modify", "a", "X"), mod("Modify", "b", ""), false},
+		{mod("Modify", "a", "X"), mod("Modify", "b", "Y"), true},
+		{mod("Replace", "a", "X"), mod("Modify", "b", "X"), true},
+		{mod("Replace", "a", "X"), mod("Replace", "b", "X"), true},
+		{mod("Remove", "a", ""), mod("Override", "b", "Y"), true},
+	} {
+		if why := modificationClash(tc.a, tc.b); (why != "") != tc.clash {
+			t.Errorf("modificationClash(%v, %v) = %q, want clash %v", tc.a, tc.b, why, tc.clash)
+		}
+	}
+}
+
+func TestConstraintShape(t *testing.T) {
+	wa, na := constraintShape("Require at least 2 reviewers.")
+	wb, nb := constraintShape("require at least 1 reviewer")
+	if wa != wb || na == nb {
+		t.Errorf("shapes = (%q, %q) and (%q, %q), want the same wording with different numbers", wa, na, wb, nb)
+	}
+	if wc, _ := constraintShape("Review at least annually"); wc == wa {
+		t.Errorf("unrelated constraint has wording %q", wc)
+	}
+}
@@ -11,7 +11,6 @@ import (
 	"strings"
 
 	"cuelang.org/go/cue/ast"
-	"cuelang.org/go/cue/load"
 	"cuelang.org/go/cue/token"
 	"github.com/goccy/go-yaml"
 )
@@ -64,21 +63,9 @@ func readVersion(schemaDir string) string {
 }
 
 func convertCUEToOpenAPI(schemaDir, outputPath string, opts ConvertOpts) error {
-	if !filepath.IsAbs(schemaDir) {
-		wd, err := os.Getwd()
-		if err != nil {
-			return fmt.Errorf("failed to get working directory: %w", err)
-		}
-		schemaDir = filepath.Join(wd, schemaDir)
-	}
-
-	insts := load.Instances([]string{"."}, &load.Config{Dir: schemaDir})
-	if len(insts) == 0 || insts[0].Err != nil {
-		err := error(nil)
-		if len(insts) > 0 {
-			err = insts[0].Err
-		}
-		return fmt.Errorf("failed to load CUE package: %v", err)
+	inst, schemaDir, err := loadSchemaInstance(schemaDir)
+	if err != nil {
+		return err
 	}
 
 	version := opts.Version
@@ -104,7 +91,7 @@ func convertCUEToOpenAPI(schemaDir, outputPath string, opts ConvertOpts) error {
 
 	seen := make(map[string]bool)
 	manifest := make(map[string][]string) // filename → schema names
-	files := insts[0].Files
+	files := inst.Files
 	names := make([]string, 0, len(files))
 	byName := make(map[string]*ast.File)
 	for _, f := range files {
@@ -0,0 +1,389 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/goccy/go-yaml"
+	"github.com/spf13/cobra"
+)
+
+var coverageCmd = &cobra.Command{
+	Use:   "coverage [evaluation-log] [catalog-or-policy]",
+	Short: "Report which requirements an EvaluationLog actually covers",
+	Long: `Compare an EvaluationLog with the ControlCatalog or Policy it targets and
+report, for every assessment requirement, whether it was evaluated:
+
+  Evaluated      an assessment log has a result other than Not Run or
+                 Needs Review (Passed, Failed, Not Applicable, Unknown);
+  Not Run        the only results are Not Run;
+  Needs Review   an assessment is waiting for review;
+  Not Evaluated  no assessment log mentions the requirement.
+
+A Policy is compiled first (see policy compile), so exclusions and
+modifications are honored; a ControlCatalog is flattened. Retired entries
+are not expected to be evaluated. Assessment logs that name requirements or
+controls the target does not define are listed separately.
+
+Counts are rolled up per control group. --fail-under makes the command fail
+when the share of evaluated requirements is lower than the given percent. A
+target or group without requirements is 100% covered.`,
+	Args:          cobra.ExactArgs(2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE:          runCoverage,
+}
+
+var coverageFlags struct {
+	format     string
+	outputPath string
+	failUnder  float64
+	mirrorDir  string
+	cacheDir   string
+	fetch      bool
+}
+
+const (
+	coverageEvaluated    = "Evaluated"
+	coverageNotRun       = "Not Run"
+	coverageNeedsReview  = "Needs Review"
+	coverageNotEvaluated = "Not Evaluated"
+)
+
+func newCoverageCmd() *cobra.Command {
+	coverageCmd.Flags().StringVarP(&coverageFlags.format, "format", "f", "text", "Output format: text or json")
+	coverageCmd.Flags().StringVarP(&coverageFlags.outputPath, "output", "o", "", "Write the report to a file instead of stdout")
+	coverageCmd.Flags().Float64Var(&coverageFlags.failUnder, "fail-under", 0, "Fail when fewer than this percent of requirements were evaluated")
+	coverageCmd.Flags().StringVar(&coverageFlags.mirrorDir, "mirror", "", "Read-only directory mirroring http(s) artifacts as host/path")
+	coverageCmd.Flags().StringVar(&coverageFlags.cacheDir, "cache", "", "Directory where downloaded http(s) artifacts are cached")
+	coverageCmd.Flags().BoolVar(&coverageFlags.fetch, "fetch", false, "Download http(s) artifacts missing from the mirror and cache")
+	return coverageCmd
+}
+
+func runCoverage(cmd *cobra.Command, args []string) error {
+	logFile, targetFile := args[0], args[1]
+	log, err := readDocument(logFile)
+	if err != nil {
+		return err
+	}
+	if typ := mapString(mapMap(log, "metadata"), "type"); typ != "EvaluationLog" {
+		return fmt.Errorf("%s is a %s, expected an EvaluationLog", logFile, typ)
+	}
+
+	resolver := newArtifactResolver(coverageFlags.mirrorDir, coverageFlags.cacheDir, coverageFlags.fetch)
+	catalogs, err := coverageTarget(targetFile, resolver)
+	if err != nil {
+		return err
+	}
+
+	report := computeCoverage(log, catalogs)
+	report.Log, report.Target = logFile, targetFile
+	if err := writeReport(coverageFlags.outputPath, func(w io.Writer) error {
+		return writeCoverage(w, coverageFlags.format, report)
+	}); err != nil {
+		return err
+	}
+	if report.Summary.Coverage < coverageFlags.failUnder {
+		return fmt.Errorf("coverage %.1f%% is below %.1f%%", report.Summary.Coverage, coverageFlags.failUnder)
+	}
+	return nil
+}
+
+// coverageTarget loads the requirements a log is measured against: the
+// compiled policy, or the flattened control catalog, in file.
+func coverageTarget(file string, resolver *artifactResolver) ([]effectiveCatalog, error) {
+	doc, err := readDocument(file)
+	if err != nil {
+		return nil, err
+	}
+	switch typ := mapString(mapMap(doc, "metadata"), "type"); typ {
+	case "Policy":
+		effective, _, err := compilePolicyFile(file, doc, resolver)
+		if err != nil {
+			return nil, err
+		}
+		return effective.Catalogs, nil
+	case "ControlCatalog":
+		flat, _, err := flattenCatalog(file, doc, resolver, filepath.Dir(file))
+		if err != nil {
+			return nil, fmt.Errorf("flatten %s: %w", file, err)
+		}
+		idx := indexEntries(flat.doc)
+		cat := effectiveCatalog{ReferenceID: idx.ID, ID: idx.ID, Title: mapString(flat.doc, "title"), index: idx}
+		for _, m := range listMaps(mapList(flat.doc, "controls")) {
+			cat.Controls = append(cat.Controls, controlFromMap(m))
+		}
+		cat.dropRetired()
+		return []effectiveCatalog{cat}, nil
+	default:
+		return nil, fmt.Errorf("%s is a %s, expected a ControlCatalog or Policy", file, typ)
+	}
+}
+
+// coverageReport is the outcome of comparing an EvaluationLog with its
+// target.
+type coverageReport struct {
+	Log      string            `json:"log"`
+	Target   string            `json:"target"`
+	Summary  coverageCounts    `json:"summary"`
+	Groups   []coverageGroup   `json:"groups"`
+	Controls []coverageControl `json:"controls"`
+	Unknown  []coverageUnknown `json:"unknown,omitempty"`
+}
+
+type coverageCounts struct {
+	Requirements int     `json:"requirements"`
+	Evaluated    int     `json:"evaluated"`
+	NotRun       int     `json:"not-run"`
+	NeedsReview  int     `json:"needs-review"`
+	NotEvaluated int     `json:"not-evaluated"`
+	Coverage     float64 `json:"coverage"`
+}
+
+type coverageGroup struct {
+	Catalog  string `json:"catalog"`
+	Group    string `json:"group"`
+	Controls int    `json:"controls"`
+	coverageCounts
+}
+
+type coverageControl struct {
+	Catalog      string                `json:"catalog"`
+	ID           string                `json:"id"`
+	Group        string                `json:"group,omitempty"`
+	Status       string                `json:"status"`
+	Requirements []coverageRequirement `json:"assessment-requirements"`
+}
+
+type coverageRequirement struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Result string `json:"result,omitempty"`
+}
+
+// coverageUnknown is an assessment log naming something the target does
+// not define.
+type coverageUnknown struct {
+	Path    string `json:"path"`
+	Control string `json:"control,omitempty"`
+	Entry   string `json:"entry"`
+	Result  string `json:"result,omitempty"`
+}
+
+// resultRank orders results by how much they matter when one requirement
+// has several assessment logs, or a control or log aggregates several
+// results; the lowest rank wins.
+var resultRank = map[string]int{
+	"Failed":         0,
+	"Needs Review":   1,
+	"Unknown":        2,
+	"Passed":         3,
+	"Not Applicable": 4,
+	"Not Run":        5,
+}
+
+// computeCoverage matches the assessment logs of log against the
+// requirements of catalogs.
+func computeCoverage(log yaml.MapSlice, catalogs []effectiveCatalog) *coverageReport {
+	report := &coverageReport{Summary: newCoverageCounts()}
+
+	type key struct{ catalog, id string }
+	results := make(map[key]string)
+
+	// find returns the catalog defining a control or requirement id,
+	// preferring the one a log's reference-id names when ids repeat.
+	find := func(refID, id string, requirement bool) (string, bool) {
+		var found []string
+		for _, cat := range catalogs {
+			for _, ctl := range cat.Controls {
+				if (!requirement && ctl.ID == id) || (requirement && ctl.requirement(id) >= 0) {
+					if refID == cat.ReferenceID || refID == cat.ID {
+						return cat.ReferenceID, true
+					}
+					found = append(found, cat.ReferenceID)
+				}
+			}
+		}
+		if len(found) == 0 {
+			return "", false
+		}
+		return found[0], true
+	}
+
+	for i, eval := range listMaps(mapList(log, "evaluations")) {
+		control := mapMap(eval, "control")
+		refID := mapString(control, "reference-id")
+		path := []string{"evaluations", strconv.Itoa(i)}
+		if _, ok := find(refID, mapString(control, "entry-id"), false); !ok {
+			report.Unknown = append(report.Unknown, coverageUnknown{
+				Path:   formatPath(appendPath(path, "control", "entry-id")),
+				Entry:  mapString(control, "entry-id"),
+				Result: mapString(eval, "result"),
+			})
+		}
+		for j, assessment := range listMaps(mapList(eval, "assessment-logs")) {
+			req := mapMap(assessment, "requirement")
+			id, result := mapString(req, "entry-id"), mapString(assessment, "result")
+			reqRef := mapString(req, "reference-id")
+			if reqRef == "" {
+				reqRef = refID
+			}
+			catalog, ok := find(reqRef, id, true)
+			if !ok {
+				report.Unknown = append(report.Unknown, coverageUnknown{
+					Path:    formatPath(appendPath(path, "assessment-logs", strconv.Itoa(j), "requirement", "entry-id")),
+					Control: mapString(control, "entry-id"),
+					Entry:   id,
+					Result:  result,
+				})
+				continue
+			}
+			k := key{catalog, id}
+			if prev, seen := results[k]; !seen || resultRank[result] < resultRank[prev] {
+				results[k] = result
+			}
+		}
+	}
+
+	groups := make(map[key]*coverageGroup)
+	var order []key
+	for _, cat := range catalogs {
+		for _, ctl := range cat.Controls {
+			gk := key{cat.ReferenceID, ctl.Group}
+			g, ok := groups[gk]
+			if !ok {
+				g = &coverageGroup{Catalog: cat.ReferenceID, Group: ctl.Group, coverageCounts: newCoverageCounts()}
+				groups[gk] = g
+				order = append(order, gk)
+			}
+			g.Controls++
+
+			cc := coverageControl{Catalog: cat.ReferenceID, ID: ctl.ID, Group: ctl.Group}
+			evaluated := 0
+			for _, ar := range ctl.Requirements {
+				result, seen := results[key{cat.ReferenceID, ar.ID}]
+				status := coverageStatus(result, seen)
+				cc.Requirements = append(cc.Requirements, coverageRequirement{ID: ar.ID, Status: status, Result: result})
+				g.add(status)
+				report.Summary.add(status)
+				if status == coverageEvaluated {
+					evaluated++
+				}
+			}
+			// A control whose requirements were all removed or retired has
+			// nothing to show for it, so it is not counted as evaluated.
+			switch {
+			case evaluated > 0 && evaluated == len(ctl.Requirements):
+				cc.Status = coverageEvaluated
+			case evaluated > 0:
+				cc.Status = "Partial"
+			default:
+				cc.Status = coverageNotEvaluated
+			}
+			report.Controls = append(report.Controls, cc)
+		}
+	}
+	for _, gk := range order {
+		report.Groups = append(report.Groups, *groups[gk])
+	}
+	return report
+}
+
+func coverageStatus(result string, seen bool) string {
+	switch {
+	case !seen:
+		return coverageNotEvaluated
+	case result == "Not Run":
+		return coverageNotRun
+	case result == "Needs Review":
+		return coverageNeedsReview
+	default:
+		return coverageEvaluated
+	}
+}
+
+// newCoverageCounts returns counts with nothing to evaluate, which are fully
+// covered.
+func newCoverageCounts() coverageCounts {
+	return coverageCounts{Coverage: 100}
+}
+
+func (c *coverageCounts) add(status string) {
+	c.Requirements++
+	switch status {
+	case coverageEvaluated:
+		c.Evaluated++
+	case coverageNotRun:
+		c.NotRun++
+	case coverageNeedsReview:
+		c.NeedsReview++
+	default:
+		c.NotEvaluated++
+	}
+	c.Coverage = 100 * float64(c.Evaluated) / float64(c.Requirements)
+}
+
+func writeCoverage(w io.Writer, format string, report *coverageReport) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case "text", "":
+		return writeCoverageText(w, report)
+	default:
+		return fmt.Errorf("unsupported format %q (expected text or json)", format)
+	}
+}
+
+func writeCoverageText(w io.Writer, report *coverageReport) error {
+	s := report.Summary
+	fmt.Fprintf(w, "%s covers %d of %d assessment requirement(s) of %s (%.1f%%)\n\n",
+		report.Log, s.Evaluated, s.Requirements, report.Target, s.Coverage)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CATALOG\tGROUP\tCONTROLS\tREQUIREMENTS\tEVALUATED\tNOT RUN\tNEEDS REVIEW\tNOT EVALUATED\tCOVERAGE")
+	for _, g := range report.Groups {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%.1f%%\n",
+			g.Catalog, g.Group, g.Controls, g.Requirements, g.Evaluated, g.NotRun, g.NeedsReview, g.NotEvaluated, g.Coverage)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, status := range []string{coverageNotEvaluated, coverageNotRun, coverageNeedsReview} {
+		var lines []string
+		for _, ctl := range report.Controls {
+			for _, ar := range ctl.Requirements {
+				if ar.Status == status {
+					lines = append(lines, fmt.Sprintf("  %s (%s %s)", ar.ID, ctl.Catalog, ctl.ID))
+				}
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n%s:\n", status)
+		for _, line := range lines {
+			fmt.Fprintln(w, line)
+		}
+	}
+
+	if len(report.Unknown) > 0 {
+		fmt.Fprintf(w, "\nNot in %s:\n", report.Target)
+		for _, u := range report.Unknown {
+			fmt.Fprintf(w, "  %s: %s", u.Path, u.Entry)
+			if u.Result != "" {
+				fmt.Fprintf(w, " (%s)", u.Result)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+	return nil
+}
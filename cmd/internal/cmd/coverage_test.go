@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import "testing"
+
+func TestComputeCoverage(t *testing.T) {
+	log, err := readDocument("testdata/coverage-evaluation-log.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalogs, err := coverageTarget("testdata/release-control-catalog.yaml", newArtifactResolver("", "", false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := computeCoverage(log, catalogs)
+
+	want := map[string]string{
+		"LV-01.AR01": coverageEvaluated,
+		"LV-01.AR02": coverageNeedsReview,
+		"LV-02.AR01": coverageNotEvaluated,
+		"LV-03.AR01": coverageNotRun,
+	}
+	for _, ctl := range report.Controls {
+		for _, ar := range ctl.Requirements {
+			if ar.Status != want[ar.ID] {
+				t.Errorf("%s: status %q, want %q", ar.ID, ar.Status, want[ar.ID])
+			}
+			delete(want, ar.ID)
+		}
+	}
+	for id := range want {
+		t.Errorf("missing requirement %s", id)
+	}
+
+	s := report.Summary
+	if s.Requirements != 4 || s.Evaluated != 1 || s.NotRun != 1 || s.NeedsReview != 1 || s.NotEvaluated != 1 || s.Coverage != 25 {
+		t.Errorf("unexpected summary: %+v", s)
+	}
+	if len(report.Groups) != 2 || report.Groups[0].Group != "access" || report.Groups[0].Coverage != 50 {
+		t.Errorf("unexpected groups: %+v", report.Groups)
+	}
+	if len(report.Unknown) != 1 || report.Unknown[0].Entry != "LV-01.AR09" {
+		t.Errorf("unexpected unknown entries: %+v", report.Unknown)
+	}
+}
+
+func TestComputeCoverageEmptyControl(t *testing.T) {
+	catalogs := []effectiveCatalog{{
+		ReferenceID: "EMPTY",
+		ID:          "EMPTY",
+		Controls:    []effectiveControl{{ID: "EM-01", Group: "access"}},
+	}}
+	report := computeCoverage(nil, catalogs)
+	if len(report.Controls) != 1 || report.Controls[0].Status != coverageNotEvaluated {
+		t.Errorf("control without requirements: %+v", report.Controls)
+	}
+	if report.Summary.Requirements != 0 || report.Summary.Coverage != 100 || report.Groups[0].Coverage != 100 {
+		t.Errorf("a target without requirements should be fully covered: %+v %+v", report.Summary, report.Groups)
+	}
+}
@@ -0,0 +1,861 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/errors"
+	"cuelang.org/go/cue/token"
+)
+
+// Diagnostic is a single machine-readable validation problem tied to a
+// location in the artifact that caused it.
+type Diagnostic struct {
+	File       string `json:"file"`
+	Line       int    `json:"line,omitempty"`
+	Column     int    `json:"column,omitempty"`
+	Path       string `json:"path,omitempty"`
+	Rule       string `json:"rule"`
+	Severity   string `json:"severity"`
+	Message    string `json:"message"`
+	Constraint string `json:"constraint,omitempty"`
+	Schema     string `json:"schema,omitempty"`
+	Value      string `json:"value,omitempty"`
+
+	// Related points at other locations involved in the problem, such as
+	// the other side of a conflict.
+	Related []RelatedLocation `json:"related,omitempty"`
+}
+
+// RelatedLocation is a location, possibly in another file, that a
+// Diagnostic refers to.
+type RelatedLocation struct {
+	File    string `json:"file"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// String renders the location as file:line:column: path: message.
+func (r RelatedLocation) String() string {
+	s := r.File
+	if r.Line > 0 {
+		s = fmt.Sprintf("%s:%d:%d", r.File, r.Line, r.Column)
+	}
+	if r.Path != "" {
+		s += ": " + r.Path
+	}
+	if r.Message != "" {
+		s += ": " + r.Message
+	}
+	return s
+}
+
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+
+	ruleSchema         = "schema"
+	ruleDeclaredSchema = "declared-schema"
+	ruleSyntax         = "syntax"
+	ruleVersion        = "version"
+	ruleReference      = "reference"
+	ruleWorkspace      = "workspace"
+
+	ruleLifecycleReplacement = "lifecycle-replacement"
+	ruleLifecycleChain       = "lifecycle-chain"
+	ruleLifecycleReference   = "lifecycle-reference"
+	ruleLifecycleDraft       = "lifecycle-draft"
+	rulePolicy               = "policy"
+	ruleResultAggregate      = "result-aggregate"
+	ruleResultSteps          = "result-steps"
+	ruleResultTiming         = "result-timing"
+	ruleEnforcementFinding   = "enforcement-finding"
+	ruleEnforcementMethod    = "enforcement-method"
+	ruleEnforcementException = "enforcement-exception"
+	ruleEvidenceFreshness    = "evidence-freshness"
+	rulePlanFrequency        = "plan-frequency"
+	ruleParameter            = "parameter"
+	rulePolicyConflict       = "policy-conflict"
+
+	againstCurrent  = "current"
+	againstDeclared = "declared"
+)
+
+// ValidationResult groups the diagnostics produced for one artifact.
+type ValidationResult struct {
+	File       string `json:"file"`
+	Definition string `json:"definition,omitempty"`
+	// Against is "current" or "declared" when the artifact was validated
+	// against more than one schema version.
+	Against       string       `json:"against,omitempty"`
+	SchemaVersion string       `json:"schema-version,omitempty"`
+	Valid         bool         `json:"valid"`
+	Diagnostics   []Diagnostic `json:"diagnostics,omitempty"`
+}
+
+// cueDiagnostics converts a CUE error into diagnostics for file. src maps
+// errors back to artifact positions; it is nil when the artifact could not be
+// parsed.
+func cueDiagnostics(err error, file string, src *artifactSource, rule string) []Diagnostic {
+	if err == nil {
+		return nil
+	}
+	var data cue.Value
+	var index *positionIndex
+	if src != nil {
+		data, index = src.Value, src.Positions
+	}
+
+	type group struct {
+		path      []string
+		errs      []errors.Error
+		dataPos   token.Pos
+		collapsed bool
+	}
+	var order []string
+	groups := make(map[string]*group)
+
+	for _, e := range errors.Errors(err) {
+		path := trimDefinition(e.Path())
+		var dataPos token.Pos
+		for _, p := range errors.Positions(e) {
+			if sameFile(p.Filename(), file) {
+				dataPos = p
+				break
+			}
+		}
+		if indexed, ok := index.pathAt(dataPos); ok {
+			path = indexed
+		}
+		// Report a missing parent once rather than once per required child,
+		// e.g. results instead of results[0].id, results[0].title, ...
+		// Only incomplete values are missing fields: other errors, such as
+		// the conflicts of the hidden uniqueness checks, keep their path.
+		collapsed := false
+		if data.Exists() && isIncomplete(e) {
+			for n := 1; n < len(path); n++ {
+				if strings.HasPrefix(path[n-1], "_") {
+					break
+				}
+				if _, found := lookupDataPath(data, path[:n]); !found {
+					path, collapsed = path[:n], true
+					break
+				}
+			}
+		}
+
+		key := formatPath(path)
+		g, ok := groups[key]
+		if !ok {
+			g = &group{path: path}
+			groups[key] = g
+			order = append(order, key)
+		}
+		if !g.dataPos.IsValid() {
+			g.dataPos = dataPos
+		}
+		g.collapsed = g.collapsed || collapsed
+		g.errs = append(g.errs, e)
+	}
+
+	var diags []Diagnostic
+	for _, key := range order {
+		g := groups[key]
+		d := Diagnostic{
+			File:     file,
+			Path:     key,
+			Rule:     rule,
+			Severity: severityError,
+		}
+
+		value, found := lookupDataPath(data, g.path)
+		if found {
+			d.Value = formatScalar(value)
+		}
+		if g.collapsed {
+			d.Message = "missing required field"
+		} else {
+			d.Message = groupMessage(g.errs, found)
+		}
+
+		pos := g.dataPos
+		if !pos.IsValid() {
+			pos = index.nearest(g.path)
+		}
+		if pos.IsValid() {
+			d.Line = pos.Line()
+			d.Column = pos.Column()
+		}
+
+		if sp := constraintPosition(g.errs, file); sp.IsValid() {
+			d.Schema = fmt.Sprintf("%s:%d:%d", filepath.Base(sp.Filename()), sp.Line(), sp.Column())
+			d.Constraint = sourceLine(sp)
+		}
+		diags = append(diags, d)
+	}
+	return diags
+}
+
+// isIncomplete reports whether e is CUE's error for a field without a
+// concrete value, which is how a required field absent from the data shows.
+func isIncomplete(e errors.Error) bool {
+	format, args := e.Msg()
+	return strings.HasPrefix(fmt.Sprintf(format, args...), "incomplete value ")
+}
+
+// groupMessage merges the messages of errors reported at the same path.
+// Disjunction failures arrive as a summary followed by one error per
+// rejected alternative.
+func groupMessage(errs []errors.Error, found bool) string {
+	var msgs []string
+	for _, e := range errs {
+		format, args := e.Msg()
+		msg := fmt.Sprintf(format, args...)
+		if msg == "" {
+			msg = e.Error()
+		}
+		if !containsString(msgs, msg) {
+			msgs = append(msgs, msg)
+		}
+	}
+
+	if !found {
+		incomplete := true
+		for _, m := range msgs {
+			if !strings.HasPrefix(m, "incomplete value ") {
+				incomplete = false
+			}
+		}
+		if incomplete && len(msgs) == 1 {
+			return "missing required field (expected " + strings.TrimPrefix(msgs[0], "incomplete value ") + ")"
+		}
+		if incomplete {
+			return "missing required field"
+		}
+	}
+
+	if len(msgs) == 1 {
+		if m := listContainsMsg.FindStringSubmatch(msgs[0]); m != nil {
+			return fmt.Sprintf("%s is not a declared id (declared: %s)", m[2], m[1])
+		}
+	}
+	if len(msgs) > 1 && strings.HasSuffix(msgs[0], ":") {
+		return msgs[0] + " " + strings.Join(msgs[1:], "; ")
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// listContainsMsg matches the error produced by the group and applicability
+// id checks, which unify the declared ids with list.Contains(value).
+var listContainsMsg = regexp.MustCompile(`^invalid value (\[.*\]) \(does not satisfy list\.Contains\((.*)\)\)$`)
+
+// constraintPosition picks the schema position shared by every error in a
+// group, preferring the innermost one, so disjunction failures point at the
+// field declaration rather than each rejected alternative.
+func constraintPosition(errs []errors.Error, file string) token.Pos {
+	var common []token.Pos
+	first := true
+	for _, e := range errs {
+		var schemaPos []token.Pos
+		for _, p := range errors.Positions(e) {
+			if p.IsValid() && !sameFile(p.Filename(), file) {
+				schemaPos = append(schemaPos, p)
+			}
+		}
+		if len(schemaPos) == 0 {
+			continue
+		}
+		if first {
+			common, first = schemaPos, false
+			continue
+		}
+		var kept []token.Pos
+		for _, p := range common {
+			for _, q := range schemaPos {
+				if posKey(p) == posKey(q) {
+					kept = append(kept, p)
+					break
+				}
+			}
+		}
+		common = kept
+	}
+	if len(common) == 0 {
+		return token.NoPos
+	}
+	return common[len(common)-1]
+}
+
+// positionIndex maps artifact source positions to field paths and back.
+type positionIndex struct {
+	byPos  map[string][]string
+	byPath map[string]token.Pos
+}
+
+func indexPositions(node ast.Node) *positionIndex {
+	ix := &positionIndex{
+		byPos:  make(map[string][]string),
+		byPath: make(map[string]token.Pos),
+	}
+	ix.walk(node, nil)
+	return ix
+}
+
+func (ix *positionIndex) record(p token.Pos, path []string) {
+	if !p.IsValid() || p.Line() == 0 {
+		return
+	}
+	if _, ok := ix.byPos[posKey(p)]; !ok {
+		ix.byPos[posKey(p)] = path
+	}
+	if _, ok := ix.byPath[formatPath(path)]; !ok {
+		ix.byPath[formatPath(path)] = p
+	}
+}
+
+func (ix *positionIndex) walk(node ast.Node, path []string) {
+	switch n := node.(type) {
+	case *ast.File:
+		ix.record(n.Pos(), path)
+		ix.walkDecls(n.Decls, path)
+	case *ast.StructLit:
+		p := n.Pos()
+		if p.Line() == 0 {
+			// Structs in YAML sequences have no position of their own.
+			for _, elt := range n.Elts {
+				if f, ok := elt.(*ast.Field); ok && f.Label.Pos().Line() > 0 {
+					p = f.Label.Pos()
+					break
+				}
+			}
+		}
+		ix.record(p, path)
+		ix.walkDecls(n.Elts, path)
+	case *ast.ListLit:
+		ix.record(n.Pos(), path)
+		for i, elt := range n.Elts {
+			ix.walk(elt, appendPath(path, strconv.Itoa(i)))
+		}
+	default:
+		ix.record(node.Pos(), path)
+	}
+}
+
+func (ix *positionIndex) walkDecls(decls []ast.Decl, path []string) {
+	for _, decl := range decls {
+		field, ok := decl.(*ast.Field)
+		if !ok {
+			continue
+		}
+		name, _, err := ast.LabelName(field.Label)
+		if err != nil {
+			continue
+		}
+		child := appendPath(path, name)
+		// The key position comes first so that nearest() lands on the key
+		// line, while errors that point at the value still resolve.
+		ix.record(field.Label.Pos(), child)
+		ix.walk(field.Value, child)
+	}
+}
+
+func (ix *positionIndex) pathAt(p token.Pos) ([]string, bool) {
+	if ix == nil || !p.IsValid() {
+		return nil, false
+	}
+	path, ok := ix.byPos[posKey(p)]
+	return path, ok
+}
+
+// nearest returns the position of the deepest existing ancestor of path in
+// the artifact, e.g. the parent struct of a missing field.
+func (ix *positionIndex) nearest(path []string) token.Pos {
+	if ix == nil {
+		return token.NoPos
+	}
+	for n := len(path); n >= 0; n-- {
+		if p, ok := ix.byPath[formatPath(path[:n])]; ok {
+			return p
+		}
+	}
+	return token.NoPos
+}
+
+// diagnosticAt builds a diagnostic for path in file, positioned on the
+// nearest node of src that exists; src may be nil when the file could not
+// be loaded.
+func diagnosticAt(file string, src *artifactSource, rule, severity string, path []string, value, msg string) Diagnostic {
+	d := Diagnostic{File: file, Path: formatPath(path), Rule: rule, Severity: severity, Message: msg, Value: value}
+	d.Line, d.Column = src.position(path)
+	return d
+}
+
+// position returns the line and column of the nearest node of path, or
+// zeros when src is nil or has no such node.
+func (src *artifactSource) position(path []string) (line, column int) {
+	if src == nil {
+		return 0, 0
+	}
+	if p := src.Positions.nearest(path); p.IsValid() {
+		return p.Line(), p.Column()
+	}
+	return 0, 0
+}
+
+func appendPath(path []string, elems ...string) []string {
+	out := make([]string, len(path), len(path)+len(elems))
+	copy(out, path)
+	return append(out, elems...)
+}
+
+// trimDefinition drops the leading #Definition selector CUE adds to paths
+// when validating data unified with a definition.
+func trimDefinition(path []string) []string {
+	if len(path) > 0 && strings.HasPrefix(path[0], "#") {
+		path = path[1:]
+	}
+	out := make([]string, len(path))
+	for i, p := range path {
+		if uq, err := strconv.Unquote(p); err == nil {
+			p = uq
+		}
+		out[i] = p
+	}
+	return out
+}
+
+// formatPath renders a path in CUE-like syntax, e.g. controls[3].group or
+// metadata."gemara-version".
+func formatPath(path []string) string {
+	var b strings.Builder
+	for _, p := range path {
+		switch {
+		case isIndex(p):
+			b.WriteString("[" + p + "]")
+		case isIdentifier(p):
+			if b.Len() > 0 {
+				b.WriteByte('.')
+			}
+			b.WriteString(p)
+		default:
+			if b.Len() > 0 {
+				b.WriteByte('.')
+			}
+			b.WriteString(strconv.Quote(p))
+		}
+	}
+	return b.String()
+}
+
+func isIndex(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_' || r == '#' || r == '$':
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case i > 0 && r >= '0' && r <= '9':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func pathSelectors(path []string) ([]cue.Selector, bool) {
+	sels := make([]cue.Selector, 0, len(path))
+	for _, p := range path {
+		switch {
+		case isIndex(p):
+			n, _ := strconv.Atoi(p)
+			sels = append(sels, cue.Index(n))
+		case strings.HasPrefix(p, "_") || strings.HasPrefix(p, "#"):
+			return nil, false
+		default:
+			sels = append(sels, cue.Str(p))
+		}
+	}
+	return sels, true
+}
+
+func lookupDataPath(data cue.Value, path []string) (cue.Value, bool) {
+	if !data.Exists() {
+		return cue.Value{}, false
+	}
+	sels, ok := pathSelectors(path)
+	if !ok {
+		return cue.Value{}, false
+	}
+	v := data.LookupPath(cue.MakePath(sels...))
+	return v, v.Exists()
+}
+
+func formatScalar(v cue.Value) string {
+	switch v.Kind() {
+	case cue.StringKind:
+		s, _ := v.String()
+		return s
+	case cue.IntKind, cue.FloatKind, cue.NumberKind, cue.BoolKind, cue.NullKind:
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+func posKey(p token.Pos) string {
+	return fmt.Sprintf("%s:%d:%d", p.Filename(), p.Line(), p.Column())
+}
+
+func sameFile(a, b string) bool {
+	if a == b {
+		return true
+	}
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+var sourceCache = map[string][]string{}
+
+func sourceLine(p token.Pos) string {
+	lines, ok := sourceCache[p.Filename()]
+	if !ok {
+		data, err := os.ReadFile(p.Filename())
+		if err == nil {
+			lines = strings.Split(string(data), "\n")
+		}
+		sourceCache[p.Filename()] = lines
+	}
+	if p.Line() < 1 || p.Line() > len(lines) {
+		return ""
+	}
+	return strings.TrimSpace(lines[p.Line()-1])
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// sortDiagnostics orders diagnostics by file and source position.
+func sortDiagnostics(diags []Diagnostic) {
+	sort.SliceStable(diags, func(i, j int) bool {
+		if diags[i].File != diags[j].File {
+			return diags[i].File < diags[j].File
+		}
+		if diags[i].Line != diags[j].Line {
+			return diags[i].Line < diags[j].Line
+		}
+		return diags[i].Column < diags[j].Column
+	})
+}
+
+func allDiagnostics(results []ValidationResult) []Diagnostic {
+	var diags []Diagnostic
+	for _, r := range results {
+		diags = append(diags, r.Diagnostics...)
+	}
+	return diags
+}
+
+// writeDiagnostics renders validation results in one of the supported
+// formats: text, json, sarif, or github.
+func writeDiagnostics(w io.Writer, format string, results []ValidationResult) error {
+	switch format {
+	case "", "text":
+		return writeTextDiagnostics(w, results)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	case "sarif":
+		return writeSARIF(w, allDiagnostics(results))
+	case "github":
+		return writeGitHubAnnotations(w, allDiagnostics(results))
+	default:
+		return fmt.Errorf("unsupported format %q (expected text, json, sarif, or github)", format)
+	}
+}
+
+func writeTextDiagnostics(w io.Writer, results []ValidationResult) error {
+	for _, r := range results {
+		against := r.Definition
+		if r.Against != "" {
+			against = strings.TrimSpace(fmt.Sprintf("%s (%s schema %s)", r.Definition, r.Against, r.SchemaVersion))
+		}
+		if r.Valid && len(r.Diagnostics) == 0 {
+			fmt.Fprintf(w, "%s: valid against %s\n", r.File, against)
+			continue
+		}
+		if r.Against != "" {
+			fmt.Fprintf(w, "%s: %d problem(s) against %s\n", r.File, len(r.Diagnostics), against)
+		}
+		for _, d := range r.Diagnostics {
+			loc := d.File
+			if d.Line > 0 {
+				loc = fmt.Sprintf("%s:%d:%d", d.File, d.Line, d.Column)
+			}
+			fmt.Fprintf(w, "%s: %s", loc, d.Severity)
+			if d.Path != "" {
+				fmt.Fprintf(w, ": %s", d.Path)
+			}
+			fmt.Fprintf(w, ": %s", d.Message)
+			if d.Value != "" {
+				fmt.Fprintf(w, " (value: %q)", d.Value)
+			}
+			fmt.Fprintln(w)
+			if d.Constraint != "" {
+				fmt.Fprintf(w, "    constraint: %s (%s)\n", d.Constraint, d.Schema)
+			}
+			for _, r := range d.Related {
+				fmt.Fprintf(w, "    related: %s\n", r)
+			}
+		}
+	}
+	return nil
+}
+
+// GitHub workflow commands require %, CR, and LF escaped in messages, and
+// additionally : and , escaped in property values.
+func escapeGitHubData(s string) string {
+	s = strings.ReplaceAll(s, "%", "%25")
+	s = strings.ReplaceAll(s, "\r", "%0D")
+	return strings.ReplaceAll(s, "\n", "%0A")
+}
+
+func escapeGitHubProperty(s string) string {
+	s = escapeGitHubData(s)
+	s = strings.ReplaceAll(s, ":", "%3A")
+	return strings.ReplaceAll(s, ",", "%2C")
+}
+
+func writeGitHubAnnotations(w io.Writer, diags []Diagnostic) error {
+	for _, d := range diags {
+		props := []string{"file=" + escapeGitHubProperty(filepath.ToSlash(d.File))}
+		if d.Line > 0 {
+			props = append(props, fmt.Sprintf("line=%d", d.Line), fmt.Sprintf("col=%d", d.Column))
+		}
+		title := "Gemara " + d.Rule
+		if d.Path != "" {
+			title += " " + d.Path
+		}
+		props = append(props, "title="+escapeGitHubProperty(title))
+
+		level := d.Severity
+		if level != severityWarning {
+			level = severityError
+		}
+		msg := d.Message
+		if d.Constraint != "" {
+			msg += "\nconstraint: " + d.Constraint
+		}
+		for _, r := range d.Related {
+			msg += "\nrelated: " + r.String()
+		}
+		if _, err := fmt.Fprintf(w, "::%s %s::%s\n", level, strings.Join(props, ","), escapeGitHubData(msg)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID           string            `json:"ruleId"`
+	Level            string            `json:"level"`
+	Message          sarifMessage      `json:"message"`
+	Locations        []sarifLocation   `json:"locations"`
+	RelatedLocations []sarifLocation   `json:"relatedLocations,omitempty"`
+	Properties       map[string]string `json:"properties,omitempty"`
+}
+
+type sarifLocation struct {
+	ID               *int                   `json:"id,omitempty"`
+	PhysicalLocation sarifPhysicalLocation  `json:"physicalLocation"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+	Message          *sarifMessage          `json:"message,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+}
+
+func newSARIFLocation(file string, line, column int, path string) sarifLocation {
+	loc := sarifLocation{PhysicalLocation: sarifPhysicalLocation{
+		ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(file)},
+	}}
+	if line > 0 {
+		loc.PhysicalLocation.Region = &sarifRegion{StartLine: line, StartColumn: column}
+	}
+	if path != "" {
+		loc.LogicalLocations = []sarifLogicalLocation{{FullyQualifiedName: path}}
+	}
+	return loc
+}
+
+// ruleDescriptions documents the rule ids emitted in diagnostics.
+var ruleDescriptions = map[string]string{
+	ruleSchema:         "Artifact does not satisfy its Gemara schema definition",
+	ruleDeclaredSchema: "Artifact does not satisfy the schema version it declares",
+	ruleSyntax:         "Artifact could not be parsed",
+	ruleVersion:        "Declared gemara-version could not be resolved",
+	ruleReference:      "Mapping or entry reference does not resolve",
+	ruleWorkspace:      "Workspace manifest or artifact set is inconsistent",
+
+	ruleLifecycleReplacement: "Deprecated or Retired entry has no resolvable replaced-by",
+	ruleLifecycleChain:       "Replaced-by chain cycles or ends at a Retired entry",
+	ruleLifecycleReference:   "Active control references a Retired threat or guideline",
+	ruleLifecycleDraft:       "Draft entry appears in an artifact that is not a draft",
+	rulePolicy:               "Policy import, exclusion, modification, or constraint does not apply",
+	ruleResultAggregate:      "Control or log result differs from the aggregate of the results it summarizes",
+	ruleResultSteps:          "Assessment executed more steps than it lists",
+	ruleResultTiming:         "Assessment ends before it starts",
+	ruleEnforcementFinding:   "Enforcement finding is not supported by the EvaluationLog it cites",
+	ruleEnforcementMethod:    "Enforcement method is not a Gate or Remediation method of the Policy",
+	ruleEnforcementException: "Enforcement exception does not resolve or is missing",
+	ruleEvidenceFreshness:    "Latest evaluation or evidence is older than the assessment plan frequency",
+	rulePlanFrequency:        "Assessment plan frequency is not an interval that can be read",
+	ruleParameter:            "Parameter value is not accepted, missing, or bound to no declared parameter",
+	rulePolicyConflict:       "Stacked policies exclude, modify, constrain, or treat risks in contradictory ways",
+}
+
+func writeSARIF(w io.Writer, diags []Diagnostic) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "gemara-docs",
+			InformationURI: "https://gemara.openssf.org",
+		}},
+		Results: []sarifResult{},
+	}
+
+	seenRules := make(map[string]bool)
+	for _, d := range diags {
+		if !seenRules[d.Rule] {
+			seenRules[d.Rule] = true
+			desc := ruleDescriptions[d.Rule]
+			if desc == "" {
+				desc = d.Rule
+			}
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: d.Rule, ShortDescription: sarifMessage{Text: desc}})
+		}
+
+		loc := newSARIFLocation(d.File, d.Line, d.Column, d.Path)
+		var related []sarifLocation
+		for i, r := range d.Related {
+			rl := newSARIFLocation(r.File, r.Line, r.Column, r.Path)
+			id := i + 1
+			rl.ID = &id
+			if r.Message != "" {
+				rl.Message = &sarifMessage{Text: r.Message}
+			}
+			related = append(related, rl)
+		}
+
+		level := d.Severity
+		if level != severityWarning {
+			level = severityError
+		}
+		props := map[string]string{}
+		if d.Constraint != "" {
+			props["constraint"] = d.Constraint
+			props["schema"] = d.Schema
+		}
+		if d.Value != "" {
+			props["value"] = d.Value
+		}
+		if len(props) == 0 {
+			props = nil
+		}
+		run.Results = append(run.Results, sarifResult{
+			RuleID:           d.Rule,
+			Level:            level,
+			Message:          sarifMessage{Text: d.Message},
+			Locations:        []sarifLocation{loc},
+			RelatedLocations: related,
+			Properties:       props,
+		})
+	}
+	if run.Tool.Driver.Rules == nil {
+		run.Tool.Driver.Rules = []sarifRule{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	})
+}
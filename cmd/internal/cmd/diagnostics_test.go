@@ -0,0 +1,196 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"cuelang.org/go/cue/cuecontext"
+)
+
+const invalidCatalog = "testdata/invalid-control-catalog.yaml"
+
+// invalidCatalogResult validates the fixture whose controls[3].group names an
+// undeclared group.
+func invalidCatalogResult(t *testing.T) ValidationResult {
+	t.Helper()
+	ctx := cuecontext.New()
+	schema, err := loadSchema(ctx, "../../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := loadArtifactSource(ctx, invalidCatalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return validateSource(schema, src, "", ruleSchema)
+}
+
+func TestValidateSourceDiagnostic(t *testing.T) {
+	result := invalidCatalogResult(t)
+	if result.Valid || result.Definition != "#ControlCatalog" || len(result.Diagnostics) != 1 {
+		t.Fatalf("result = %+v, want one problem against #ControlCatalog", result)
+	}
+	d := result.Diagnostics[0]
+	want := Diagnostic{
+		File:     invalidCatalog,
+		Line:     31,
+		Column:   12,
+		Path:     "controls[3].group",
+		Rule:     ruleSchema,
+		Severity: severityError,
+		Value:    "crypto",
+		Schema:   "controlcatalog.cue:28:30",
+	}
+	if d.File != want.File || d.Line != want.Line || d.Column != want.Column || d.Path != want.Path ||
+		d.Rule != want.Rule || d.Severity != want.Severity || d.Value != want.Value || d.Schema != want.Schema {
+		t.Errorf("diagnostic = %+v, want %+v", d, want)
+	}
+	if !strings.Contains(d.Message, `"crypto" is not a declared id`) {
+		t.Errorf("message = %q", d.Message)
+	}
+	if !strings.Contains(d.Constraint, "list.Contains(c.group)") {
+		t.Errorf("constraint = %q", d.Constraint)
+	}
+}
+
+func TestValidateSourceMissingField(t *testing.T) {
+	ctx := cuecontext.New()
+	schema, err := loadSchema(ctx, "../../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for file, want := range map[string]string{
+		"bad-mapping-no-target.yaml":           "mappings[0].targets: missing required field",
+		"bad-lexicon-duplicate-term-id.yaml":   `_uniqueTermIds."same-id": conflicting values 1 and 0`,
+		"bad-risk-catalog-duplicate-rank.yaml": "_uniqueRiskRanks[1]: conflicting values 1 and 0",
+	} {
+		src, err := loadArtifactSource(ctx, "../../../test/test-data/"+file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := validateSource(schema, src, "", ruleSchema)
+		if len(result.Diagnostics) != 1 {
+			t.Errorf("%s: diagnostics = %+v, want one", file, result.Diagnostics)
+			continue
+		}
+		if d := result.Diagnostics[0]; d.Path+": "+d.Message != want {
+			t.Errorf("%s: %s: %s, want %s", file, d.Path, d.Message, want)
+		}
+	}
+}
+
+func TestWriteDiagnosticsFormats(t *testing.T) {
+	results := []ValidationResult{invalidCatalogResult(t)}
+
+	tests := []struct {
+		format string
+		check  func(t *testing.T, out string)
+	}{
+		{"text", func(t *testing.T, out string) {
+			want := invalidCatalog + `:31:12: error: controls[3].group: "crypto" is not a declared id (declared: ["access"]) (value: "crypto")` + "\n" +
+				"    constraint: "
+			if !strings.HasPrefix(out, want) || !strings.Contains(out, "(controlcatalog.cue:28:30)\n") {
+				t.Errorf("text output:\n%s", out)
+			}
+		}},
+		{"json", func(t *testing.T, out string) {
+			var got []ValidationResult
+			if err := json.Unmarshal([]byte(out), &got); err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 || len(got[0].Diagnostics) != 1 {
+				t.Fatalf("json output: %s", out)
+			}
+			d := got[0].Diagnostics[0]
+			if d.File != invalidCatalog || d.Line != 31 || d.Column != 12 || d.Path != "controls[3].group" ||
+				d.Value != "crypto" || d.Schema != "controlcatalog.cue:28:30" || d.Constraint == "" {
+				t.Errorf("json diagnostic = %+v", d)
+			}
+		}},
+		{"sarif", func(t *testing.T, out string) {
+			var log sarifLog
+			if err := json.Unmarshal([]byte(out), &log); err != nil {
+				t.Fatal(err)
+			}
+			if log.Version != "2.1.0" || !strings.Contains(log.Schema, "sarif-2.1.0") || len(log.Runs) != 1 {
+				t.Fatalf("sarif envelope: %s", out)
+			}
+			run := log.Runs[0]
+			if len(run.Tool.Driver.Rules) != 1 || run.Tool.Driver.Rules[0].ID != ruleSchema || run.Tool.Driver.Rules[0].ShortDescription.Text == "" {
+				t.Errorf("sarif rules = %+v", run.Tool.Driver.Rules)
+			}
+			if len(run.Results) != 1 {
+				t.Fatalf("sarif results: %s", out)
+			}
+			r := run.Results[0]
+			loc := r.Locations[0]
+			if r.RuleID != ruleSchema || r.Level != "error" || loc.PhysicalLocation.ArtifactLocation.URI != invalidCatalog ||
+				loc.PhysicalLocation.Region == nil || loc.PhysicalLocation.Region.StartLine != 31 || loc.PhysicalLocation.Region.StartColumn != 12 ||
+				len(loc.LogicalLocations) != 1 || loc.LogicalLocations[0].FullyQualifiedName != "controls[3].group" {
+				t.Errorf("sarif result = %+v", r)
+			}
+			if r.Properties["value"] != "crypto" || r.Properties["schema"] != "controlcatalog.cue:28:30" || r.Properties["constraint"] == "" {
+				t.Errorf("sarif properties = %+v", r.Properties)
+			}
+		}},
+		{"github", func(t *testing.T, out string) {
+			want := "::error file=" + invalidCatalog + ",line=31,col=12,title=Gemara schema controls[3].group::" +
+				`"crypto" is not a declared id (declared: ["access"])%0Aconstraint: `
+			if !strings.HasPrefix(out, want) {
+				t.Errorf("github output:\n%s\nwant prefix:\n%s", out, want)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeDiagnostics(&buf, tt.format, results); err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, buf.String())
+		})
+	}
+
+	if err := writeDiagnostics(&bytes.Buffer{}, "xml", results); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+}
+
+func TestGitHubAnnotationEscaping(t *testing.T) {
+	var buf bytes.Buffer
+	d := Diagnostic{File: "a,b:c.yaml", Path: "x", Rule: ruleSchema, Severity: severityWarning, Message: "100% wrong\r\nnext"}
+	if err := writeGitHubAnnotations(&buf, []Diagnostic{d}); err != nil {
+		t.Fatal(err)
+	}
+	want := "::warning file=a%2Cb%3Ac.yaml,title=Gemara schema x::100%25 wrong%0D%0Anext\n"
+	if buf.String() != want {
+		t.Errorf("got  %q\nwant %q", buf.String(), want)
+	}
+}
+
+func TestDiagnosticAt(t *testing.T) {
+	src, err := loadArtifactSource(cuecontext.New(), invalidCatalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		path         []string
+		line, column int
+	}{
+		{[]string{"controls", "3", "group"}, 31, 5},
+		// A missing field is placed on its nearest existing ancestor.
+		{[]string{"controls", "3", "missing"}, 28, 5},
+	} {
+		d := diagnosticAt(invalidCatalog, src, ruleSchema, severityError, tc.path, "v", "msg")
+		if d.Line != tc.line || d.Column != tc.column || d.Path != formatPath(tc.path) || d.File != invalidCatalog {
+			t.Errorf("diagnosticAt(%v) = %+v, want %d:%d", tc.path, d, tc.line, tc.column)
+		}
+	}
+	if d := diagnosticAt(invalidCatalog, nil, ruleSchema, severityError, []string{"controls"}, "", "msg"); d.Line != 0 || d.Column != 0 {
+		t.Errorf("without a source: %+v", d)
+	}
+}
@@ -0,0 +1,393 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/goccy/go-yaml"
+	"github.com/spf13/cobra"
+)
+
+var dispositionCmd = &cobra.Command{
+	Use:   "disposition [evaluation-log] [policy]",
+	Short: "Derive an EnforcementLog from an EvaluationLog and the Policy it was run for",
+	Long: `Decide what to do about each control evaluation of an EvaluationLog under
+a Policy, and write the decisions as an EnforcementLog:
+
+  Enforced      the control Failed and the policy requires it;
+  Tolerated     the control Failed, but it mitigates a threat of a risk the
+                policy accepts for the target; the acceptance is cited as
+                an exception;
+  Clear         the control Passed; only its Passed assessments are cited,
+                as the EnforcementLog schema requires;
+  Undetermined  the control Needs Review, is Unknown or Not Run, or is not
+                one the compiled policy requires.
+
+Controls whose assessments were all Not Applicable need no action and are
+left out. Each action cites the assessment logs it is based on and the
+enforcement method given by --method (default: the policy's first required
+enforcement method, else its first one). The log's disposition is the most
+significant of its actions: Enforced, then Undetermined, Tolerated, Clear.
+
+Accepted risks are scoped against --resource, as by policy applicability,
+or else against the log's target. The EnforcementLog is validated before it
+is written.`,
+	Args:          cobra.ExactArgs(2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE:          runDisposition,
+}
+
+var dispositionFlags struct {
+	schemaDir    string
+	resourcePath string
+	method       string
+	steps        []string
+	id           string
+	at           string
+	format       string
+	outputPath   string
+	mirrorDir    string
+	cacheDir     string
+	fetch        bool
+}
+
+const (
+	dispositionEnforced     = "Enforced"
+	dispositionTolerated    = "Tolerated"
+	dispositionClear        = "Clear"
+	dispositionUndetermined = "Undetermined"
+)
+
+// dispositionRank orders dispositions by significance; the lowest rank
+// wins when they are aggregated.
+var dispositionRank = map[string]int{
+	dispositionEnforced:     0,
+	dispositionUndetermined: 1,
+	dispositionTolerated:    2,
+	dispositionClear:        3,
+}
+
+func newDispositionCmd() *cobra.Command {
+	dispositionCmd.Flags().StringVarP(&dispositionFlags.schemaDir, "schema", "s", "..", "Path to the CUE package directory")
+	dispositionCmd.Flags().StringVarP(&dispositionFlags.resourcePath, "resource", "r", "", "Resource description that accepted risks are scoped against (default: the log's target)")
+	dispositionCmd.Flags().StringVar(&dispositionFlags.method, "method", "", "Id of the policy enforcement method the actions use")
+	dispositionCmd.Flags().StringSliceVar(&dispositionFlags.steps, "step", nil, "Steps that carry out the actions (default: the method id)")
+	dispositionCmd.Flags().StringVar(&dispositionFlags.id, "id", "", "metadata.id of the EnforcementLog (default: <log id>-enforcement)")
+	dispositionCmd.Flags().StringVar(&dispositionFlags.at, "time", "", "Start time of the actions, RFC 3339 (default: now)")
+	dispositionCmd.Flags().StringVarP(&dispositionFlags.format, "format", "f", "", "Output format: yaml or json (default: from the output or log extension)")
+	dispositionCmd.Flags().StringVarP(&dispositionFlags.outputPath, "output", "o", "", "Output path for the EnforcementLog (default: stdout)")
+	dispositionCmd.Flags().StringVar(&dispositionFlags.mirrorDir, "mirror", "", "Read-only directory mirroring http(s) artifacts as host/path")
+	dispositionCmd.Flags().StringVar(&dispositionFlags.cacheDir, "cache", "", "Directory where downloaded http(s) artifacts are cached")
+	dispositionCmd.Flags().BoolVar(&dispositionFlags.fetch, "fetch", false, "Download http(s) artifacts missing from the mirror and cache")
+	return dispositionCmd
+}
+
+func runDisposition(cmd *cobra.Command, args []string) error {
+	logFile, policyFile := args[0], args[1]
+	at := time.Now().UTC().Truncate(time.Second)
+	if dispositionFlags.at != "" {
+		t, err := time.Parse(time.RFC3339, dispositionFlags.at)
+		if err != nil {
+			return fmt.Errorf("invalid --time: %w", err)
+		}
+		at = t
+	}
+
+	log, err := readDocument(logFile)
+	if err != nil {
+		return err
+	}
+	if typ := mapString(mapMap(log, "metadata"), "type"); typ != "EvaluationLog" {
+		return fmt.Errorf("%s is a %s, expected an EvaluationLog", logFile, typ)
+	}
+	policy, err := readDocument(policyFile)
+	if err != nil {
+		return err
+	}
+	if typ := mapString(mapMap(policy, "metadata"), "type"); typ != "Policy" {
+		return fmt.Errorf("%s is a %s, expected a Policy", policyFile, typ)
+	}
+	resourcePath := dispositionFlags.resourcePath
+	if resourcePath == "" {
+		resourcePath = logFile
+	}
+	res, err := loadResourceProfile(resourcePath)
+	if err != nil {
+		return err
+	}
+
+	src, err := loadArtifactSource(cuecontext.New(), policyFile)
+	if err != nil {
+		src = nil
+	}
+	resolver := newArtifactResolver(dispositionFlags.mirrorDir, dispositionFlags.cacheDir, dispositionFlags.fetch)
+	e := &dispositionEngine{
+		logFile:    logFile,
+		log:        log,
+		policyFile: policyFile,
+		policy:     policy,
+		resource:   res,
+		resolver:   resolver,
+		method:     dispositionFlags.method,
+		steps:      dispositionFlags.steps,
+		id:         dispositionFlags.id,
+		at:         at,
+		outDir:     outputDir(dispositionFlags.outputPath),
+	}
+	doc, diags, err := e.run(src)
+	if len(diags) > 0 {
+		if werr := writeTextDiagnostics(os.Stderr, []ValidationResult{{File: policyFile, Diagnostics: diags}}); werr != nil {
+			return werr
+		}
+	}
+	for _, note := range e.notes {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", logFile, note)
+	}
+	if err != nil {
+		return err
+	}
+
+	out := dispositionFlags.outputPath
+	format := outputFormat(dispositionFlags.format, out, logFile)
+	data, err := encodeDocument(doc, format)
+	if err != nil {
+		return err
+	}
+	stdout := strings.TrimSuffix(logFile, filepath.Ext(logFile)) + ".enforcement." + format
+	if err := writeGenerated(dispositionFlags.schemaDir, "", out, stdout, data); err != nil {
+		return fmt.Errorf("enforcement log: %w", err)
+	}
+	return nil
+}
+
+// dispositionEngine derives an EnforcementLog from an EvaluationLog and a
+// Policy.
+type dispositionEngine struct {
+	logFile    string
+	log        yaml.MapSlice
+	policyFile string
+	policy     yaml.MapSlice
+	resource   *resourceProfile
+	resolver   *artifactResolver
+	method     string
+	steps      []string
+	id         string
+	at         time.Time
+	// outDir is where the EnforcementLog is written; file:// urls it
+	// references are relative to it.
+	outDir string
+
+	notes []string
+}
+
+// run compiles the policy and decides a disposition for every control
+// evaluation of the log.
+func (e *dispositionEngine) run(src *artifactSource) (yaml.MapSlice, []Diagnostic, error) {
+	policyID := mapString(mapMap(e.policy, "metadata"), "id")
+	logID := mapString(mapMap(e.log, "metadata"), "id")
+
+	if ok, reasons := e.resource.inScope(mapMap(e.policy, "scope")); !ok {
+		return nil, nil, fmt.Errorf("%s does not apply to %s: %s", policyID, e.resource.ID, strings.Join(reasons, "; "))
+	}
+	effective, diags := compilePolicy(e.policyFile, e.policy, src, e.resolver)
+	if hasErrors(diags) {
+		return nil, diags, fmt.Errorf("%s does not compile", e.policyFile)
+	}
+	method, err := e.enforcementMethod()
+	if err != nil {
+		return nil, diags, err
+	}
+	steps := e.steps
+	if len(steps) == 0 {
+		steps = []string{method}
+	}
+	accepted, reasons := acceptedThreats(e.policyFile, e.policy, e.resource, e.resolver)
+	e.notes = append(e.notes, reasons...)
+	acceptances := make(map[string]yaml.MapSlice)
+	for _, acc := range listMaps(mapList(mapMap(e.policy, "risks"), "accepted")) {
+		acceptances[mapString(acc, "id")] = acc
+	}
+
+	var actions []interface{}
+	disposition := dispositionClear
+	for _, eval := range listMaps(mapList(e.log, "evaluations")) {
+		control := mapMap(eval, "control")
+		refID, controlID := mapString(control, "reference-id"), mapString(control, "entry-id")
+		var assessments []yaml.MapSlice
+		var results []string
+		for _, a := range listMaps(mapList(eval, "assessment-logs")) {
+			if r := mapString(a, "result"); r != "Not Applicable" {
+				assessments = append(assessments, a)
+				results = append(results, r)
+			}
+		}
+		if len(assessments) == 0 {
+			e.notes = append(e.notes, fmt.Sprintf("%s: every assessment is Not Applicable; no action", controlID))
+			continue
+		}
+		result := aggregateResult(results)
+
+		var exception yaml.MapSlice
+		d, message := dispositionUndetermined, fmt.Sprintf("%s is %s.", controlID, result)
+		cat, ctl := findEffectiveControl(effective.Catalogs, refID, controlID)
+		switch {
+		case ctl == nil:
+			message = fmt.Sprintf("%s is not required by %s.", controlID, policyID)
+			e.notes = append(e.notes, fmt.Sprintf("%s: not required by %s; Undetermined", controlID, policyID))
+		case result == "Failed":
+			d, message = dispositionEnforced, fmt.Sprintf("%s Failed; enforced with %s.", controlID, method)
+			for _, t := range ctl.threats {
+				if id, ok := accepted[threatKey(e.resolver, cat.index, t)]; ok {
+					d, message = dispositionTolerated, fmt.Sprintf("%s Failed; tolerated under accepted risk %s.", controlID, id)
+					exception = yaml.MapSlice{{Key: "reference-id", Value: policyID}}
+					remarks := "Accepted risk " + id
+					if j := mapString(acceptances[id], "justification"); j != "" {
+						remarks += ": " + j
+					}
+					exception = append(exception, yaml.MapItem{Key: "remarks", Value: remarks})
+					break
+				}
+			}
+		case result == "Passed":
+			d, message = dispositionClear, fmt.Sprintf("%s Passed.", controlID)
+		}
+
+		var findings []interface{}
+		for _, a := range assessments {
+			r := mapString(a, "result")
+			if (d == dispositionClear && r != "Passed") || ((d == dispositionEnforced || d == dispositionTolerated) && r != "Failed") {
+				continue
+			}
+			findings = append(findings, assessmentFinding(a, refID, logID))
+		}
+		justification := yaml.MapSlice{{Key: "assessments", Value: findings}}
+		if exception != nil {
+			justification = append(justification, yaml.MapItem{Key: "exceptions", Value: []interface{}{exception}})
+		}
+
+		var stepList []interface{}
+		for _, s := range steps {
+			stepList = append(stepList, s)
+		}
+		actions = append(actions, yaml.MapSlice{
+			{Key: "disposition", Value: d},
+			{Key: "method", Value: yaml.MapSlice{{Key: "reference-id", Value: policyID}, {Key: "entry-id", Value: method}}},
+			{Key: "message", Value: message},
+			{Key: "start", Value: e.at.Format(time.RFC3339)},
+			{Key: "steps", Value: stepList},
+			{Key: "justification", Value: justification},
+		})
+		if dispositionRank[d] < dispositionRank[disposition] {
+			disposition = d
+		}
+	}
+	if len(actions) == 0 {
+		return nil, diags, fmt.Errorf("%s has no control evaluation that needs an action", e.logFile)
+	}
+
+	return yaml.MapSlice{
+		{Key: "metadata", Value: e.metadata(policyID, logID)},
+		{Key: "target", Value: mapMap(e.log, "target")},
+		{Key: "disposition", Value: disposition},
+		{Key: "actions", Value: actions},
+	}, diags, nil
+}
+
+// enforcementMethod returns the id of the enforcement method actions
+// reference: the one named by the engine, or the policy's first required
+// method, or its first method.
+func (e *dispositionEngine) enforcementMethod() (string, error) {
+	methods := listMaps(mapList(mapMap(e.policy, "adherence"), "enforcement-methods"))
+	if len(methods) == 0 {
+		return "", fmt.Errorf("%s declares no adherence.enforcement-methods", e.policyFile)
+	}
+	if e.method != "" {
+		for _, m := range methods {
+			if mapString(m, "id") == e.method {
+				return e.method, nil
+			}
+		}
+		return "", fmt.Errorf("%s has no enforcement method %q", e.policyFile, e.method)
+	}
+	for _, m := range methods {
+		if required, _ := mapGet(m, "required"); required == true {
+			return mapString(m, "id"), nil
+		}
+	}
+	return mapString(methods[0], "id"), nil
+}
+
+// metadata describes the EnforcementLog, referencing the policy, the
+// evaluation log, and what the log references.
+func (e *dispositionEngine) metadata(policyID, logID string) yaml.MapSlice {
+	logMeta := mapMap(e.log, "metadata")
+	id := e.id
+	if id == "" {
+		id = logID + "-enforcement"
+	}
+	meta := yaml.MapSlice{
+		{Key: "id", Value: id},
+		{Key: "type", Value: "EnforcementLog"},
+		{Key: "gemara-version", Value: mapString(logMeta, "gemara-version")},
+		{Key: "date", Value: e.at.Format(time.RFC3339)},
+		{Key: "description", Value: fmt.Sprintf("Dispositions of %s under %s.", logID, policyID)},
+		{Key: "author", Value: yaml.MapSlice{
+			{Key: "id", Value: "gemara-docs"},
+			{Key: "name", Value: "gemara-docs disposition"},
+			{Key: "type", Value: "Software"},
+		}},
+	}
+	var notes []string
+	for _, ref := range listMaps(mapList(logMeta, "mapping-references")) {
+		meta = mergeByID(&notes, meta, "mapping-references", rebaseReference(ref, filepath.Dir(e.logFile), e.outDir), e.logFile)
+	}
+	meta = mergeByID(&notes, meta, "mapping-references", artifactReference(e.policyFile, e.policy, e.outDir), e.policyFile)
+	meta = mergeByID(&notes, meta, "mapping-references", artifactReference(e.logFile, e.log, e.outDir), e.logFile)
+	e.notes = append(e.notes, notes...)
+	return meta
+}
+
+// assessmentFinding cites an assessment log of the EvaluationLog logID.
+func assessmentFinding(a yaml.MapSlice, controlRef, logID string) yaml.MapSlice {
+	req := mapMap(a, "requirement")
+	refID := mapString(req, "reference-id")
+	if refID == "" {
+		refID = controlRef
+	}
+	finding := yaml.MapSlice{
+		{Key: "result", Value: mapString(a, "result")},
+		{Key: "requirement", Value: yaml.MapSlice{{Key: "reference-id", Value: refID}, {Key: "entry-id", Value: mapString(req, "entry-id")}}},
+	}
+	if plan := mapMap(a, "plan"); plan != nil {
+		finding = append(finding, yaml.MapItem{Key: "plan", Value: plan})
+	}
+	return append(finding, yaml.MapItem{Key: "log", Value: yaml.MapSlice{{Key: "reference-id", Value: logID}, {Key: "entry-id", Value: mapString(req, "entry-id")}}})
+}
+
+// findEffectiveControl returns the compiled control id, preferring the
+// catalog that refID names when several define it.
+func findEffectiveControl(catalogs []effectiveCatalog, refID, id string) (*effectiveCatalog, *effectiveControl) {
+	var cat *effectiveCatalog
+	var ctl *effectiveControl
+	for i := range catalogs {
+		for j := range catalogs[i].Controls {
+			if catalogs[i].Controls[j].ID != id {
+				continue
+			}
+			if refID == catalogs[i].ReferenceID || refID == catalogs[i].ID {
+				return &catalogs[i], &catalogs[i].Controls[j]
+			}
+			if ctl == nil {
+				cat, ctl = &catalogs[i], &catalogs[i].Controls[j]
+			}
+		}
+	}
+	return cat, ctl
+}
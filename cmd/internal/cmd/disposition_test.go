@@ -0,0 +1,101 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDispositionEngine(t *testing.T) {
+	logFile, policyFile := "testdata/disposition-evaluation-log.yaml", "testdata/disposition-policy.yaml"
+	log, err := readDocument(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := readDocument(policyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := loadResourceProfile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &dispositionEngine{
+		logFile:    logFile,
+		log:        log,
+		policyFile: policyFile,
+		policy:     policy,
+		resource:   res,
+		resolver:   newArtifactResolver("", "", false),
+		at:         time.Date(2026, 1, 6, 0, 0, 0, 0, time.UTC),
+		outDir:     "testdata/out",
+	}
+
+	doc, diags, err := e.run(nil)
+	if err != nil {
+		t.Fatalf("run: %v (%+v)", err, diags)
+	}
+
+	if got := mapString(doc, "disposition"); got != dispositionEnforced {
+		t.Errorf("log disposition %q, want %q", got, dispositionEnforced)
+	}
+	want := []string{dispositionTolerated, dispositionEnforced, dispositionClear, dispositionUndetermined, dispositionUndetermined}
+	actions := listMaps(mapList(doc, "actions"))
+	if len(actions) != len(want) {
+		t.Fatalf("got %d actions, want %d", len(actions), len(want))
+	}
+	for i, a := range actions {
+		if got := mapString(a, "disposition"); got != want[i] {
+			t.Errorf("action %d: disposition %q, want %q", i, got, want[i])
+		}
+		if got := mapString(mapMap(a, "method"), "entry-id"); got != "block-deploy" {
+			t.Errorf("action %d: method %q, want the required block-deploy", i, got)
+		}
+		for _, f := range listMaps(mapList(mapMap(a, "justification"), "assessments")) {
+			if want[i] == dispositionClear && mapString(f, "result") != "Passed" {
+				t.Errorf("Clear action %d cites a %s assessment", i, mapString(f, "result"))
+			}
+		}
+	}
+	if exceptions := mapList(mapMap(actions[0], "justification"), "exceptions"); len(exceptions) != 1 {
+		t.Errorf("Tolerated action has %d exceptions, want 1", len(exceptions))
+	}
+	if enforced := mapList(mapMap(actions[1], "justification"), "assessments"); len(enforced) != 1 {
+		t.Errorf("Enforced action cites %d assessments, want only the Failed one", len(enforced))
+	}
+
+	// References are rewritten to resolve from the output directory.
+	meta := mapMap(doc, "metadata")
+	for id, want := range map[string]string{
+		"LEVELS":             "file://../release-control-catalog.yaml",
+		"DISPOSITION-POLICY": "file://../disposition-policy.yaml",
+	} {
+		if got := mapString(findEntry(meta, "mapping-references", id), "url"); got != want {
+			t.Errorf("mapping reference %s url %q, want %q", id, got, want)
+		}
+	}
+
+	data, err := encodeDocument(doc, "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validateGenerated("../../..", "", "enforcement.yaml", data); err != nil {
+		t.Errorf("EnforcementLog does not validate: %v", err)
+	}
+}
+
+func TestDispositionMethod(t *testing.T) {
+	policy, err := readDocument("testdata/disposition-policy.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &dispositionEngine{policyFile: "policy.yaml", policy: policy, method: "notify-owner"}
+	if got, err := e.enforcementMethod(); err != nil || got != "notify-owner" {
+		t.Errorf("enforcementMethod() = %q, %v; want notify-owner", got, err)
+	}
+	e.method = "missing"
+	if _, err := e.enforcementMethod(); err == nil {
+		t.Error("expected an error for an undeclared method")
+	}
+}
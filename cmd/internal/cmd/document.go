@@ -0,0 +1,246 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// Documents are decoded into yaml.MapSlice rather than Go structs so that
+// rewriting commands (migrate, normalize, ...) keep unknown fields and the
+// author's key order intact.
+
+// decodeDocument parses YAML or JSON into ordered maps.
+func decodeDocument(data []byte) (interface{}, error) {
+	var doc interface{}
+	if err := yaml.UnmarshalWithOptions(data, &doc, yaml.UseOrderedMap()); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// readDocument reads an artifact whose top level must be a mapping.
+func readDocument(path string) (yaml.MapSlice, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	doc, err := decodeDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	m, ok := doc.(yaml.MapSlice)
+	if !ok {
+		return nil, fmt.Errorf("parse %s: top level is not a mapping", path)
+	}
+	return m, nil
+}
+
+// documentFormat returns "json" for .json paths and "yaml" otherwise.
+func documentFormat(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return "json"
+	}
+	return "yaml"
+}
+
+// outputDir is the directory a generated artifact written to out lives
+// in; stdout counts as the working directory.
+func outputDir(out string) string {
+	if out == "" || out == "-" {
+		return "."
+	}
+	return filepath.Dir(out)
+}
+
+// encodeDocument renders a document as YAML or indented JSON.
+func encodeDocument(doc interface{}, format string) ([]byte, error) {
+	switch format {
+	case "json":
+		var buf bytes.Buffer
+		if err := writeOrderedJSON(&buf, doc); err != nil {
+			return nil, err
+		}
+		var out bytes.Buffer
+		if err := json.Indent(&out, buf.Bytes(), "", "  "); err != nil {
+			return nil, err
+		}
+		out.WriteByte('\n')
+		return out.Bytes(), nil
+	case "yaml", "":
+		return yaml.MarshalWithOptions(doc, yaml.Indent(2), yaml.IndentSequence(true), yaml.UseLiteralStyleIfMultiline(true))
+	default:
+		return nil, fmt.Errorf("unsupported format %q (expected yaml or json)", format)
+	}
+}
+
+// writeDocument encodes doc in the format implied by path and writes it;
+// an empty path or "-" writes YAML to stdout.
+func writeDocument(path string, doc interface{}) error {
+	format := "yaml"
+	if path != "" && path != "-" {
+		format = documentFormat(path)
+	}
+	data, err := encodeDocument(doc, format)
+	if err != nil {
+		return err
+	}
+	if path == "" || path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// outputFormat is the format of a generated artifact: format when set,
+// else the one implied by the output path, else that of the input the
+// artifact is generated from.
+func outputFormat(format, out, input string) string {
+	if format != "" {
+		return format
+	}
+	if out != "" && out != "-" {
+		return documentFormat(out)
+	}
+	return documentFormat(input)
+}
+
+// writeGenerated validates a generated artifact against the schema and
+// writes it to out; an empty out or "-" writes to stdout, and name stands
+// in for the file in diagnostics. Nothing is written when validation fails.
+func writeGenerated(schemaDir, definition, out, name string, data []byte) error {
+	if out != "" && out != "-" {
+		name = out
+	}
+	if err := validateGenerated(schemaDir, definition, name, data); err != nil {
+		return err
+	}
+	if out == "" || out == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(out, data, 0644); err != nil {
+		return fmt.Errorf("write %s: %w", out, err)
+	}
+	return nil
+}
+
+// writeOrderedJSON writes doc as compact JSON, keeping MapSlice key order.
+func writeOrderedJSON(buf *bytes.Buffer, doc interface{}) error {
+	switch v := doc.(type) {
+	case yaml.MapSlice:
+		buf.WriteByte('{')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, err := json.Marshal(fmt.Sprint(item.Key))
+			if err != nil {
+				return err
+			}
+			buf.Write(key)
+			buf.WriteByte(':')
+			if err := writeOrderedJSON(buf, item.Value); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, elem := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeOrderedJSON(buf, elem); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+	}
+	return nil
+}
+
+func mapIndex(m yaml.MapSlice, key string) int {
+	for i, item := range m {
+		if k, ok := item.Key.(string); ok && k == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func mapGet(m yaml.MapSlice, key string) (interface{}, bool) {
+	if i := mapIndex(m, key); i >= 0 {
+		return m[i].Value, true
+	}
+	return nil, false
+}
+
+func mapString(m yaml.MapSlice, key string) string {
+	v, _ := mapGet(m, key)
+	s, _ := v.(string)
+	return s
+}
+
+func mapMap(m yaml.MapSlice, key string) yaml.MapSlice {
+	v, _ := mapGet(m, key)
+	mm, _ := v.(yaml.MapSlice)
+	return mm
+}
+
+func mapList(m yaml.MapSlice, key string) []interface{} {
+	v, _ := mapGet(m, key)
+	l, _ := v.([]interface{})
+	return l
+}
+
+// mapSet replaces the value of key in place, or appends it.
+func mapSet(m yaml.MapSlice, key string, value interface{}) yaml.MapSlice {
+	if i := mapIndex(m, key); i >= 0 {
+		m[i].Value = value
+		return m
+	}
+	return append(m, yaml.MapItem{Key: key, Value: value})
+}
+
+func mapDelete(m yaml.MapSlice, key string) yaml.MapSlice {
+	if i := mapIndex(m, key); i >= 0 {
+		return append(m[:i:i], m[i+1:]...)
+	}
+	return m
+}
+
+// mapRename renames key in place, keeping its position. It reports false
+// when key is absent or newKey already exists.
+func mapRename(m yaml.MapSlice, key, newKey string) bool {
+	i := mapIndex(m, key)
+	if i < 0 || mapIndex(m, newKey) >= 0 {
+		return false
+	}
+	m[i].Key = newKey
+	return true
+}
+
+// listMaps returns the mapping elements of a list, skipping anything else.
+func listMaps(l []interface{}) []yaml.MapSlice {
+	out := make([]yaml.MapSlice, 0, len(l))
+	for _, elem := range l {
+		if m, ok := elem.(yaml.MapSlice); ok {
+			out = append(out, m)
+		}
+	}
+	return out
+}
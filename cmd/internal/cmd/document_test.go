@@ -0,0 +1,49 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOutputFormat(t *testing.T) {
+	for _, tc := range []struct{ format, out, input, want string }{
+		{"json", "out.yaml", "in.yaml", "json"},
+		{"", "out.json", "in.yaml", "json"},
+		{"", "-", "in.json", "json"},
+		{"", "", "in.yaml", "yaml"},
+		{"", "", "", "yaml"},
+	} {
+		if got := outputFormat(tc.format, tc.out, tc.input); got != tc.want {
+			t.Errorf("outputFormat(%q, %q, %q) = %q, want %q", tc.format, tc.out, tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestWriteGenerated(t *testing.T) {
+	valid, err := os.ReadFile("testdata/release-control-catalog.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+
+	out := filepath.Join(dir, "catalog.yaml")
+	if err := writeGenerated("../../..", "", out, "unused.yaml", valid); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(out); string(got) != string(valid) {
+		t.Error("valid artifact was not written")
+	}
+
+	invalid := filepath.Join(dir, "invalid.yaml")
+	broken := strings.Replace(string(valid), "title: Levels Test Controls\n", "", 1)
+	if err := writeGenerated("../../..", "", invalid, "unused.yaml", []byte(broken)); err == nil {
+		t.Error("expected a validation error")
+	}
+	if _, err := os.Stat(invalid); !os.IsNotExist(err) {
+		t.Errorf("invalid artifact was written: %v", err)
+	}
+}
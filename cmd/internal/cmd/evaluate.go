@@ -0,0 +1,642 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/spf13/cobra"
+)
+
+var evaluateCmd = &cobra.Command{
+	Use:   "evaluate [policy-or-catalog] [runner-config]",
+	Short: "Run local assessment steps and write an EvaluationLog",
+	Long: `Evaluate a target by running the assessment steps a runner configuration
+maps to the assessment requirements of a Policy or ControlCatalog, and write
+the outcome as an EvaluationLog. A Policy is compiled first (see policy
+compile); a ControlCatalog is flattened.
+
+The configuration names the target and the steps of each requirement:
+
+  target:                  # the #Resource being evaluated
+    id: example-repo
+    name: Example Repository
+    type: Software
+  evaluator: {...}         # optional #Actor; metadata.author of the log
+  timeout: 5m              # optional default step timeout
+  parameters:              # values of the assessment plan parameters
+    branch: main
+  requirements:
+    LV-01.AR01:
+      plan: mfa-review     # optional; default: the plan with an Automated method
+      steps:
+        - name: check-mfa
+          exec: [bin/check-mfa, --strict]    # an executable and its arguments
+        - name: check-sso
+          script: scripts/check-sso.sh       # a script run with sh
+        - name: check-factors
+          plugin: plugins/factors.so         # a Go plugin
+          symbol: Assess                     # default: Assess
+          timeout: 30s
+
+Paths are relative to the configuration, which is also the working
+directory of the steps. Executables and scripts get the environment
+variables GEMARA_TARGET_ID, GEMARA_CONTROL_ID, GEMARA_REQUIREMENT_ID,
+GEMARA_STEP, and GEMARA_PARAM_<ID> for each parameter (upper case, with
+characters other than letters and digits replaced by _). Their exit status
+is the result: 0 Passed, 1 Failed, 2 Needs Review, 3 Not Applicable, and
+anything else Unknown. A step may instead print a JSON object with result
+and message; otherwise its last line of output is the message. A Go plugin
+exports
+
+  func Assess(env map[string]string) (result, message string, err error)
+
+and is given the same variables. Plugins need a build with cgo on Linux,
+macOS, or FreeBSD.
+
+Steps run in order; the first step that Fails, or that cannot be run,
+halts the assessment. Its result combines those of the steps run, the
+worst winning (see results), and its message is that of the first step
+with that result. When the
+source is a Policy, requirements whose assessment plans have only Manual
+methods are skipped, and every parameter of the plan needs a value among
+its accepted-values. The log is validated before it is written.
+
+--values adds parameter-values files (see policy compile), selected by the
+target's id and environment, over the configured parameters. Parameter
+values replace {{param}} placeholders in requirement text and
+recommendations, and each assessment's plan mapping records the values its
+steps were given in remarks.`,
+	Args:          cobra.ExactArgs(2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE:          runEvaluate,
+}
+
+var evaluateFlags struct {
+	schemaDir  string
+	values     []string
+	id         string
+	format     string
+	outputPath string
+	mirrorDir  string
+	cacheDir   string
+	fetch      bool
+}
+
+func newEvaluateCmd() *cobra.Command {
+	evaluateCmd.Flags().StringVarP(&evaluateFlags.schemaDir, "schema", "s", "..", "Path to the CUE package directory")
+	evaluateCmd.Flags().StringSliceVar(&evaluateFlags.values, "values", nil, "Parameter-values files for the target (repeatable; see policy compile)")
+	evaluateCmd.Flags().StringVar(&evaluateFlags.id, "id", "", "metadata.id of the EvaluationLog (default: <target id>-<source id>-evaluation)")
+	evaluateCmd.Flags().StringVarP(&evaluateFlags.format, "format", "f", "", "Output format: yaml or json (default: from the output or configuration extension)")
+	evaluateCmd.Flags().StringVarP(&evaluateFlags.outputPath, "output", "o", "", "Output path for the EvaluationLog (default: stdout)")
+	evaluateCmd.Flags().StringVar(&evaluateFlags.mirrorDir, "mirror", "", "Read-only directory mirroring http(s) artifacts as host/path")
+	evaluateCmd.Flags().StringVar(&evaluateFlags.cacheDir, "cache", "", "Directory where downloaded http(s) artifacts are cached")
+	evaluateCmd.Flags().BoolVar(&evaluateFlags.fetch, "fetch", false, "Download http(s) artifacts missing from the mirror and cache")
+	return evaluateCmd
+}
+
+func runEvaluate(cmd *cobra.Command, args []string) error {
+	sourceFile, configFile := args[0], args[1]
+	config, err := loadRunnerConfig(configFile)
+	if err != nil {
+		return err
+	}
+	if len(evaluateFlags.values) > 0 {
+		values, err := bindValues(evaluateFlags.values, mapString(config.Target, "id"), mapString(config.Target, "environment"))
+		if err != nil {
+			return err
+		}
+		if config.Parameters == nil {
+			config.Parameters = make(map[string]string)
+		}
+		for id, v := range values {
+			config.Parameters[id] = v
+		}
+	}
+	source, err := readDocument(sourceFile)
+	if err != nil {
+		return err
+	}
+	resolver := newArtifactResolver(evaluateFlags.mirrorDir, evaluateFlags.cacheDir, evaluateFlags.fetch)
+	catalogs, err := coverageTarget(sourceFile, resolver)
+	if err != nil {
+		return err
+	}
+
+	r := &assessmentRunner{
+		sourceFile: sourceFile,
+		source:     source,
+		catalogs:   catalogs,
+		config:     config,
+		id:         evaluateFlags.id,
+		now:        time.Now,
+		outDir:     outputDir(evaluateFlags.outputPath),
+	}
+	log, err := r.run(cmd.Context())
+	for _, note := range r.notes {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", configFile, note)
+	}
+	if err != nil {
+		return err
+	}
+
+	out := evaluateFlags.outputPath
+	format := outputFormat(evaluateFlags.format, out, configFile)
+	data, err := encodeDocument(log, format)
+	if err != nil {
+		return err
+	}
+	if err := writeGenerated(evaluateFlags.schemaDir, "", out, "evaluation."+format, data); err != nil {
+		return fmt.Errorf("evaluate: %w", err)
+	}
+	return nil
+}
+
+// runnerConfig maps assessment requirements to the local steps that
+// assess them.
+type runnerConfig struct {
+	Target       yaml.MapSlice                `yaml:"target"`
+	Evaluator    yaml.MapSlice                `yaml:"evaluator"`
+	Timeout      string                       `yaml:"timeout"`
+	Parameters   map[string]string            `yaml:"parameters"`
+	Requirements map[string]runnerRequirement `yaml:"requirements"`
+
+	path    string
+	dir     string
+	timeout time.Duration
+}
+
+type runnerRequirement struct {
+	Plan  string       `yaml:"plan"`
+	Steps []runnerStep `yaml:"steps"`
+}
+
+// runnerStep is one assessment step: exactly one of Exec, Script, and
+// Plugin is set.
+type runnerStep struct {
+	Name    string   `yaml:"name"`
+	Exec    []string `yaml:"exec"`
+	Script  string   `yaml:"script"`
+	Plugin  string   `yaml:"plugin"`
+	Symbol  string   `yaml:"symbol"`
+	Timeout string   `yaml:"timeout"`
+
+	timeout time.Duration
+}
+
+const defaultStepTimeout = 5 * time.Minute
+
+// stepWaitDelay bounds how long a step's output is read after the step
+// exits or times out, so that a background child still holding stdout
+// cannot keep the step running.
+const stepWaitDelay = time.Second
+
+func loadRunnerConfig(path string) (*runnerConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read runner configuration: %w", err)
+	}
+	c := &runnerConfig{}
+	if err := yaml.UnmarshalWithOptions(data, c, yaml.Strict()); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	c.path, c.dir = path, filepath.Dir(path)
+	if mapString(c.Target, "id") == "" {
+		return nil, fmt.Errorf("%s: target.id is required", path)
+	}
+	if len(c.Requirements) == 0 {
+		return nil, fmt.Errorf("%s: requirements is empty", path)
+	}
+	if c.timeout, err = parseTimeout(c.Timeout, defaultStepTimeout); err != nil {
+		return nil, fmt.Errorf("%s: timeout: %w", path, err)
+	}
+	for id, req := range c.Requirements {
+		if len(req.Steps) == 0 {
+			return nil, fmt.Errorf("%s: requirement %s has no steps", path, id)
+		}
+		for i := range req.Steps {
+			s := &req.Steps[i]
+			kinds := 0
+			for _, set := range []bool{len(s.Exec) > 0, s.Script != "", s.Plugin != ""} {
+				if set {
+					kinds++
+				}
+			}
+			if s.Name == "" || kinds != 1 {
+				return nil, fmt.Errorf("%s: step %d of %s needs a name and exactly one of exec, script, or plugin", path, i+1, id)
+			}
+			if s.timeout, err = parseTimeout(s.Timeout, c.timeout); err != nil {
+				return nil, fmt.Errorf("%s: step %s of %s: timeout: %w", path, s.Name, id, err)
+			}
+		}
+	}
+	return c, nil
+}
+
+func parseTimeout(s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err == nil && d <= 0 {
+		err = fmt.Errorf("%s is not positive", s)
+	}
+	return d, err
+}
+
+// local resolves a path of the configuration against its directory. The
+// result is absolute, as steps run in that directory.
+func (c *runnerConfig) local(p string) string {
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(c.dir, filepath.FromSlash(p))
+	}
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+	return p
+}
+
+// assessmentRunner evaluates the requirements of a compiled policy or
+// flattened catalog with the steps of a runner configuration.
+type assessmentRunner struct {
+	sourceFile string
+	source     yaml.MapSlice
+	catalogs   []effectiveCatalog
+	config     *runnerConfig
+	id         string
+	now        func() time.Time
+	// outDir is where the log is written; file:// urls it references are
+	// relative to it.
+	outDir string
+	notes  []string
+}
+
+// stepOutcome is the result of running one step.
+type stepOutcome struct {
+	Result  string
+	Message string
+}
+
+// run executes the configured steps and returns the EvaluationLog.
+func (r *assessmentRunner) run(ctx context.Context) (yaml.MapSlice, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	sourceMeta := mapMap(r.source, "metadata")
+	isPolicy := mapString(sourceMeta, "type") == "Policy"
+	sourceID := mapString(sourceMeta, "id")
+
+	r.notes = append(r.notes, bindCatalogParameters(r.catalogs, r.config.Parameters)...)
+
+	known := make(map[string]bool)
+	var evaluations []interface{}
+	var results []string
+	var refs []string
+	for _, cat := range r.catalogs {
+		for _, ctl := range cat.Controls {
+			for _, ar := range ctl.Requirements {
+				known[ar.ID] = true
+			}
+			var assessments []interface{}
+			var ctlResults, ctlMessages []string
+			for _, ar := range ctl.Requirements {
+				spec, ok := r.config.Requirements[ar.ID]
+				if !ok {
+					continue
+				}
+				var plan yaml.MapSlice
+				if isPolicy {
+					var manual bool
+					var err error
+					if plan, manual, err = r.selectPlan(ar.ID, spec.Plan); err != nil {
+						return nil, err
+					}
+					if manual {
+						r.notes = append(r.notes, fmt.Sprintf("%s is skipped: its assessment plan has no Automated method", ar.ID))
+						continue
+					}
+				}
+				params, err := r.bindParameters(plan)
+				if err != nil {
+					return nil, err
+				}
+				a := r.assess(ctx, cat, ctl, ar, spec, params)
+				if plan != nil {
+					mapping := yaml.MapSlice{
+						{Key: "reference-id", Value: sourceID},
+						{Key: "entry-id", Value: mapString(plan, "id")},
+					}
+					if len(params) > 0 {
+						mapping = append(mapping, yaml.MapItem{Key: "remarks", Value: "Parameters: " + formatParameters(params)})
+					}
+					a = append(a[:1], append(yaml.MapSlice{{Key: "plan", Value: mapping}}, a[1:]...)...)
+				}
+				assessments = append(assessments, a)
+				ctlResults = append(ctlResults, mapString(a, "result"))
+				ctlMessages = append(ctlMessages, mapString(a, "message"))
+			}
+			if len(assessments) == 0 {
+				continue
+			}
+			result := aggregateResult(ctlResults)
+			message := ""
+			for i, res := range ctlResults {
+				if res == result {
+					message = ctlMessages[i]
+					break
+				}
+			}
+			name := ctl.Title
+			if name == "" {
+				name = ctl.ID
+			}
+			evaluations = append(evaluations, yaml.MapSlice{
+				{Key: "name", Value: name},
+				{Key: "result", Value: result},
+				{Key: "message", Value: message},
+				{Key: "control", Value: yaml.MapSlice{{Key: "reference-id", Value: cat.ReferenceID}, {Key: "entry-id", Value: ctl.ID}}},
+				{Key: "assessment-logs", Value: assessments},
+			})
+			results = append(results, result)
+			if !containsString(refs, cat.ReferenceID) {
+				refs = append(refs, cat.ReferenceID)
+			}
+		}
+	}
+
+	var unknown []string
+	for id := range r.config.Requirements {
+		if !known[id] {
+			unknown = append(unknown, id)
+		}
+	}
+	sort.Strings(unknown)
+	for _, id := range unknown {
+		r.notes = append(r.notes, fmt.Sprintf("%s is not an assessment requirement of %s", id, r.sourceFile))
+	}
+	if len(evaluations) == 0 {
+		return nil, fmt.Errorf("no configured requirement of %s was evaluated", r.sourceFile)
+	}
+
+	return yaml.MapSlice{
+		{Key: "metadata", Value: r.metadata(refs, isPolicy)},
+		{Key: "result", Value: aggregateResult(results)},
+		{Key: "target", Value: r.config.Target},
+		{Key: "evaluations", Value: evaluations},
+	}, nil
+}
+
+// selectPlan returns the assessment plan of the source Policy to run for
+// requirement: the named one, or the first with an Automated method. The
+// plan is nil when the requirement has none; manual reports that the plans
+// leave the requirement to Manual methods only.
+func (r *assessmentRunner) selectPlan(requirement, name string) (plan yaml.MapSlice, manual bool, err error) {
+	var plans []yaml.MapSlice
+	for _, p := range listMaps(mapList(mapMap(r.source, "adherence"), "assessment-plans")) {
+		if mapString(p, "requirement-id") == requirement {
+			plans = append(plans, p)
+		}
+	}
+	automated := func(p yaml.MapSlice) bool {
+		for _, m := range listMaps(mapList(p, "evaluation-methods")) {
+			if mapString(m, "mode") == "Automated" {
+				return true
+			}
+		}
+		return false
+	}
+	if name != "" {
+		for _, p := range plans {
+			if mapString(p, "id") == name {
+				return p, !automated(p), nil
+			}
+		}
+		return nil, false, fmt.Errorf("%s has no assessment plan %s for %s", r.sourceFile, name, requirement)
+	}
+	for _, p := range plans {
+		if automated(p) {
+			return p, false, nil
+		}
+	}
+	return nil, len(plans) > 0, nil
+}
+
+// bindParameters returns the values of the parameters plan declares,
+// checked against their accepted-values. Without a plan, every configured
+// value is passed on.
+func (r *assessmentRunner) bindParameters(plan yaml.MapSlice) (map[string]string, error) {
+	params := make(map[string]string)
+	if plan == nil {
+		for id, value := range r.config.Parameters {
+			params[id] = value
+		}
+		return params, nil
+	}
+	for _, p := range listMaps(mapList(plan, "parameters")) {
+		id := mapString(p, "id")
+		value, ok := r.config.Parameters[id]
+		if !ok {
+			return nil, fmt.Errorf("%s: parameter %s (%s) of plan %s has no value", r.config.path, id, mapString(p, "label"), mapString(plan, "id"))
+		}
+		if accepted := stringList(mapList(p, "accepted-values")); len(accepted) > 0 && !containsString(accepted, value) {
+			return nil, fmt.Errorf("%s: plan %s: %q is not an accepted value of parameter %s (expected %s)", r.config.path, mapString(plan, "id"), value, id, strings.Join(accepted, ", "))
+		}
+		params[id] = value
+	}
+	return params, nil
+}
+
+// assess runs the steps of one requirement and returns its assessment log.
+func (r *assessmentRunner) assess(ctx context.Context, cat effectiveCatalog, ctl effectiveControl, ar effectiveRequirement, spec runnerRequirement, params map[string]string) yaml.MapSlice {
+	env := map[string]string{
+		"GEMARA_TARGET_ID":      mapString(r.config.Target, "id"),
+		"GEMARA_CONTROL_ID":     ctl.ID,
+		"GEMARA_REQUIREMENT_ID": ar.ID,
+	}
+	for id, value := range params {
+		env["GEMARA_PARAM_"+parameterEnvName(id)] = value
+	}
+
+	var steps []string
+	for _, s := range spec.Steps {
+		steps = append(steps, s.Name)
+	}
+	start := r.now().UTC()
+	var outcomes []stepOutcome
+	var results []string
+	for _, s := range spec.Steps {
+		env["GEMARA_STEP"] = s.Name
+		out := r.runStep(ctx, s, env)
+		outcomes = append(outcomes, out)
+		results = append(results, out.Result)
+		if out.Result == "Failed" || out.Result == "Unknown" {
+			break
+		}
+	}
+	end := r.now().UTC()
+	executed := len(outcomes)
+
+	// The message is that of the first step whose result decided the
+	// assessment's.
+	result := aggregateResult(results)
+	decisive := executed - 1
+	for i, out := range outcomes {
+		if out.Result == result {
+			decisive = i
+			break
+		}
+	}
+	message := spec.Steps[decisive].Name + ": " + outcomes[decisive].Message
+	if outcomes[decisive].Message == "" {
+		message = spec.Steps[decisive].Name + ": " + outcomes[decisive].Result
+	}
+	description := ar.Text
+	if description == "" {
+		description = ar.ID
+	}
+	a := yaml.MapSlice{
+		{Key: "requirement", Value: yaml.MapSlice{{Key: "reference-id", Value: cat.ReferenceID}, {Key: "entry-id", Value: ar.ID}}},
+		{Key: "description", Value: description},
+		{Key: "result", Value: result},
+		{Key: "message", Value: message},
+		{Key: "applicability", Value: ar.Applicability},
+		{Key: "steps", Value: steps},
+		{Key: "steps-executed", Value: executed},
+		{Key: "start", Value: start.Format(time.RFC3339)},
+		{Key: "end", Value: end.Format(time.RFC3339)},
+	}
+	if result == "Failed" && ar.Recommendation != "" {
+		a = append(a, yaml.MapItem{Key: "recommendation", Value: ar.Recommendation})
+	}
+	return a
+}
+
+// exitResults maps the exit status of an executable step to its result.
+var exitResults = map[int]string{0: "Passed", 1: "Failed", 2: "Needs Review", 3: "Not Applicable"}
+
+// runStep runs one step; a step that cannot be run is Unknown.
+func (r *assessmentRunner) runStep(ctx context.Context, s runnerStep, env map[string]string) stepOutcome {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	if s.Plugin != "" {
+		return runPluginStep(ctx, r.config.local(s.Plugin), s.Symbol, env)
+	}
+
+	var cmd *exec.Cmd
+	if s.Script != "" {
+		script := r.config.local(s.Script)
+		if _, err := os.Stat(script); err != nil {
+			return stepOutcome{Result: "Unknown", Message: err.Error()}
+		}
+		cmd = exec.CommandContext(ctx, "sh", script)
+	} else {
+		name := s.Exec[0]
+		if strings.ContainsRune(name, '/') || strings.ContainsRune(name, filepath.Separator) {
+			name = r.config.local(name)
+		}
+		cmd = exec.CommandContext(ctx, name, s.Exec[1:]...)
+	}
+	cmd.Dir = r.config.dir
+	cmd.Env = os.Environ()
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	cmd.WaitDelay = stepWaitDelay
+	err := cmd.Run()
+	if errors.Is(err, exec.ErrWaitDelay) {
+		// The step exited; only a child it left behind was still writing.
+		err = nil
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return stepOutcome{Result: "Unknown", Message: fmt.Sprintf("timed out after %s", s.timeout)}
+	}
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return stepOutcome{Result: "Unknown", Message: err.Error()}
+	}
+	var reported struct {
+		Result  string `json:"result"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(bytes.TrimSpace(stdout.Bytes()), &reported) == nil {
+		if _, ok := resultRank[reported.Result]; ok {
+			return stepOutcome{Result: reported.Result, Message: reported.Message}
+		}
+	}
+	out := stepOutcome{Result: "Unknown", Message: lastLine(stdout.String())}
+	if result, ok := exitResults[cmd.ProcessState.ExitCode()]; ok {
+		out.Result = result
+	}
+	if out.Message == "" {
+		out.Message = lastLine(stderr.String())
+	}
+	return out
+}
+
+var envNameInvalid = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// parameterEnvName is the environment variable suffix of a parameter id.
+func parameterEnvName(id string) string {
+	return envNameInvalid.ReplaceAllString(strings.ToUpper(id), "_")
+}
+
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// metadata describes the log, referencing the catalogs it evaluated and,
+// for a Policy, the policy whose plans it ran.
+func (r *assessmentRunner) metadata(refs []string, isPolicy bool) yaml.MapSlice {
+	sourceMeta := mapMap(r.source, "metadata")
+	sourceID := mapString(sourceMeta, "id")
+	id := r.id
+	if id == "" {
+		id = mapString(r.config.Target, "id") + "-" + sourceID + "-evaluation"
+	}
+	author := r.config.Evaluator
+	if author == nil {
+		author = yaml.MapSlice{
+			{Key: "id", Value: "gemara-docs"},
+			{Key: "name", Value: "gemara-docs evaluate"},
+			{Key: "type", Value: "Software"},
+		}
+	}
+	meta := yaml.MapSlice{
+		{Key: "id", Value: id},
+		{Key: "type", Value: "EvaluationLog"},
+		{Key: "gemara-version", Value: mapString(sourceMeta, "gemara-version")},
+		{Key: "date", Value: r.now().UTC().Format(time.RFC3339)},
+		{Key: "description", Value: fmt.Sprintf("Local evaluation of %s against %s.", mapString(r.config.Target, "id"), sourceID)},
+		{Key: "author", Value: author},
+	}
+
+	var notes []string
+	for _, refID := range refs {
+		if refID == sourceID {
+			meta = mergeByID(&notes, meta, "mapping-references", artifactReference(r.sourceFile, r.source, r.outDir), r.sourceFile)
+		} else if ref := findEntry(sourceMeta, "mapping-references", refID); ref != nil {
+			meta = mergeByID(&notes, meta, "mapping-references", rebaseReference(ref, filepath.Dir(r.sourceFile), r.outDir), r.sourceFile)
+		}
+	}
+	if isPolicy {
+		meta = mergeByID(&notes, meta, "mapping-references", artifactReference(r.sourceFile, r.source, r.outDir), r.sourceFile)
+	}
+	return meta
+}
@@ -0,0 +1,12 @@
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !cgo || !(linux || darwin || freebsd)
+
+package cmd
+
+import "context"
+
+// runPluginStep reports that this build cannot load Go plugins.
+func runPluginStep(ctx context.Context, path, symbol string, env map[string]string) stepOutcome {
+	return stepOutcome{Result: "Unknown", Message: "this build of gemara-docs cannot load Go plugins (it needs cgo on Linux, macOS, or FreeBSD): " + path}
+}
@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build cgo && (linux || darwin || freebsd)
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"plugin"
+)
+
+// runPluginStep calls the assessment function a Go plugin exports as
+// symbol (default Assess). A plugin cannot be interrupted, so the timeout
+// only stops waiting for it.
+func runPluginStep(ctx context.Context, path, symbol string, env map[string]string) stepOutcome {
+	if symbol == "" {
+		symbol = "Assess"
+	}
+	p, err := plugin.Open(path)
+	if err != nil {
+		return stepOutcome{Result: "Unknown", Message: err.Error()}
+	}
+	sym, err := p.Lookup(symbol)
+	if err != nil {
+		return stepOutcome{Result: "Unknown", Message: err.Error()}
+	}
+	assess, ok := sym.(func(map[string]string) (string, string, error))
+	if !ok {
+		return stepOutcome{Result: "Unknown", Message: fmt.Sprintf("%s of %s is a %T, expected func(map[string]string) (string, string, error)", symbol, path, sym)}
+	}
+
+	// The plugin gets its own copy of env: it may still be running after a
+	// timeout, when the caller goes on to change env for the next step.
+	env = maps.Clone(env)
+	done := make(chan stepOutcome, 1)
+	go func() {
+		result, message, err := assess(env)
+		if err != nil {
+			done <- stepOutcome{Result: "Unknown", Message: err.Error()}
+			return
+		}
+		if _, ok := resultRank[result]; !ok {
+			done <- stepOutcome{Result: "Unknown", Message: fmt.Sprintf("plugin returned result %q: %s", result, message)}
+			return
+		}
+		done <- stepOutcome{Result: result, Message: message}
+	}()
+	select {
+	case out := <-done:
+		return out
+	case <-ctx.Done():
+		return stepOutcome{Result: "Unknown", Message: fmt.Sprintf("plugin %s: %v", path, ctx.Err())}
+	}
+}
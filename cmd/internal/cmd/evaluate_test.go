@@ -0,0 +1,184 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-yaml"
+)
+
+func testRunner(t *testing.T, source string) *assessmentRunner {
+	t.Helper()
+	config, err := loadRunnerConfig("testdata/evaluate/runner.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := readDocument(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalogs, err := coverageTarget(source, newArtifactResolver("", "", false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	return &assessmentRunner{
+		sourceFile: source,
+		source:     doc,
+		catalogs:   catalogs,
+		config:     config,
+		now:        func() time.Time { return now },
+	}
+}
+
+func assessmentsByRequirement(log yaml.MapSlice) map[string]yaml.MapSlice {
+	byID := make(map[string]yaml.MapSlice)
+	for _, eval := range listMaps(mapList(log, "evaluations")) {
+		for _, a := range listMaps(mapList(eval, "assessment-logs")) {
+			byID[mapString(mapMap(a, "requirement"), "entry-id")] = a
+		}
+	}
+	return byID
+}
+
+func TestEvaluatePolicy(t *testing.T) {
+	r := testRunner(t, "testdata/evaluate-policy.yaml")
+	log, err := r.run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := encodeDocument(log, "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validateGenerated("../../..", "", "evaluation.yaml", data); err != nil {
+		t.Fatalf("log does not validate: %v\n%s", err, data)
+	}
+
+	if got := mapString(log, "result"); got != "Failed" {
+		t.Errorf("log result %s, want Failed", got)
+	}
+	assessments := assessmentsByRequirement(log)
+	for id, want := range map[string]struct {
+		result   string
+		executed int
+		plan     string
+	}{
+		"LV-01.AR01": {"Passed", 2, "mfa-review"},
+		"LV-01.AR02": {"Failed", 1, "factor-review"},
+		"LV-02.AR01": {"Needs Review", 1, "branch-scan"},
+	} {
+		a := assessments[id]
+		if a == nil {
+			t.Errorf("%s was not assessed", id)
+			continue
+		}
+		executed, _ := intValue(a, "steps-executed")
+		if mapString(a, "result") != want.result || executed != want.executed || mapString(mapMap(a, "plan"), "entry-id") != want.plan {
+			t.Errorf("%s: result %s, steps-executed %v, plan %s; want %+v",
+				id, mapString(a, "result"), executed, mapString(mapMap(a, "plan"), "entry-id"), want)
+		}
+	}
+	if msg := mapString(assessments["LV-02.AR01"], "message"); msg != "check-branch: main has protection rules that need review." {
+		t.Errorf("LV-02.AR01 message %q", msg)
+	}
+	if _, ok := assessments["LV-03.AR01"]; ok {
+		t.Error("LV-03.AR01 has only a Manual plan but was assessed")
+	}
+	if len(r.notes) != 2 || !strings.Contains(r.notes[1], "LV-99.AR01") {
+		t.Errorf("unexpected notes: %v", r.notes)
+	}
+}
+
+func TestEvaluateCatalog(t *testing.T) {
+	r := testRunner(t, "testdata/release-control-catalog.yaml")
+	r.config.Requirements["LV-02.AR01"] = runnerRequirement{Steps: []runnerStep{
+		{Name: "slow", Exec: []string{"sleep", "5"}, timeout: 50 * time.Millisecond},
+	}}
+	log, err := r.run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assessments := assessmentsByRequirement(log)
+	if a := assessments["LV-03.AR01"]; mapString(a, "result") != "Passed" || mapMap(a, "plan") != nil {
+		t.Errorf("LV-03.AR01 of a catalog: %v", a)
+	}
+	if a := assessments["LV-02.AR01"]; mapString(a, "result") != "Unknown" || !strings.Contains(mapString(a, "message"), "timed out") {
+		t.Errorf("LV-02.AR01 should time out: %v", a)
+	}
+	if ref := findEntry(mapMap(log, "metadata"), "mapping-references", "LEVELS-CONTROLS"); ref == nil {
+		t.Error("no mapping-reference to the catalog")
+	}
+}
+
+func TestEvaluateBindsParameters(t *testing.T) {
+	r := testRunner(t, "testdata/parameters-policy.yaml")
+	log, err := r.run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	branch := assessmentsByRequirement(log)["LV-02.AR01"]
+	if got := mapString(branch, "description"); got != "Branch main MUST be protected and its builds reproducible." {
+		t.Errorf("LV-02.AR01 description %q", got)
+	}
+	if got := mapString(mapMap(branch, "plan"), "remarks"); got != "Parameters: branch=main" {
+		t.Errorf("LV-02.AR01 plan remarks %q", got)
+	}
+}
+
+func TestEvaluateParameters(t *testing.T) {
+	r := testRunner(t, "testdata/evaluate-policy.yaml")
+	r.config.Parameters["branch"] = "develop"
+	if _, err := r.run(context.Background()); err == nil || !strings.HasPrefix(err.Error(), "testdata/evaluate/runner.yaml: ") || !strings.Contains(err.Error(), "not an accepted value") {
+		t.Errorf("expected an accepted-values error, got %v", err)
+	}
+	delete(r.config.Parameters, "branch")
+	if _, err := r.run(context.Background()); err == nil || !strings.HasPrefix(err.Error(), "testdata/evaluate/runner.yaml: ") || !strings.Contains(err.Error(), "has no value") {
+		t.Errorf("expected a missing value error, got %v", err)
+	}
+}
+
+func TestEvaluateAggregatesSteps(t *testing.T) {
+	r := testRunner(t, "testdata/release-control-catalog.yaml")
+	r.config.Requirements["LV-02.AR01"] = runnerRequirement{Steps: []runnerStep{
+		{Name: "review", Exec: []string{"sh", "-c", "echo needs a look; exit 2"}, timeout: 10 * time.Second},
+		{Name: "pass", Exec: []string{"true"}, timeout: 10 * time.Second},
+	}}
+	log, err := r.run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := assessmentsByRequirement(log)["LV-02.AR01"]
+	executed, _ := intValue(a, "steps-executed")
+	if mapString(a, "result") != "Needs Review" || executed != 2 || mapString(a, "message") != "review: needs a look" {
+		t.Errorf("LV-02.AR01: result %s, steps-executed %v, message %q; want Needs Review, 2, review's message",
+			mapString(a, "result"), executed, mapString(a, "message"))
+	}
+}
+
+func TestRunStepBackgroundChild(t *testing.T) {
+	r := testRunner(t, "testdata/evaluate-policy.yaml")
+	for _, tc := range []struct {
+		name   string
+		step   runnerStep
+		result string
+	}{
+		{"exits", runnerStep{Name: "background", Script: "background.sh", timeout: 10 * time.Second}, "Passed"},
+		{"times out", runnerStep{Name: "wait", Exec: []string{"sh", "-c", "sleep 5 & wait"}, timeout: 50 * time.Millisecond}, "Unknown"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			start := time.Now()
+			out := r.runStep(context.Background(), tc.step, nil)
+			if elapsed := time.Since(start); elapsed > 3*time.Second {
+				t.Errorf("step took %s; the background sleep kept it running", elapsed)
+			}
+			if out.Result != tc.result {
+				t.Errorf("result %s (%s), want %s", out.Result, out.Message, tc.result)
+			}
+		})
+	}
+}
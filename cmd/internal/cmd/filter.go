@@ -0,0 +1,195 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/spf13/cobra"
+)
+
+var filterCmd = &cobra.Command{
+	Use:   "filter [file]",
+	Short: "Write a ControlCatalog narrowed to some applicability groups",
+	Long: `Write a view of a ControlCatalog that keeps only the assessment
+requirements matching --applicability, for example a "Level 1 only" view
+of a baseline:
+
+  --match any  keeps requirements listing at least one of the ids (default);
+  --match all  keeps requirements listing every one of the ids.
+
+Controls left without assessment requirements are dropped, and groups and
+applicability-groups nothing refers to anymore are pruned, so the result
+still validates as a ControlCatalog. A replaced-by naming a control or
+requirement of the catalog that the view drops is removed and reported on
+stderr. The view is validated before it is written.`,
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE:          runFilter,
+}
+
+var filterFlags struct {
+	schemaDir     string
+	applicability []string
+	match         string
+	format        string
+	outputPath    string
+}
+
+func newFilterCmd() *cobra.Command {
+	filterCmd.Flags().StringVarP(&filterFlags.schemaDir, "schema", "s", "..", "Path to the CUE package directory")
+	filterCmd.Flags().StringSliceVarP(&filterFlags.applicability, "applicability", "a", nil, "Applicability group ids to keep (comma-separated or repeated)")
+	filterCmd.Flags().StringVarP(&filterFlags.match, "match", "m", "any", "Keep requirements matching any or all of the ids")
+	filterCmd.Flags().StringVarP(&filterFlags.format, "format", "f", "", "Output format: yaml or json (default: from the output or input extension)")
+	filterCmd.Flags().StringVarP(&filterFlags.outputPath, "output", "o", "", "Output path for the filtered catalog (default: stdout)")
+	_ = filterCmd.MarkFlagRequired("applicability")
+	return filterCmd
+}
+
+func runFilter(cmd *cobra.Command, args []string) error {
+	file := args[0]
+	if filterFlags.match != "any" && filterFlags.match != "all" {
+		return fmt.Errorf("unsupported --match %q (expected any or all)", filterFlags.match)
+	}
+	doc, err := readDocument(file)
+	if err != nil {
+		return err
+	}
+	if typ := mapString(mapMap(doc, "metadata"), "type"); typ != "ControlCatalog" {
+		return fmt.Errorf("%s is a %s, expected a ControlCatalog", file, typ)
+	}
+
+	meta := mapMap(doc, "metadata")
+	for _, id := range filterFlags.applicability {
+		if findEntry(meta, "applicability-groups", id) == nil {
+			fmt.Fprintf(os.Stderr, "%s: applicability group %q is not declared\n", file, id)
+		}
+	}
+	filtered, kept, notes := filterCatalog(doc, filterFlags.applicability, filterFlags.match == "all")
+	for _, note := range notes {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", file, note)
+	}
+	fmt.Fprintf(os.Stderr, "%s: kept %d of %d control(s)\n", file, kept, len(mapList(doc, "controls")))
+
+	out := filterFlags.outputPath
+	format := outputFormat(filterFlags.format, out, file)
+	data, err := encodeDocument(filtered, format)
+	if err != nil {
+		return err
+	}
+	stdout := strings.TrimSuffix(file, filepath.Ext(file)) + ".filtered." + format
+	if err := writeGenerated(filterFlags.schemaDir, "", out, stdout, data); err != nil {
+		return fmt.Errorf("filtered %s: %w", file, err)
+	}
+	return nil
+}
+
+// filterCatalog returns a copy of the ControlCatalog doc keeping only the
+// assessment requirements whose applicability lists any (or, with all,
+// every) one of ids, and the number of controls kept. Emptied controls and
+// unreferenced groups and applicability-groups are removed, as are
+// replaced-by references to removed entries, which the notes describe.
+func filterCatalog(doc yaml.MapSlice, ids []string, all bool) (yaml.MapSlice, int, []string) {
+	var controls []interface{}
+	groups := make(map[string]bool)
+	used := make(map[string]bool)
+	for _, ctl := range listMaps(mapList(doc, "controls")) {
+		var reqs []interface{}
+		for _, ar := range listMaps(mapList(ctl, "assessment-requirements")) {
+			applicability := stringList(mapList(ar, "applicability"))
+			if !matchApplicability(applicability, ids, all) {
+				continue
+			}
+			reqs = append(reqs, ar)
+			for _, a := range applicability {
+				used[a] = true
+			}
+		}
+		if len(reqs) == 0 {
+			continue
+		}
+		ctl = mapSet(append(yaml.MapSlice(nil), ctl...), "assessment-requirements", reqs)
+		controls = append(controls, ctl)
+		groups[mapString(ctl, "group")] = true
+	}
+
+	controls, notes := dropDanglingReplacements(controls, mapString(mapMap(doc, "metadata"), "id"))
+
+	out := append(yaml.MapSlice(nil), doc...)
+	meta := append(yaml.MapSlice(nil), mapMap(out, "metadata")...)
+	meta = setOrDelete(meta, "applicability-groups", keepByID(mapList(meta, "applicability-groups"), used))
+	out = mapSet(out, "metadata", meta)
+	out = setOrDelete(out, "groups", keepByID(mapList(out, "groups"), groups))
+	out = setOrDelete(out, "controls", controls)
+	return out, len(controls), notes
+}
+
+// dropDanglingReplacements removes from the kept controls and their
+// requirements the replaced-by references naming an entry of the catalog
+// self that was not kept.
+func dropDanglingReplacements(controls []interface{}, self string) ([]interface{}, []string) {
+	kept := make(map[string]bool)
+	for _, ctl := range listMaps(controls) {
+		kept[mapString(ctl, "id")] = true
+		for _, ar := range listMaps(mapList(ctl, "assessment-requirements")) {
+			kept[mapString(ar, "id")] = true
+		}
+	}
+	var notes []string
+	drop := func(entry yaml.MapSlice) yaml.MapSlice {
+		rb := mapMap(entry, "replaced-by")
+		target := mapString(rb, "entry-id")
+		if rb == nil || mapString(rb, "reference-id") != self || kept[target] {
+			return entry
+		}
+		notes = append(notes, fmt.Sprintf("dropped replaced-by of %s: %s is not in the view", mapString(entry, "id"), target))
+		return mapDelete(entry, "replaced-by")
+	}
+
+	var out []interface{}
+	for _, ctl := range listMaps(controls) {
+		var reqs []interface{}
+		for _, ar := range listMaps(mapList(ctl, "assessment-requirements")) {
+			reqs = append(reqs, drop(ar))
+		}
+		out = append(out, mapSet(drop(ctl), "assessment-requirements", reqs))
+	}
+	return out, notes
+}
+
+func matchApplicability(applicability, ids []string, all bool) bool {
+	for _, id := range ids {
+		found := containsString(applicability, id)
+		if found && !all {
+			return true
+		}
+		if !found && all {
+			return false
+		}
+	}
+	return all && len(ids) > 0
+}
+
+// keepByID returns the mapping elements of list whose id is in keep.
+func keepByID(list []interface{}, keep map[string]bool) []interface{} {
+	var out []interface{}
+	for _, m := range listMaps(list) {
+		if keep[mapString(m, "id")] {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// setOrDelete sets key to list, or removes key when list is empty.
+func setOrDelete(m yaml.MapSlice, key string, list []interface{}) yaml.MapSlice {
+	if len(list) == 0 {
+		return mapDelete(m, key)
+	}
+	return mapSet(m, key, list)
+}
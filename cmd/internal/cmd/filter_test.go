@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+)
+
+func TestFilterCatalog(t *testing.T) {
+	doc, err := readDocument("testdata/levels-control-catalog.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ids          []string
+		all          bool
+		requirements string
+		groups       string
+		applicable   string
+	}{
+		{[]string{"level-1"}, false, "LV-01.AR01", "access", "level-1,level-2"},
+		{[]string{"level-3"}, false, "LV-01.AR02,LV-02.AR01", "access,build", "level-2,level-3"},
+		{[]string{"level-1", "level-3"}, false, "LV-01.AR01,LV-01.AR02,LV-02.AR01", "access,build", "level-1,level-2,level-3"},
+		{[]string{"level-2", "level-3"}, true, "LV-02.AR01", "build", "level-2,level-3"},
+		{[]string{"missing"}, false, "", "", ""},
+	}
+	for _, tt := range tests {
+		out, _, _ := filterCatalog(doc, tt.ids, tt.all)
+
+		var reqs []string
+		for _, ctl := range listMaps(mapList(out, "controls")) {
+			for _, ar := range listMaps(mapList(ctl, "assessment-requirements")) {
+				reqs = append(reqs, mapString(ar, "id"))
+			}
+		}
+		if got := strings.Join(reqs, ","); got != tt.requirements {
+			t.Errorf("%v all=%v: requirements = %s, want %s", tt.ids, tt.all, got, tt.requirements)
+		}
+		if got := joinIDs(mapList(out, "groups")); got != tt.groups {
+			t.Errorf("%v all=%v: groups = %s, want %s", tt.ids, tt.all, got, tt.groups)
+		}
+		if got := joinIDs(mapList(mapMap(out, "metadata"), "applicability-groups")); got != tt.applicable {
+			t.Errorf("%v all=%v: applicability-groups = %s, want %s", tt.ids, tt.all, got, tt.applicable)
+		}
+	}
+
+	if len(mapList(doc, "controls")) != 2 {
+		t.Error("filterCatalog modified its input")
+	}
+}
+
+func TestFilterCatalogReplacedBy(t *testing.T) {
+	doc, err := readDocument("testdata/levels-control-catalog.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	replacedBy := func(id string) yaml.MapSlice {
+		return yaml.MapSlice{{Key: "reference-id", Value: "LEVELS-CONTROLS"}, {Key: "entry-id", Value: id}}
+	}
+	lv01 := append(yaml.MapSlice(nil), findEntry(doc, "controls", "LV-01")...)
+	reqs := mapList(lv01, "assessment-requirements")
+	ar01 := append(yaml.MapSlice(nil), listMaps(reqs)[0]...)
+	ar01 = mapSet(ar01, "replaced-by", replacedBy("LV-01.AR02"))
+	lv01 = mapSet(lv01, "assessment-requirements", []interface{}{ar01, reqs[1]})
+	lv01 = mapSet(lv01, "replaced-by", replacedBy("LV-02"))
+	doc = mapSet(append(yaml.MapSlice(nil), doc...), "controls", []interface{}{lv01, mapList(doc, "controls")[1]})
+
+	out, _, notes := filterCatalog(doc, []string{"level-1"}, false)
+	ctl := findEntry(out, "controls", "LV-01")
+	if _, ok := mapGet(ctl, "replaced-by"); ok {
+		t.Error("LV-01 still names LV-02, which the view drops")
+	}
+	if _, ok := mapGet(listMaps(mapList(ctl, "assessment-requirements"))[0], "replaced-by"); ok {
+		t.Error("LV-01.AR01 still names LV-01.AR02, which the view drops")
+	}
+	if len(notes) != 2 {
+		t.Errorf("notes = %q, want one per dropped replaced-by", notes)
+	}
+
+	out, _, notes = filterCatalog(doc, []string{"level-1", "level-3"}, false)
+	if _, ok := mapGet(findEntry(out, "controls", "LV-01"), "replaced-by"); !ok || len(notes) != 0 {
+		t.Errorf("a replaced-by naming a kept control was dropped: %q", notes)
+	}
+}
+
+func joinIDs(list []interface{}) string {
+	var ids []string
+	for _, m := range listMaps(list) {
+		ids = append(ids, mapString(m, "id"))
+	}
+	return strings.Join(ids, ",")
+}
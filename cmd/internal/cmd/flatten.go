@@ -0,0 +1,324 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/spf13/cobra"
+)
+
+var flattenCmd = &cobra.Command{
+	Use:   "flatten [file]",
+	Short: "Resolve a catalog's extends and imports into one self-contained catalog",
+	Long: `Resolve the extends and imports of a Gemara catalog into one catalog that
+no longer depends on the catalogs it builds upon:
+
+  - extends inherits every entry and group of the referenced catalog;
+  - imports copies the listed entries, with the groups they belong to;
+  - referenced catalogs are flattened first, so inheritance is transitive;
+  - applicability groups and mapping references of the referenced catalogs
+    are merged into metadata, so inherited entries stay valid.
+
+Entries defined locally override inherited entries with the same id; the
+override is reported on stderr. Two referenced catalogs contributing the
+same id is an error. Each inherited entry is annotated with a comment
+naming the mapping reference it came from; catalog entries have no field to
+record that in, so the flattened catalog is always written as YAML.
+
+Referenced catalogs are loaded through metadata.mapping-references as by
+validate --references. The flattened catalog is validated against the same
+definition as the input before it is written.`,
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE:          runFlatten,
+}
+
+var flattenFlags struct {
+	schemaDir  string
+	definition string
+	format     string
+	outputPath string
+	mirrorDir  string
+	cacheDir   string
+	fetch      bool
+}
+
+// catalogCollections are the top-level entry lists of the catalog types.
+var catalogCollections = []string{"capabilities", "controls", "guidelines", "principles", "risks", "threats", "vectors"}
+
+func newFlattenCmd() *cobra.Command {
+	flattenCmd.Flags().StringVarP(&flattenFlags.schemaDir, "schema", "s", "..", "Path to the CUE package directory")
+	flattenCmd.Flags().StringVarP(&flattenFlags.definition, "definition", "d", "", "Schema definition to validate the result against (default: inferred from metadata.type)")
+	flattenCmd.Flags().StringVarP(&flattenFlags.format, "format", "f", "", "Output format: yaml, the only format that keeps the origin of inherited entries (default: yaml)")
+	flattenCmd.Flags().StringVarP(&flattenFlags.outputPath, "output", "o", "", "Output path for the flattened catalog (default: stdout)")
+	flattenCmd.Flags().StringVar(&flattenFlags.mirrorDir, "mirror", "", "Read-only directory mirroring http(s) artifacts as host/path")
+	flattenCmd.Flags().StringVar(&flattenFlags.cacheDir, "cache", "", "Directory where downloaded http(s) artifacts are cached")
+	flattenCmd.Flags().BoolVar(&flattenFlags.fetch, "fetch", false, "Download http(s) artifacts missing from the mirror and cache")
+	return flattenCmd
+}
+
+func runFlatten(cmd *cobra.Command, args []string) error {
+	file := args[0]
+	doc, err := readDocument(file)
+	if err != nil {
+		return err
+	}
+
+	resolver := newArtifactResolver(flattenFlags.mirrorDir, flattenFlags.cacheDir, flattenFlags.fetch)
+	out := flattenFlags.outputPath
+	flat, notes, err := flattenCatalog(file, doc, resolver, outputDir(out))
+	for _, note := range notes {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", file, note)
+	}
+	if err != nil {
+		return fmt.Errorf("flatten %s: %w", file, err)
+	}
+
+	// Unlike other generated artifacts, a flattened catalog defaults to
+	// YAML whatever the input format, as only YAML keeps entry origins.
+	format := outputFormat(flattenFlags.format, out, "")
+	data, err := flat.encode(format)
+	if err != nil {
+		return err
+	}
+	stdout := strings.TrimSuffix(file, filepath.Ext(file)) + ".flat." + format
+	if err := writeGenerated(flattenFlags.schemaDir, flattenFlags.definition, out, stdout, data); err != nil {
+		return fmt.Errorf("flattened %s: %w", file, err)
+	}
+	return nil
+}
+
+// flatCatalog is a catalog with its extends and imports resolved. origins
+// records, per collection, the mapping reference each inherited entry came
+// from; local entries have none. dir is where the relative file:// urls of
+// its mapping references resolve from.
+type flatCatalog struct {
+	doc     yaml.MapSlice
+	origins map[string]map[string]string
+	dir     string
+}
+
+// flattener resolves extends and imports, one catalog at a time.
+type flattener struct {
+	resolver   *artifactResolver
+	active     []string
+	notes      []string
+	collisions []string
+}
+
+// flattenCatalog resolves the extends and imports of the catalog doc read
+// from file. outDir is where the result is written, which its mapping
+// references are rebased onto. Notes describe local overrides; id
+// collisions between referenced catalogs are returned as an error.
+func flattenCatalog(file string, doc yaml.MapSlice, resolver *artifactResolver, outDir string) (*flatCatalog, []string, error) {
+	idx := indexEntries(doc)
+	idx.Dir = filepath.Dir(file)
+
+	f := &flattener{resolver: resolver}
+	flat, err := f.flatten(idx, doc)
+	if err == nil && len(f.collisions) > 0 {
+		err = fmt.Errorf("id collision:\n  %s", strings.Join(f.collisions, "\n  "))
+	}
+	if err != nil {
+		return flat, f.notes, err
+	}
+	meta := mapMap(flat.doc, "metadata")
+	var refs []interface{}
+	for _, ref := range listMaps(mapList(meta, "mapping-references")) {
+		refs = append(refs, rebaseReference(ref, flat.dir, outDir))
+	}
+	if refs != nil {
+		flat.doc = mapSet(flat.doc, "metadata", mapSet(meta, "mapping-references", refs))
+	}
+	flat.dir = outDir
+	return flat, f.notes, nil
+}
+
+func (f *flattener) flatten(idx *entryIndex, doc yaml.MapSlice) (*flatCatalog, error) {
+	for i, id := range f.active {
+		if id == idx.ID {
+			return nil, fmt.Errorf("extends or imports cycle: %s -> %s", strings.Join(f.active[i:], " -> "), id)
+		}
+	}
+	f.active = append(f.active, idx.ID)
+	defer func() { f.active = f.active[:len(f.active)-1] }()
+
+	out := &flatCatalog{origins: make(map[string]map[string]string), dir: idx.Dir}
+	for _, item := range doc {
+		switch fmt.Sprint(item.Key) {
+		case "extends", "imports":
+			continue
+		case "metadata":
+			meta, _ := item.Value.(yaml.MapSlice)
+			item.Value = append(yaml.MapSlice(nil), meta...)
+		}
+		out.doc = append(out.doc, item)
+	}
+	for _, coll := range catalogCollections {
+		if list := mapList(out.doc, coll); list != nil {
+			out.doc = mapSet(out.doc, coll, append([]interface{}(nil), list...))
+		}
+	}
+
+	for _, ext := range listMaps(mapList(doc, "extends")) {
+		refID := mapString(ext, "reference-id")
+		base, err := f.load(idx, refID)
+		if err != nil {
+			return nil, err
+		}
+		f.merge(out, base, refID, nil)
+	}
+	for _, imp := range listMaps(mapList(doc, "imports")) {
+		refID := mapString(imp, "reference-id")
+		base, err := f.load(idx, refID)
+		if err != nil {
+			return nil, err
+		}
+		only := make(map[string]bool)
+		for _, entry := range listMaps(mapList(imp, "entries")) {
+			only[mapString(entry, "reference-id")] = true
+		}
+		if missing := f.merge(out, base, refID, only); len(missing) > 0 {
+			return nil, fmt.Errorf("%s imports entries that %s does not define: %s", idx.ID, refID, strings.Join(missing, ", "))
+		}
+	}
+	return out, nil
+}
+
+// load resolves refID from the catalog idx and flattens what it names.
+func (f *flattener) load(idx *entryIndex, refID string) (*flatCatalog, error) {
+	base, err := f.resolver.follow(idx, refID)
+	if err != nil {
+		return nil, err
+	}
+	if base == idx {
+		return nil, fmt.Errorf("%s extends or imports itself", idx.ID)
+	}
+	return f.flatten(base, base.Doc)
+}
+
+// merge adds the entries of src to out, all of them or only those in only,
+// along with their groups, applicability groups, and mapping references.
+// It returns the ids in only that src does not define, sorted.
+func (f *flattener) merge(out, src *flatCatalog, refID string, only map[string]bool) []string {
+	found := make(map[string]bool)
+	groups := make(map[string]bool)
+	for _, coll := range catalogCollections {
+		for _, entry := range listMaps(mapList(src.doc, coll)) {
+			id := mapString(entry, "id")
+			if only != nil && !only[id] {
+				continue
+			}
+			found[id] = true
+			groups[mapString(entry, "group")] = true
+			origin := src.origins[coll][id]
+			if origin == "" {
+				origin = refID
+			}
+			out.add(f, coll, entry, origin)
+		}
+	}
+
+	for _, g := range listMaps(mapList(src.doc, "groups")) {
+		if only == nil || groups[mapString(g, "id")] {
+			out.doc = mergeByID(&f.notes, out.doc, "groups", g, refID)
+		}
+	}
+	outMeta, srcMeta := mapMap(out.doc, "metadata"), mapMap(src.doc, "metadata")
+	for _, g := range listMaps(mapList(srcMeta, "applicability-groups")) {
+		outMeta = mergeByID(&f.notes, outMeta, "applicability-groups", g, refID)
+	}
+	self := mapString(outMeta, "id")
+	for _, ref := range listMaps(mapList(srcMeta, "mapping-references")) {
+		if mapString(ref, "id") != self {
+			outMeta = mergeByID(&f.notes, outMeta, "mapping-references", rebaseReference(ref, src.dir, out.dir), refID)
+		}
+	}
+	out.doc = mapSet(out.doc, "metadata", outMeta)
+
+	var missing []string
+	for id := range only {
+		if !found[id] {
+			missing = append(missing, id)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// add appends an inherited entry to its collection. A local entry with the
+// same id wins; two inherited entries with the same id collide.
+func (c *flatCatalog) add(f *flattener, coll string, entry yaml.MapSlice, origin string) {
+	id := mapString(entry, "id")
+	list := mapList(c.doc, coll)
+	for _, existing := range listMaps(list) {
+		if mapString(existing, "id") != id {
+			continue
+		}
+		switch prev := c.origins[coll][id]; prev {
+		case origin:
+		case "":
+			f.notes = append(f.notes, fmt.Sprintf("%s: local %s entry %s overrides the one from %s", c.id(), coll, id, origin))
+		default:
+			f.collisions = append(f.collisions, fmt.Sprintf("%s: %s entry %s is defined by both %s and %s", c.id(), coll, id, prev, origin))
+		}
+		return
+	}
+	c.doc = mapSet(c.doc, coll, append(list, entry))
+	if c.origins[coll] == nil {
+		c.origins[coll] = make(map[string]string)
+	}
+	c.origins[coll][id] = origin
+}
+
+func (c *flatCatalog) id() string {
+	return mapString(mapMap(c.doc, "metadata"), "id")
+}
+
+// mergeByID appends item to the list under key unless an item with the
+// same id is already there; differing duplicates are noted and the first
+// one is kept.
+func mergeByID(notes *[]string, m yaml.MapSlice, key string, item yaml.MapSlice, origin string) yaml.MapSlice {
+	list := mapList(m, key)
+	id := mapString(item, "id")
+	for _, existing := range listMaps(list) {
+		if mapString(existing, "id") != id {
+			continue
+		}
+		a, _ := encodeDocument(existing, "json")
+		b, _ := encodeDocument(item, "json")
+		if !bytes.Equal(a, b) {
+			*notes = append(*notes, fmt.Sprintf("%s %s from %s differs from the one already present; keeping the first", key, id, origin))
+		}
+		return m
+	}
+	return mapSet(m, key, append(append([]interface{}(nil), list...), item))
+}
+
+// encode writes the flattened catalog, marking each inherited entry with a
+// line comment naming the mapping reference it came from. Only YAML can
+// carry the comments, so other formats are refused rather than silently
+// losing the origins.
+func (c *flatCatalog) encode(format string) ([]byte, error) {
+	if format != "yaml" {
+		return nil, fmt.Errorf("unsupported format %q: only yaml records the origin of inherited entries", format)
+	}
+	comments := yaml.CommentMap{}
+	for _, coll := range catalogCollections {
+		for i, entry := range listMaps(mapList(c.doc, coll)) {
+			if origin := c.origins[coll][mapString(entry, "id")]; origin != "" {
+				path := fmt.Sprintf("$.%s[%d].id", coll, i)
+				comments[path] = []*yaml.Comment{yaml.LineComment(" from " + origin)}
+			}
+		}
+	}
+	return yaml.MarshalWithOptions(c.doc, yaml.Indent(2), yaml.IndentSequence(true), yaml.UseLiteralStyleIfMultiline(true), yaml.WithComment(comments))
+}
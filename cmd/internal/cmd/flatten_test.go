@@ -0,0 +1,148 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/goccy/go-yaml"
+)
+
+func TestFlattenCatalog(t *testing.T) {
+	file := "testdata/flatten-control-catalog.yaml"
+	doc, err := readDocument(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flat, notes, err := flattenCatalog(file, doc, newArtifactResolver("", "", false), "testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) != 1 || !strings.Contains(notes[0], "FB-02 overrides the one from FLAT-BASE") {
+		t.Errorf("unexpected notes: %v", notes)
+	}
+	if _, ok := mapGet(flat.doc, "extends"); ok {
+		t.Error("extends was not removed")
+	}
+
+	var ids []string
+	for _, c := range listMaps(mapList(flat.doc, "controls")) {
+		ids = append(ids, mapString(c, "id"))
+	}
+	if got, want := strings.Join(ids, ","), "FB-02,FC-01,FB-01,FX-01"; got != want {
+		t.Errorf("controls = %s, want %s", got, want)
+	}
+	if got := flat.origins["controls"]; got["FB-01"] != "FLAT-BASE" || got["FX-01"] != "FLAT-EXTRA" || got["FB-02"] != "" {
+		t.Errorf("unexpected origins: %v", got)
+	}
+	var groups []string
+	for _, g := range listMaps(mapList(flat.doc, "groups")) {
+		groups = append(groups, mapString(g, "id"))
+	}
+	if got, want := strings.Join(groups, ","), "dp,ops"; got != want {
+		t.Errorf("groups = %s, want %s", got, want)
+	}
+
+	data, err := flat.encode("yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "id: FX-01 # from FLAT-EXTRA") {
+		t.Errorf("origin comment missing:\n%s", data)
+	}
+	ctx := cuecontext.New()
+	schema, err := loadSchema(ctx, "../../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := parseArtifactSource(ctx, "flat.yaml", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := validateSource(schema, src, "", ruleSchema); !result.Valid {
+		t.Errorf("flattened catalog is invalid: %v", result.Diagnostics)
+	}
+}
+
+func TestFlattenCatalogCollision(t *testing.T) {
+	file := "testdata/flatten-control-catalog.yaml"
+	doc, err := readDocument(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imports := []interface{}{yaml.MapSlice{
+		{Key: "reference-id", Value: "FLAT-EXTRA"},
+		{Key: "entries", Value: []interface{}{yaml.MapSlice{{Key: "reference-id", Value: "FB-01"}}}},
+	}}
+	doc = mapSet(doc, "imports", imports)
+
+	_, _, err = flattenCatalog(file, doc, newArtifactResolver("", "", false), "testdata")
+	if err == nil || !strings.Contains(err.Error(), "FB-01 is defined by both FLAT-BASE and FLAT-EXTRA") {
+		t.Errorf("expected a collision error, got %v", err)
+	}
+}
+
+func TestFlattenRebasesReferences(t *testing.T) {
+	dir := t.TempDir()
+	copyDocument := func(from, to string, edit func(yaml.MapSlice) yaml.MapSlice) {
+		t.Helper()
+		doc, err := readDocument(from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := encodeDocument(edit(doc), "yaml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		to = filepath.Join(dir, to)
+		if err := os.MkdirAll(filepath.Dir(to), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(to, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The base lives in lib/ and carries a reference relative to it.
+	copyDocument("testdata/flatten-base-catalog.yaml", "lib/base.yaml", func(doc yaml.MapSlice) yaml.MapSlice {
+		ref := yaml.MapSlice{{Key: "id", Value: "FLAT-GUIDE"}, {Key: "title", Value: "Guide"}, {Key: "version", Value: "1.0.0"}, {Key: "url", Value: "file://guide.yaml"}}
+		return mapSet(doc, "metadata", mapSet(mapMap(doc, "metadata"), "mapping-references", []interface{}{ref}))
+	})
+	copyDocument("testdata/flatten-control-catalog.yaml", "catalog.yaml", func(doc yaml.MapSlice) yaml.MapSlice {
+		meta := mapMap(doc, "metadata")
+		mapSet(findEntry(meta, "mapping-references", "FLAT-BASE"), "url", "file://lib/base.yaml")
+		return doc
+	})
+	copyDocument("testdata/flatten-extra-catalog.yaml", "flatten-extra-catalog.yaml", func(doc yaml.MapSlice) yaml.MapSlice { return doc })
+
+	file := filepath.Join(dir, "catalog.yaml")
+	doc, err := readDocument(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flat, _, err := flattenCatalog(file, doc, newArtifactResolver("", "", false), filepath.Join(dir, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := mapMap(flat.doc, "metadata")
+	for id, want := range map[string]string{
+		"FLAT-BASE":  "file://../lib/base.yaml",
+		"FLAT-EXTRA": "file://../flatten-extra-catalog.yaml",
+		"FLAT-GUIDE": "file://../lib/guide.yaml",
+	} {
+		if got := mapString(findEntry(meta, "mapping-references", id), "url"); got != want {
+			t.Errorf("%s url = %q, want %q", id, got, want)
+		}
+	}
+}
+
+func TestFlattenRefusesJSON(t *testing.T) {
+	flat := &flatCatalog{doc: yaml.MapSlice{{Key: "title", Value: "Flat"}}}
+	if _, err := flat.encode("json"); err == nil || !strings.Contains(err.Error(), "origin") {
+		t.Errorf("expected JSON output to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,494 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+	"github.com/goccy/go-yaml/token"
+	"github.com/spf13/cobra"
+)
+
+var fmtCmd = &cobra.Command{
+	Use:   "fmt [files...]",
+	Short: "Rewrite Gemara YAML artifacts in the canonical style",
+	Long: `Rewrite Gemara YAML artifacts in place in the canonical style:
+
+  - keys are ordered as the CUE definition declares them, with fields the
+    schema does not know about kept after them in their original order;
+  - strings longer than --width use block scalars (literal for multi-line
+    text, folded and wrapped for long single-line text), shorter strings
+    are plain unless YAML requires double quotes;
+  - ID lists whose order has no meaning (applicability, see-also,
+    exclusions) are sorted.
+
+Comments are preserved; a comment at the top of the file stays there. With
+--check, files are not written; fmt lists the files that are not formatted
+and exits non-zero, which suits CI.`,
+	Args:          cobra.MinimumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE:          runFmt,
+}
+
+var fmtFlags struct {
+	schemaDir  string
+	definition string
+	check      bool
+	width      int
+}
+
+func newFmtCmd() *cobra.Command {
+	fmtCmd.Flags().StringVarP(&fmtFlags.schemaDir, "schema", "s", "..", "Path to the CUE package directory")
+	fmtCmd.Flags().StringVarP(&fmtFlags.definition, "definition", "d", "", "Schema definition that declares the key order (default: inferred from metadata.type)")
+	fmtCmd.Flags().BoolVar(&fmtFlags.check, "check", false, "Report files that are not formatted instead of rewriting them")
+	fmtCmd.Flags().IntVarP(&fmtFlags.width, "width", "w", 80, "Strings longer than this use block scalars")
+	return fmtCmd
+}
+
+// unorderedIDLists are the string lists whose order carries no meaning.
+var unorderedIDLists = map[string]bool{
+	"applicability": true,
+	"see-also":      true,
+	"exclusions":    true,
+}
+
+func runFmt(cmd *cobra.Command, args []string) error {
+	ctx := cuecontext.New()
+	schema, err := loadSchema(ctx, fmtFlags.schemaDir)
+	if err != nil {
+		return err
+	}
+
+	unformatted := 0
+	for _, file := range args {
+		if documentFormat(file) != "yaml" {
+			return fmt.Errorf("%s: fmt only formats YAML (use normalize for JSON)", file)
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", file, err)
+		}
+		src, err := parseArtifactSource(ctx, file, data)
+		if err != nil {
+			return fmt.Errorf("parse %s: %w", file, err)
+		}
+		def, _, err := lookupDefinition(schema, src.Value, fmtFlags.definition)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+
+		formatted, err := formatYAML(data, def, fmtFlags.width)
+		if err != nil {
+			return fmt.Errorf("format %s: %w", file, err)
+		}
+		if bytes.Equal(data, formatted) {
+			continue
+		}
+		unformatted++
+		if fmtFlags.check {
+			fmt.Println(file)
+			continue
+		}
+		if err := os.WriteFile(file, formatted, 0644); err != nil {
+			return fmt.Errorf("write %s: %w", file, err)
+		}
+		fmt.Fprintf(os.Stderr, "formatted %s\n", filepath.Clean(file))
+	}
+
+	if fmtFlags.check && unformatted > 0 {
+		return fmt.Errorf("%d of %d file(s) not formatted", unformatted, len(args))
+	}
+	return nil
+}
+
+// formatYAML rewrites data in the canonical style and checks that the
+// result still holds the same data. The printer decides blank lines from
+// token positions, which differ once a block scalar has been re-parsed, so
+// passes repeat until the output is stable and --check agrees with fmt.
+func formatYAML(data []byte, def cue.Value, width int) ([]byte, error) {
+	out := data
+	for i := 0; i < 3; i++ {
+		next, err := formatPass(out, def, width)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(next, out) {
+			break
+		}
+		out = next
+	}
+	if err := sameDocumentData(data, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// formatPass rewrites data once by editing its comment preserving AST.
+func formatPass(data []byte, def cue.Value, width int) ([]byte, error) {
+	file, err := parser.ParseBytes(data, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &formatter{width: width}
+	for _, doc := range file.Docs {
+		if doc.Body == nil {
+			continue
+		}
+		root, isMapping := doc.Body.(*ast.MappingNode)
+		var header *ast.CommentGroupNode
+		if isMapping && len(root.Values) > 0 {
+			header = root.Values[0].GetComment()
+			root.Values[0].Comment = nil
+		}
+		doc.Body = f.format(doc.Body, def, "", 0)
+		if header != nil {
+			first := root.Values[0]
+			if c := first.GetComment(); c != nil {
+				header = ast.CommentGroup(append(commentTokens(header), commentTokens(c)...))
+			}
+			first.Comment = header
+		}
+	}
+
+	// A key moved to the top keeps the blank line that preceded it.
+	out := bytes.TrimLeft([]byte(file.String()), "\n")
+	if len(out) > 0 && out[len(out)-1] != '\n' {
+		out = append(out, '\n')
+	}
+	return out, nil
+}
+
+type formatter struct {
+	width int
+}
+
+// format rewrites node, whose schema is s, and returns the node that takes
+// its place. key is the mapping key node sits under and indent the column
+// its block content starts at.
+func (f *formatter) format(node ast.Node, s cue.Value, key string, indent int) ast.Node {
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		f.formatMapping(n, s)
+		return n
+	case *ast.MappingValueNode:
+		f.formatMappingValue(n, f.fieldSchemas(s))
+		return n
+	case *ast.SequenceNode:
+		f.formatSequence(n, s, key)
+		return n
+	case *ast.AnchorNode:
+		n.Value = f.format(n.Value, s, key, indent)
+		return n
+	case *ast.TagNode:
+		n.Value = f.format(n.Value, s, key, indent)
+		return n
+	case *ast.StringNode:
+		return f.formatString(n, n.Value, n.Comment, indent)
+	case *ast.LiteralNode:
+		return f.formatString(n, n.Value.Value, n.Comment, indent)
+	default:
+		return node
+	}
+}
+
+func (f *formatter) fieldSchemas(s cue.Value) map[string]cue.Value {
+	fields := schemaFields(s)
+	out := make(map[string]cue.Value, len(fields))
+	for _, field := range fields {
+		out[field.name] = field.value
+	}
+	return out
+}
+
+func (f *formatter) formatMapping(n *ast.MappingNode, s cue.Value) {
+	fields := schemaFields(s)
+	rank := make(map[string]int, len(fields))
+	schemas := make(map[string]cue.Value, len(fields))
+	for i, field := range fields {
+		rank[field.name] = i
+		schemas[field.name] = field.value
+	}
+
+	if !n.IsFlowStyle && len(fields) > 0 {
+		position := func(mv *ast.MappingValueNode, i int) int {
+			if r, ok := rank[mappingKey(mv)]; ok {
+				return r
+			}
+			return len(fields) + i
+		}
+		order := make(map[*ast.MappingValueNode]int, len(n.Values))
+		for i, mv := range n.Values {
+			order[mv] = position(mv, i)
+		}
+		sort.SliceStable(n.Values, func(i, j int) bool {
+			return order[n.Values[i]] < order[n.Values[j]]
+		})
+	}
+	for _, mv := range n.Values {
+		f.formatMappingValue(mv, schemas)
+	}
+}
+
+func (f *formatter) formatMappingValue(mv *ast.MappingValueNode, schemas map[string]cue.Value) {
+	if k, ok := mv.Key.(*ast.StringNode); ok {
+		f.requote(k)
+	}
+	name := mappingKey(mv)
+	indent := mv.Key.GetToken().Position.Column - 1 + 2
+	mv.Value = f.format(mv.Value, schemas[name], name, indent)
+}
+
+func (f *formatter) formatSequence(n *ast.SequenceNode, s cue.Value, key string) {
+	if unorderedIDLists[key] {
+		sortStringSequence(n)
+	}
+	elem := s.LookupPath(cue.MakePath(cue.AnyIndex))
+	indent := n.Start.Position.Column - 1 + 2
+	for i, value := range n.Values {
+		formatted := f.format(value, elem, "", indent)
+		n.Values[i] = formatted
+		if i < len(n.Entries) && n.Entries[i] != nil {
+			n.Entries[i].Value = formatted
+		}
+	}
+}
+
+// sortStringSequence sorts a sequence of plain or quoted strings, moving
+// each entry's comments with it. Sequences holding anything else are left
+// alone.
+func sortStringSequence(n *ast.SequenceNode) {
+	type entry struct {
+		value   ast.Node
+		comment *ast.CommentGroupNode
+		entry   *ast.SequenceEntryNode
+	}
+	entries := make([]entry, len(n.Values))
+	for i, value := range n.Values {
+		if _, ok := value.(*ast.StringNode); !ok {
+			return
+		}
+		entries[i].value = value
+		if i < len(n.ValueHeadComments) {
+			entries[i].comment = n.ValueHeadComments[i]
+		}
+		if i < len(n.Entries) {
+			entries[i].entry = n.Entries[i]
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].value.(*ast.StringNode).Value < entries[j].value.(*ast.StringNode).Value
+	})
+	for i, e := range entries {
+		n.Values[i] = e.value
+		if i < len(n.ValueHeadComments) {
+			n.ValueHeadComments[i] = e.comment
+		}
+		if i < len(n.Entries) {
+			n.Entries[i] = e.entry
+		}
+	}
+}
+
+// formatString renders a string scalar: long or multi-line text becomes a
+// block scalar, anything else a plain or double-quoted scalar.
+func (f *formatter) formatString(node ast.Node, value string, comment *ast.CommentGroupNode, indent int) ast.Node {
+	tk := node.GetToken()
+	if strings.Contains(value, "\n") || len(value) > f.width {
+		if block := f.blockScalar(tk, value, comment, indent); block != nil {
+			return block
+		}
+		if strings.Contains(value, "\n") {
+			return node
+		}
+	}
+
+	if n, ok := node.(*ast.StringNode); ok {
+		f.requote(n)
+		return n
+	}
+	n := ast.String(&token.Token{Type: token.StringType, Value: value, Origin: value, Position: tk.Position})
+	n.Comment = comment
+	f.requote(n)
+	return n
+}
+
+// blockScalar builds a block scalar for value: folded (>, >-) and wrapped
+// for long single-line text, literal (|, |-) otherwise. It returns nil when
+// value is better left as a flow scalar or cannot be written as a block
+// scalar without changing it.
+func (f *formatter) blockScalar(tk *token.Token, value string, comment *ast.CommentGroupNode, indent int) *ast.LiteralNode {
+	text := strings.TrimRight(value, "\n")
+	var chomp string
+	switch len(value) - len(text) {
+	case 0:
+		chomp = "-"
+	case 1:
+	default:
+		return nil
+	}
+	if text == "" || strings.HasPrefix(text, " ") || strings.Contains(text, "\r") {
+		return nil
+	}
+
+	header := "|" + chomp
+	lines := strings.Split(text, "\n")
+	if len(lines) == 1 && len(text) > f.width && !strings.Contains(text, "  ") && !strings.ContainsAny(text, "\t") && strings.TrimSpace(text) == text {
+		if wrapped := wrapWords(text, f.width-indent); len(wrapped) > 1 {
+			header, lines = ">"+chomp, wrapped
+		}
+	}
+	if len(lines) == 1 && chomp == "-" {
+		return nil
+	}
+
+	space := strings.Repeat(" ", indent)
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = space + line
+		}
+	}
+	origin := strings.Join(lines, "\n") + "\n"
+
+	position := *tk.Position
+	start := &token.Token{Type: token.LiteralType, Value: header, Origin: header, Position: &position}
+	if header[0] == '>' {
+		start.Type = token.FoldedType
+	}
+	block := ast.Literal(start)
+	block.Value = ast.String(&token.Token{Type: token.StringType, Value: value, Origin: origin, Position: &position})
+	block.Comment = comment
+	return block
+}
+
+// wrapWords splits text at single spaces into lines no longer than width
+// where possible; folding the lines back with spaces restores text.
+func wrapWords(text string, width int) []string {
+	if width < 40 {
+		width = 40
+	}
+	var lines []string
+	line := ""
+	for _, word := range strings.Split(text, " ") {
+		if line != "" && len(line)+1+len(word) > width {
+			lines = append(lines, line)
+			line = word
+			continue
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	return append(lines, line)
+}
+
+var (
+	numberLike  = regexp.MustCompile(`^[-+.]?[0-9]`)
+	specialLike = regexp.MustCompile(`^[-+]?\.(?i:inf|nan)$`)
+)
+
+// requote writes n plain unless YAML (or a reader that guesses types, such
+// as YAML 1.1 parsers or version-like values) needs it double-quoted.
+func (f *formatter) requote(n *ast.StringNode) {
+	switch n.Token.Type {
+	case token.StringType, token.SingleQuoteType, token.DoubleQuoteType:
+	default:
+		return
+	}
+	if strings.Contains(n.Value, "\n") {
+		return
+	}
+	if needsQuotes(n.Value) {
+		n.Token.Type = token.DoubleQuoteType
+	} else {
+		n.Token.Type = token.StringType
+	}
+}
+
+func needsQuotes(s string) bool {
+	if s == "" || numberLike.MatchString(s) || specialLike.MatchString(s) || s[0] == '{' || s[0] == '[' {
+		return true
+	}
+	out, err := yaml.Marshal(s)
+	if err != nil {
+		return true
+	}
+	return strings.TrimSuffix(string(out), "\n") != s
+}
+
+func mappingKey(mv *ast.MappingValueNode) string {
+	if k, ok := mv.Key.(*ast.StringNode); ok {
+		return k.Value
+	}
+	return mv.Key.GetToken().Value
+}
+
+func commentTokens(g *ast.CommentGroupNode) []*token.Token {
+	var out []*token.Token
+	for _, c := range g.Comments {
+		out = append(out, c.Token)
+	}
+	return out
+}
+
+// sameDocumentData guards against the formatter changing content: both
+// versions must decode to the same data once ID lists are sorted.
+func sameDocumentData(before, after []byte) error {
+	a, err := decodeDocument(before)
+	if err != nil {
+		return err
+	}
+	b, err := decodeDocument(after)
+	if err != nil {
+		return fmt.Errorf("formatted output does not parse: %w", err)
+	}
+	if !reflect.DeepEqual(comparableData(a, ""), comparableData(b, "")) {
+		x, _ := json.Marshal(comparableData(a, ""))
+		y, _ := json.Marshal(comparableData(b, ""))
+		return fmt.Errorf("formatted output changes the document data:\n%s\n%s", x, y)
+	}
+	return nil
+}
+
+// comparableData drops key order and sorts unordered ID lists.
+func comparableData(v interface{}, key string) interface{} {
+	switch d := v.(type) {
+	case yaml.MapSlice:
+		out := make(map[string]interface{}, len(d))
+		for _, item := range d {
+			k := fmt.Sprint(item.Key)
+			out[k] = comparableData(item.Value, k)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(d))
+		strs := unorderedIDLists[key]
+		for i, elem := range d {
+			out[i] = comparableData(elem, "")
+			if _, ok := elem.(string); !ok {
+				strs = false
+			}
+		}
+		if strs {
+			sort.Slice(out, func(i, j int) bool { return out[i].(string) < out[j].(string) })
+		}
+		return out
+	default:
+		return v
+	}
+}
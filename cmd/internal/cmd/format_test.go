@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+)
+
+func TestFormatYAML(t *testing.T) {
+	ctx := cuecontext.New()
+	schema, err := loadSchema(ctx, "../../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	def := schema.LookupPath(cue.ParsePath("#ControlCatalog"))
+
+	input, err := os.ReadFile("testdata/unformatted-control-catalog.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile("testdata/formatted-control-catalog.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := formatYAML(input, def, 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("formatYAML mismatch:\n--- got\n%s\n--- want\n%s", got, want)
+	}
+
+	again, err := formatYAML(got, def, 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(got) {
+		t.Errorf("formatYAML is not idempotent:\n%s", again)
+	}
+}
+
+func TestNeedsQuotes(t *testing.T) {
+	tests := map[string]bool{
+		"plain text": false,
+		"TLP:Clear":  false,
+		"1.1.0":      true,
+		"2022":       true,
+		"yes":        true,
+		"a: b":       true,
+		"x #y":       true,
+		"":           true,
+		"[not-flow]": true,
+	}
+	for s, want := range tests {
+		if got := needsQuotes(s); got != want {
+			t.Errorf("needsQuotes(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// frequency is the interval of an AssessmentPlan. Calendar units are kept
+// apart from clock time so that "monthly" and "annually" follow the calendar
+// rather than a fixed number of days.
+type frequency struct {
+	years, months, days int
+	clock               time.Duration
+}
+
+// errEventDriven reports a frequency that names a trigger ("every push",
+// "on demand") rather than an interval; such plans cannot go stale.
+var errEventDriven = errors.New("event-driven frequency has no interval")
+
+var (
+	isoDuration = regexp.MustCompile(`^p(?:(\d+)y)?(?:(\d+)m)?(?:(\d+)w)?(?:(\d+)d)?(?:t(?:(\d+)h)?(?:(\d+)m)?(?:(\d+)s)?)?$`)
+	everyPhrase = regexp.MustCompile(`^(?:every|once (?:a|an|per|every)) (?:(\d+|other) )?([a-z]+?)s?$`)
+	timesPhrase = regexp.MustCompile(`^(?:(\d+) times|twice) (?:a|an|per) ([a-z]+)$`)
+)
+
+// frequencyWords are the adverbs plans commonly use for their interval.
+var frequencyWords = map[string]frequency{
+	"hourly":        {clock: time.Hour},
+	"daily":         {days: 1},
+	"nightly":       {days: 1},
+	"weekly":        {days: 7},
+	"biweekly":      {days: 14},
+	"fortnightly":   {days: 14},
+	"monthly":       {months: 1},
+	"bimonthly":     {months: 2},
+	"quarterly":     {months: 3},
+	"semiannually":  {months: 6},
+	"semi-annually": {months: 6},
+	"biannually":    {months: 6},
+	"half-yearly":   {months: 6},
+	"annually":      {years: 1},
+	"yearly":        {years: 1},
+	"biennially":    {years: 2},
+}
+
+// frequencyUnits are the units of "every N <unit>" phrases.
+var frequencyUnits = map[string]frequency{
+	"hour":      {clock: time.Hour},
+	"day":       {days: 1},
+	"week":      {days: 7},
+	"fortnight": {days: 14},
+	"month":     {months: 1},
+	"quarter":   {months: 3},
+	"year":      {years: 1},
+}
+
+// eventTriggers are words that make a frequency event-driven.
+var eventTriggers = []string{"push", "commit", "merge", "release", "deploy", "deployment", "build", "change", "demand", "request", "continuous", "continuously", "real-time", "realtime"}
+
+// parseFrequency reads an AssessmentPlan frequency: an ISO 8601 duration
+// ("P90D", "P1Y", "PT12H") or a phrase such as "quarterly", "every 90
+// days", "every other week", "once a year", or "4 times a year". A leading
+// "at least" is ignored.
+func parseFrequency(s string) (frequency, error) {
+	text := strings.Join(strings.Fields(strings.ToLower(strings.TrimSuffix(strings.TrimSpace(s), "."))), " ")
+	text = strings.TrimPrefix(text, "at least ")
+	if text == "" {
+		return frequency{}, fmt.Errorf("empty frequency")
+	}
+
+	if m := isoDuration.FindStringSubmatch(text); m != nil {
+		n := make([]int, len(m))
+		for i, v := range m[1:] {
+			n[i+1], _ = strconv.Atoi(v)
+		}
+		f := frequency{
+			years:  n[1],
+			months: n[2],
+			days:   7*n[3] + n[4],
+			clock:  time.Duration(n[5])*time.Hour + time.Duration(n[6])*time.Minute + time.Duration(n[7])*time.Second,
+		}
+		if f.isZero() {
+			return frequency{}, fmt.Errorf("duration %q is zero", s)
+		}
+		return f, nil
+	}
+	if f, ok := frequencyWords[text]; ok {
+		return f, nil
+	}
+	if m := everyPhrase.FindStringSubmatch(text); m != nil {
+		unit, ok := frequencyUnits[m[2]]
+		if !ok {
+			if containsString(eventTriggers, m[2]) {
+				return frequency{}, errEventDriven
+			}
+			return frequency{}, fmt.Errorf("unknown unit %q in frequency %q", m[2], s)
+		}
+		n := 1
+		switch m[1] {
+		case "":
+		case "other":
+			n = 2
+		default:
+			n, _ = strconv.Atoi(m[1])
+		}
+		if n == 0 {
+			return frequency{}, fmt.Errorf("frequency %q is zero", s)
+		}
+		return unit.times(n), nil
+	}
+	if m := timesPhrase.FindStringSubmatch(text); m != nil {
+		n := 2
+		if m[1] != "" {
+			n, _ = strconv.Atoi(m[1])
+		}
+		if f, ok := timesPer(n, m[2]); ok {
+			return f, nil
+		}
+		return frequency{}, fmt.Errorf("cannot divide a %s into %d intervals", m[2], n)
+	}
+	for _, word := range strings.Fields(text) {
+		if containsString(eventTriggers, word) {
+			return frequency{}, errEventDriven
+		}
+	}
+	return frequency{}, fmt.Errorf("unrecognized frequency %q (expected an ISO 8601 duration or a phrase such as \"quarterly\" or \"every 90 days\")", s)
+}
+
+// timesPer is the interval of n evaluations per unit, when it divides
+// evenly into months, days, or hours.
+func timesPer(n int, unit string) (frequency, bool) {
+	switch {
+	case n <= 0:
+		return frequency{}, false
+	case unit == "year" && 12%n == 0:
+		return frequency{months: 12 / n}, true
+	case unit == "month" && n == 1:
+		return frequency{months: 1}, true
+	case unit == "week" && 7%n == 0:
+		return frequency{days: 7 / n}, true
+	case unit == "day" && 24%n == 0:
+		return frequency{clock: time.Duration(24/n) * time.Hour}, true
+	}
+	return frequency{}, false
+}
+
+func (f frequency) times(n int) frequency {
+	return frequency{years: f.years * n, months: f.months * n, days: f.days * n, clock: f.clock * time.Duration(n)}
+}
+
+func (f frequency) isZero() bool {
+	return f == frequency{}
+}
+
+// due is when evidence collected at t goes stale. Years and months keep
+// the day of the month, clamped to the end of shorter months: monthly
+// evidence from January 31 is due on February 28, not March 3 as AddDate
+// would have it.
+func (f frequency) due(t time.Time) time.Time {
+	if months := f.years*12 + f.months; months != 0 {
+		y, m, d := t.Date()
+		first := time.Date(y, m+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+		if last := first.AddDate(0, 1, -1).Day(); d > last {
+			d = last
+		}
+		t = first.AddDate(0, 0, d-1)
+	}
+	return t.AddDate(0, 0, f.days).Add(f.clock)
+}
@@ -0,0 +1,58 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseFrequency(t *testing.T) {
+	start := time.Date(2026, 1, 31, 12, 0, 0, 0, time.UTC)
+	day := func(y int, m time.Month, d, h int) time.Time { return time.Date(y, m, d, h, 0, 0, 0, time.UTC) }
+	for _, tc := range []struct {
+		in   string
+		want time.Time
+	}{
+		{"P90D", day(2026, time.May, 1, 12)},
+		{"p1y2m", day(2027, time.March, 31, 12)},
+		{"P1M", day(2026, time.February, 28, 12)},
+		{"P1M1D", day(2026, time.March, 1, 12)},
+		{"P2W", day(2026, time.February, 14, 12)},
+		{"PT12H", day(2026, time.February, 1, 0)},
+		{"Quarterly", day(2026, time.April, 30, 12)},
+		{"at least annually.", day(2027, time.January, 31, 12)},
+		{"every 90 days", day(2026, time.May, 1, 12)},
+		{"every other week", day(2026, time.February, 14, 12)},
+		{"every month", day(2026, time.February, 28, 12)},
+		{"once a year", day(2027, time.January, 31, 12)},
+		{"4 times a year", day(2026, time.April, 30, 12)},
+		{"twice a day", day(2026, time.February, 1, 0)},
+	} {
+		f, err := parseFrequency(tc.in)
+		if err != nil {
+			t.Errorf("parseFrequency(%q): %v", tc.in, err)
+			continue
+		}
+		if got := f.due(start); !got.Equal(tc.want) {
+			t.Errorf("parseFrequency(%q) is due %v, want %v", tc.in, got, tc.want)
+		}
+	}
+
+	leap := time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)
+	if got := (frequency{years: 1}).due(leap); !got.Equal(time.Date(2029, 2, 28, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("annual evidence from 2028-02-29 is due %v, want 2029-02-28", got)
+	}
+
+	for _, in := range []string{"every push", "on every commit to main", "on demand", "continuously"} {
+		if _, err := parseFrequency(in); !errors.Is(err, errEventDriven) {
+			t.Errorf("parseFrequency(%q) = %v, want event-driven", in, err)
+		}
+	}
+	for _, in := range []string{"", "P", "P0D", "every 0 days", "every eon", "5 times a year", "sometimes"} {
+		if _, err := parseFrequency(in); err == nil || errors.Is(err, errEventDriven) {
+			t.Errorf("parseFrequency(%q) = %v, want an error", in, err)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/spf13/cobra"
+)
+
+var freshnessCmd = &cobra.Command{
+	Use:   "freshness [policy] [logs-or-directories...]",
+	Short: "Flag assessment plans whose latest evaluation or evidence is stale",
+	Long: `Check each assessment plan of a Policy against its frequency: the latest
+evaluation of the plan's requirement, or the latest audit evidence for it,
+must be more recent than one interval before --at (default: now).
+
+  evidence-freshness  The requirement was last evaluated or evidenced longer
+                      ago than its frequency allows, or not at all.
+  plan-frequency      The frequency could not be read (warning).
+
+Evaluations are the assessment logs of EvaluationLogs that ran the
+requirement (Not Run does not count) and either name the plan or no plan;
+they are dated by their start. Evidence is the collected time of AuditLog
+results whose criteria reference the requirement or its control.
+
+Frequencies are ISO 8601 durations (P90D, P1Y, PT12H) or phrases such as
+daily, quarterly, annually, "every 90 days", "every other week", "once a
+month", or "4 times a year". Event-driven frequencies ("every push", "on
+demand") have no interval and are not checked.
+
+Directories are searched recursively. Logs must share a target unless
+--target selects one. Warnings only fail the run with --strict.`,
+	Args:          cobra.MinimumNArgs(2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE:          runFreshness,
+}
+
+var freshnessFlags struct {
+	format     string
+	outputPath string
+	at         string
+	target     string
+	mirrorDir  string
+	cacheDir   string
+	fetch      bool
+	strict     bool
+}
+
+func newFreshnessCmd() *cobra.Command {
+	freshnessCmd.Flags().StringVarP(&freshnessFlags.format, "format", "f", "text", "Output format: text, json, sarif, or github")
+	freshnessCmd.Flags().StringVarP(&freshnessFlags.outputPath, "output", "o", "", "Write the report to a file instead of stdout")
+	freshnessCmd.Flags().StringVar(&freshnessFlags.at, "at", "", "Check freshness as of this time, RFC 3339 or YYYY-MM-DD (default: now)")
+	freshnessCmd.Flags().StringVar(&freshnessFlags.target, "target", "", "Check only the logs of this target id")
+	freshnessCmd.Flags().StringVar(&freshnessFlags.mirrorDir, "mirror", "", "Read-only directory mirroring http(s) artifacts as host/path")
+	freshnessCmd.Flags().StringVar(&freshnessFlags.cacheDir, "cache", "", "Directory where downloaded http(s) artifacts are cached")
+	freshnessCmd.Flags().BoolVar(&freshnessFlags.fetch, "fetch", false, "Download http(s) artifacts missing from the mirror and cache")
+	freshnessCmd.Flags().BoolVar(&freshnessFlags.strict, "strict", false, "Fail on warnings as well as errors")
+	return freshnessCmd
+}
+
+func runFreshness(cmd *cobra.Command, args []string) error {
+	policyFile := args[0]
+	at := time.Now()
+	if freshnessFlags.at != "" {
+		t, err := parsePeriodBound(freshnessFlags.at, false)
+		if err != nil {
+			return fmt.Errorf("invalid --at: %w", err)
+		}
+		at = t
+	}
+
+	policy, err := readDocument(policyFile)
+	if err != nil {
+		return err
+	}
+	if typ := mapString(mapMap(policy, "metadata"), "type"); typ != "Policy" {
+		return fmt.Errorf("%s is a %s, expected a Policy", policyFile, typ)
+	}
+	logs, err := collectLogs(args[1:], "EvaluationLog", "AuditLog")
+	if err != nil {
+		return err
+	}
+	var kept []datedLog
+	target := freshnessFlags.target
+	for _, l := range logs {
+		id := mapString(mapMap(l.Doc, "target"), "id")
+		if freshnessFlags.target != "" && id != freshnessFlags.target {
+			continue
+		}
+		if target == "" {
+			target = id
+		} else if id != target {
+			return fmt.Errorf("logs evaluate both %q and %q (select one with --target)", target, id)
+		}
+		kept = append(kept, l)
+	}
+
+	resolver := newArtifactResolver(freshnessFlags.mirrorDir, freshnessFlags.cacheDir, freshnessFlags.fetch)
+	effective, src, err := compilePolicyFile(policyFile, policy, resolver)
+	if err != nil {
+		return err
+	}
+
+	result := ValidationResult{File: policyFile, Definition: "evidence freshness"}
+	result.Diagnostics = checkFreshness(policyFile, policy, src, effective, kept, at)
+	result.Valid = !hasErrors(result.Diagnostics)
+	if err := writeReport(freshnessFlags.outputPath, func(w io.Writer) error {
+		return writeDiagnostics(w, freshnessFlags.format, []ValidationResult{result})
+	}); err != nil {
+		return err
+	}
+	if !result.Valid || (freshnessFlags.strict && len(result.Diagnostics) > 0) {
+		return fmt.Errorf("%d stale or unreadable assessment plan(s)", len(result.Diagnostics))
+	}
+	return nil
+}
+
+// freshnessCheck checks the assessment plans of one Policy.
+type freshnessCheck struct {
+	file  string
+	src   *artifactSource
+	diags []Diagnostic
+}
+
+// lastEvidence is the most recent evaluation or evidence of a requirement.
+type lastEvidence struct {
+	Time   time.Time
+	Log    string
+	Audit  bool
+	Result string
+}
+
+// checkFreshness returns the freshness diagnostics for the assessment plans
+// of the Policy doc as of at.
+func checkFreshness(file string, doc yaml.MapSlice, src *artifactSource, effective *effectivePolicy, logs []datedLog, at time.Time) []Diagnostic {
+	c := &freshnessCheck{file: file, src: src}
+	for i, plan := range listMaps(mapList(mapMap(doc, "adherence"), "assessment-plans")) {
+		path := []string{"adherence", "assessment-plans", strconv.Itoa(i)}
+		id, req, text := mapString(plan, "id"), mapString(plan, "requirement-id"), mapString(plan, "frequency")
+		freq, err := parseFrequency(text)
+		if errors.Is(err, errEventDriven) {
+			continue
+		}
+		if err != nil {
+			c.report(rulePlanFrequency, severityWarning, appendPath(path, "frequency"), text,
+				fmt.Sprintf("plan %s: %v", id, err))
+			continue
+		}
+
+		last, ok := latestEvidence(logs, id, req, requirementControl(effective, req))
+		if !ok {
+			c.report(ruleEvidenceFreshness, severityError, appendPath(path, "requirement-id"), req,
+				fmt.Sprintf("%s has no evaluation or evidence in the given logs (plan %s, frequency %s)", req, id, text))
+			continue
+		}
+		if due := freq.due(last.Time); due.Before(at) {
+			what := fmt.Sprintf("last evaluated (%s)", last.Result)
+			if last.Audit {
+				what = "last evidenced"
+			}
+			c.report(ruleEvidenceFreshness, severityError, appendPath(path, "requirement-id"), req,
+				fmt.Sprintf("%s was %s on %s in %s; under plan %s (%s) it was due again by %s",
+					req, what, last.Time.UTC().Format("2006-01-02"), last.Log, id, text, due.UTC().Format("2006-01-02")))
+		}
+	}
+	sortDiagnostics(c.diags)
+	return c.diags
+}
+
+// requirementControl is the id of the compiled control that defines
+// requirement, if any.
+func requirementControl(effective *effectivePolicy, requirement string) string {
+	for _, cat := range effective.Catalogs {
+		for _, ctl := range cat.Controls {
+			if ctl.requirement(requirement) >= 0 {
+				return ctl.ID
+			}
+		}
+	}
+	return ""
+}
+
+// latestEvidence finds the most recent evaluation of requirement under
+// plan, or audit evidence for requirement or its control.
+func latestEvidence(logs []datedLog, plan, requirement, control string) (lastEvidence, bool) {
+	var last lastEvidence
+	consider := func(t time.Time, log string, audit bool, result string) {
+		if t.After(last.Time) {
+			last = lastEvidence{Time: t, Log: log, Audit: audit, Result: result}
+		}
+	}
+	for _, l := range logs {
+		switch mapString(mapMap(l.Doc, "metadata"), "type") {
+		case "EvaluationLog":
+			for _, eval := range listMaps(mapList(l.Doc, "evaluations")) {
+				for _, a := range listMaps(mapList(eval, "assessment-logs")) {
+					if mapString(mapMap(a, "requirement"), "entry-id") != requirement || mapString(a, "result") == "Not Run" {
+						continue
+					}
+					if p := mapString(mapMap(a, "plan"), "entry-id"); p != "" && p != plan {
+						continue
+					}
+					t, ok := timeValue(a, "start")
+					if !ok {
+						t = l.Date
+					}
+					consider(t, l.id(), false, mapString(a, "result"))
+				}
+			}
+		case "AuditLog":
+			for _, r := range listMaps(mapList(l.Doc, "results")) {
+				cited := false
+				for _, e := range listMaps(mapList(mapMap(r, "criteria-reference"), "entries")) {
+					if id := mapString(e, "reference-id"); id == requirement || (control != "" && id == control) {
+						cited = true
+					}
+				}
+				if !cited {
+					continue
+				}
+				for _, e := range listMaps(mapList(r, "evidence")) {
+					if t, ok := timeValue(e, "collected"); ok {
+						consider(t, l.id(), true, "")
+					}
+				}
+			}
+		}
+	}
+	return last, !last.Time.IsZero()
+}
+
+func (c *freshnessCheck) report(rule, severity string, path []string, value, msg string) {
+	c.diags = append(c.diags, diagnosticAt(c.file, c.src, rule, severity, path, value, msg))
+}
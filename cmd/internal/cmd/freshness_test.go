@@ -0,0 +1,70 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func freshnessDiagnostics(t *testing.T, at time.Time, logFiles ...string) map[string]Diagnostic {
+	t.Helper()
+	file := "testdata/freshness-policy.yaml"
+	policy, err := readDocument(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	effective, diags := compilePolicy(file, policy, nil, newArtifactResolver("", "", false))
+	if hasErrors(diags) {
+		t.Fatalf("policy does not compile: %+v", diags)
+	}
+	logs, err := collectLogs(logFiles, "EvaluationLog", "AuditLog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	byPath := make(map[string]Diagnostic)
+	for _, d := range checkFreshness(file, policy, nil, effective, logs, at) {
+		byPath[d.Path] = d
+	}
+	return byPath
+}
+
+func TestCheckFreshness(t *testing.T) {
+	at := time.Date(2026, 2, 20, 0, 0, 0, 0, time.UTC)
+	diags := freshnessDiagnostics(t, at,
+		"testdata/disposition-evaluation-log.yaml",
+		"testdata/audit-evaluation-log.yaml",
+		"testdata/freshness-audit-log.yaml")
+
+	if len(diags) != 2 {
+		t.Errorf("got %d diagnostics, want 2: %+v", len(diags), diags)
+	}
+	if d := diags[`adherence."assessment-plans"[2].frequency`]; d.Rule != rulePlanFrequency || d.Severity != severityWarning {
+		t.Errorf("unreadable frequency: %+v", d)
+	}
+	d := diags[`adherence."assessment-plans"[3]."requirement-id"`]
+	if d.Rule != ruleEvidenceFreshness || !strings.Contains(d.Message, "due again by 2026-01-19") {
+		t.Errorf("stale LV-02.AR01: %+v", d)
+	}
+	// LV-03.AR01 was last evaluated on 2026-01-12, but the audit evidence of
+	// 2026-02-10 keeps its 30 day plan fresh.
+	if d, ok := diags[`adherence."assessment-plans"[4]."requirement-id"`]; ok {
+		t.Errorf("LV-03.AR01 is fresh through audit evidence: %+v", d)
+	}
+}
+
+func TestCheckFreshnessMissing(t *testing.T) {
+	at := time.Date(2026, 1, 13, 0, 0, 0, 0, time.UTC)
+	diags := freshnessDiagnostics(t, at, "testdata/audit-evaluation-log.yaml")
+
+	for _, i := range []string{"0", "1"} {
+		d := diags[`adherence."assessment-plans"[`+i+`]."requirement-id"`]
+		if d.Rule != ruleEvidenceFreshness || !strings.Contains(d.Message, "no evaluation or evidence") {
+			t.Errorf("plan %s: %+v", i, d)
+		}
+	}
+	if d, ok := diags[`adherence."assessment-plans"[3]."requirement-id"`]; ok {
+		t.Errorf("LV-02.AR01 is fresh on 2026-01-13: %+v", d)
+	}
+}
@@ -0,0 +1,277 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/goccy/go-yaml"
+	"github.com/spf13/cobra"
+)
+
+var lintCmd = &cobra.Command{
+	Use:   "lint [files...]",
+	Short: "Check lifecycle states and replaced-by chains across artifacts",
+	Long: `Check the lifecycle of controls, assessment requirements, and guidelines:
+
+  lifecycle-replacement  Deprecated and Retired entries should have a
+                         replaced-by that resolves to a real entry.
+  lifecycle-chain        Following replaced-by must not cycle or end at a
+                         Retired entry.
+  lifecycle-reference    Active controls should not reference Retired
+                         threats or guidelines.
+  lifecycle-draft        Draft entries must not appear in artifacts whose
+                         metadata.draft is not true.
+
+Referenced artifacts are resolved as by validate --references: file:// urls
+directly, http(s) urls through --mirror or --cache, and local paths through
+--workspace. Warnings only fail the run with --strict.`,
+	Args:          lintArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE:          runLint,
+}
+
+var lintFlags struct {
+	format     string
+	outputPath string
+	workspace  string
+	mirrorDir  string
+	cacheDir   string
+	fetch      bool
+	strict     bool
+}
+
+// lifecycleCollections are the entry lists that carry state and
+// replaced-by.
+var lifecycleCollections = map[string]bool{
+	"controls":                true,
+	"assessment-requirements": true,
+	"guidelines":              true,
+}
+
+func newLintCmd() *cobra.Command {
+	lintCmd.Flags().StringVarP(&lintFlags.format, "format", "f", "text", "Output format: text, json, sarif, or github")
+	lintCmd.Flags().StringVarP(&lintFlags.outputPath, "output", "o", "", "Write the report to a file instead of stdout")
+	lintCmd.Flags().StringVar(&lintFlags.workspace, "workspace", "", "Lint the artifacts of a workspace manifest (gemara.work.yaml or its directory)")
+	lintCmd.Flags().StringVar(&lintFlags.mirrorDir, "mirror", "", "Read-only directory mirroring http(s) artifacts as host/path")
+	lintCmd.Flags().StringVar(&lintFlags.cacheDir, "cache", "", "Directory where downloaded http(s) artifacts are cached")
+	lintCmd.Flags().BoolVar(&lintFlags.fetch, "fetch", false, "Download http(s) artifacts missing from the mirror and cache")
+	lintCmd.Flags().BoolVar(&lintFlags.strict, "strict", false, "Fail on warnings as well as errors")
+	return lintCmd
+}
+
+func lintArgs(cmd *cobra.Command, args []string) error {
+	if lintFlags.workspace != "" {
+		return nil
+	}
+	return cobra.MinimumNArgs(1)(cmd, args)
+}
+
+func runLint(cmd *cobra.Command, args []string) error {
+	var (
+		resolver *artifactResolver
+		results  []ValidationResult
+		files    = args
+		err      error
+	)
+	if lintFlags.workspace != "" {
+		var problems *ValidationResult
+		files, resolver, problems, err = openWorkspace(lintFlags.workspace, lintFlags.mirrorDir, lintFlags.cacheDir, lintFlags.fetch, args)
+		if err != nil {
+			return err
+		}
+		if problems != nil {
+			results = append(results, *problems)
+		}
+	} else {
+		resolver = newArtifactResolver(lintFlags.mirrorDir, lintFlags.cacheDir, lintFlags.fetch)
+	}
+
+	ctx := cuecontext.New()
+	for _, file := range files {
+		result := ValidationResult{File: file, Definition: "lifecycle rules"}
+		doc, err := readDocument(file)
+		if err != nil {
+			result.Diagnostics = fileDiagnostics(err, file, ruleSyntax)
+			results = append(results, result)
+			continue
+		}
+		src, err := loadArtifactSource(ctx, file)
+		if err != nil {
+			src = nil
+		}
+		result.Diagnostics = lintLifecycle(file, doc, src, resolver)
+		result.Valid = !hasErrors(result.Diagnostics)
+		results = append(results, result)
+	}
+
+	if err := writeReport(lintFlags.outputPath, func(w io.Writer) error {
+		return writeDiagnostics(w, lintFlags.format, results)
+	}); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, r := range results {
+		if !r.Valid || (lintFlags.strict && len(r.Diagnostics) > 0) {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d artifact(s) failed lint", failed, len(results))
+	}
+	return nil
+}
+
+// lifecycleEntry is an entry of the linted artifact that has a lifecycle.
+type lifecycleEntry struct {
+	ID         string
+	Collection string
+	Path       []string
+	Value      yaml.MapSlice
+}
+
+// lifecycleLint runs the lifecycle rules over one artifact.
+type lifecycleLint struct {
+	file     string
+	src      *artifactSource
+	resolver *artifactResolver
+	self     *entryIndex
+	diags    []Diagnostic
+}
+
+// lintLifecycle returns the lifecycle diagnostics for doc.
+func lintLifecycle(file string, doc yaml.MapSlice, src *artifactSource, resolver *artifactResolver) []Diagnostic {
+	l := &lifecycleLint{file: file, src: src, resolver: resolver, self: indexEntries(doc)}
+	l.self.Dir = filepath.Dir(file)
+
+	for _, e := range lifecycleEntries(doc) {
+		state := l.self.state(e.ID)
+		if state == "Draft" && !l.self.Draft {
+			l.report(ruleLifecycleDraft, severityError, appendPath(e.Path, "state"), state,
+				fmt.Sprintf("%s is Draft but the artifact is not (set metadata.draft: true or promote the entry)", e.ID))
+		}
+		l.checkReplacement(e, state)
+		if e.Collection == "controls" && state == "Active" {
+			l.checkReferencedStates(e)
+		}
+	}
+	sortDiagnostics(l.diags)
+	return l.diags
+}
+
+// lifecycleEntries lists controls, their assessment requirements, and
+// guidelines with their paths.
+func lifecycleEntries(doc yaml.MapSlice) []lifecycleEntry {
+	var out []lifecycleEntry
+	var walk func(m yaml.MapSlice, path []string)
+	walk = func(m yaml.MapSlice, path []string) {
+		for _, item := range m {
+			key := fmt.Sprint(item.Key)
+			if !lifecycleCollections[key] {
+				continue
+			}
+			list, _ := item.Value.([]interface{})
+			for i, elem := range list {
+				entry, ok := elem.(yaml.MapSlice)
+				if !ok || mapString(entry, "id") == "" {
+					continue
+				}
+				p := appendPath(path, key, strconv.Itoa(i))
+				out = append(out, lifecycleEntry{ID: mapString(entry, "id"), Collection: key, Path: p, Value: entry})
+				walk(entry, p)
+			}
+		}
+	}
+	walk(doc, nil)
+	return out
+}
+
+func (l *lifecycleLint) checkReplacement(e lifecycleEntry, state string) {
+	rb, ok := l.self.ReplacedBy[e.ID]
+	if !ok {
+		if state == "Deprecated" || state == "Retired" {
+			l.report(ruleLifecycleReplacement, severityWarning, appendPath(e.Path, "state"), state,
+				fmt.Sprintf("%s is %s but has no replaced-by", e.ID, state))
+		}
+		return
+	}
+
+	path := appendPath(e.Path, "replaced-by")
+	chain := []string{l.self.ID + "/" + e.ID}
+	seen := map[string]bool{chain[0]: true}
+	idx, id := l.self, e.ID
+	for {
+		next, err := l.resolver.follow(idx, rb.RefID)
+		if err != nil {
+			severity := severityWarning
+			if idx == l.self && !l.declared(rb.RefID) {
+				severity = severityError
+			}
+			l.report(ruleLifecycleReplacement, severity, appendPath(path, "reference-id"), rb.RefID,
+				fmt.Sprintf("cannot resolve replaced-by of %s: %v", id, err))
+			return
+		}
+		if _, ok := next.Entries[rb.EntryID]; !ok {
+			l.report(ruleLifecycleReplacement, severityError, appendPath(path, "entry-id"), rb.EntryID,
+				fmt.Sprintf("replaced-by of %s names %q, which is not an entry of %s", id, rb.EntryID, rb.RefID))
+			return
+		}
+
+		key := next.ID + "/" + rb.EntryID
+		chain = append(chain, key)
+		if seen[key] {
+			l.report(ruleLifecycleChain, severityError, path, rb.EntryID,
+				fmt.Sprintf("replaced-by chain cycles: %s", strings.Join(chain, " -> ")))
+			return
+		}
+		seen[key] = true
+
+		idx, id = next, rb.EntryID
+		if rb, ok = idx.ReplacedBy[id]; !ok {
+			if idx.state(id) == "Retired" {
+				l.report(ruleLifecycleChain, severityError, path, id,
+					fmt.Sprintf("replaced-by chain ends at Retired entry: %s", strings.Join(chain, " -> ")))
+			}
+			return
+		}
+	}
+}
+
+// checkReferencedStates flags an Active control that maps to Retired
+// threats or guidelines.
+func (l *lifecycleLint) checkReferencedStates(e lifecycleEntry) {
+	for _, key := range []string{"threats", "guidelines"} {
+		for i, mapping := range listMaps(mapList(e.Value, key)) {
+			refID := mapString(mapping, "reference-id")
+			idx, err := l.resolver.follow(l.self, refID)
+			if err != nil {
+				// Unresolvable references are validate --references' job.
+				continue
+			}
+			for j, entry := range listMaps(mapList(mapping, "entries")) {
+				id := mapString(entry, "reference-id")
+				if _, ok := idx.Entries[id]; ok && idx.state(id) == "Retired" {
+					l.report(ruleLifecycleReference, severityWarning,
+						appendPath(e.Path, key, strconv.Itoa(i), "entries", strconv.Itoa(j), "reference-id"), id,
+						fmt.Sprintf("Active control %s references Retired %s %s in %s", e.ID, strings.TrimSuffix(key, "s"), id, refID))
+				}
+			}
+		}
+	}
+}
+
+func (l *lifecycleLint) declared(refID string) bool {
+	_, ok := l.self.URLs[refID]
+	return ok || refID == l.self.ID
+}
+
+func (l *lifecycleLint) report(rule, severity string, path []string, value, msg string) {
+	l.diags = append(l.diags, diagnosticAt(l.file, l.src, rule, severity, path, value, msg))
+}
@@ -0,0 +1,55 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import "testing"
+
+func TestLintLifecycle(t *testing.T) {
+	file := "testdata/lifecycle-control-catalog.yaml"
+	doc, err := readDocument(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diags := lintLifecycle(file, doc, nil, newArtifactResolver("", "", false))
+
+	want := map[string]string{
+		`controls[0].guidelines[0].entries[1]."reference-id"`: ruleLifecycleReference,
+		`controls[1].state`:                    ruleLifecycleReplacement,
+		`controls[2]."replaced-by"`:            ruleLifecycleChain,
+		`controls[3]."replaced-by"`:            ruleLifecycleChain,
+		`controls[4]."replaced-by"`:            ruleLifecycleChain,
+		`controls[5].state`:                    ruleLifecycleReplacement,
+		`controls[6].state`:                    ruleLifecycleDraft,
+		`controls[7]."replaced-by"."entry-id"`: ruleLifecycleReplacement,
+	}
+	for _, d := range diags {
+		rule, ok := want[d.Path]
+		if !ok {
+			t.Errorf("unexpected diagnostic at %s: %s", d.Path, d.Message)
+			continue
+		}
+		if d.Rule != rule {
+			t.Errorf("%s: rule %s, want %s", d.Path, d.Rule, rule)
+		}
+		delete(want, d.Path)
+	}
+	for path := range want {
+		t.Errorf("missing diagnostic at %s", path)
+	}
+}
+
+func TestLintLifecycleDraftArtifact(t *testing.T) {
+	file := "testdata/lifecycle-control-catalog.yaml"
+	doc, err := readDocument(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc = mapSet(doc, "metadata", mapSet(mapMap(doc, "metadata"), "draft", true))
+
+	for _, d := range lintLifecycle(file, doc, nil, newArtifactResolver("", "", false)) {
+		if d.Rule == ruleLifecycleDraft {
+			t.Errorf("draft entries are allowed in a draft artifact: %s", d.Message)
+		}
+	}
+}
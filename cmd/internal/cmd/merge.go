@@ -0,0 +1,376 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/spf13/cobra"
+)
+
+var mergeCmd = &cobra.Command{
+	Use:   "merge [logs...]",
+	Short: "Combine EvaluationLogs of one target into a consolidated log",
+	Long: `Combine the EvaluationLogs that several evaluators produced for the same
+target into one log:
+
+  - control evaluations are de-duplicated by their control entry mapping;
+  - assessment logs are de-duplicated by requirement (and plan); when more
+    than one log assessed a requirement, --strategy picks the one to keep:
+      worst       the worst result wins (Failed > Needs Review > Unknown >
+                  Passed > Not Applicable > Not Run), then the latest;
+      latest      the assessment that ended (or started) last wins, then
+                  the worst;
+      confidence  the highest confidence-level wins, then the worst;
+  - control and log results are recomputed from the kept assessments as by
+    results --fix.
+
+Every input log is listed in metadata.mapping-references, and each kept
+assessment's message is prefixed with the id of the log it came from.
+Conflicting results are reported on stderr.
+
+All logs must evaluate the same target unless --target selects one; logs of
+other targets are then skipped. The merged log is validated before it is
+written.`,
+	Args:          cobra.MinimumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE:          runMerge,
+}
+
+var mergeFlags struct {
+	schemaDir  string
+	strategy   string
+	target     string
+	id         string
+	format     string
+	outputPath string
+}
+
+// confidenceRank orders confidence levels; a missing level ranks lowest.
+var confidenceRank = map[string]int{
+	"Undetermined": 1,
+	"Low":          2,
+	"Medium":       3,
+	"High":         4,
+}
+
+func newMergeCmd() *cobra.Command {
+	mergeCmd.Flags().StringVarP(&mergeFlags.schemaDir, "schema", "s", "..", "Path to the CUE package directory")
+	mergeCmd.Flags().StringVar(&mergeFlags.strategy, "strategy", "worst", "Conflict resolution: worst, latest, or confidence")
+	mergeCmd.Flags().StringVar(&mergeFlags.target, "target", "", "Merge only the logs of this target id")
+	mergeCmd.Flags().StringVar(&mergeFlags.id, "id", "", "metadata.id of the merged log (default: <target id>-merged)")
+	mergeCmd.Flags().StringVarP(&mergeFlags.format, "format", "f", "", "Output format: yaml or json (default: from the output or first input extension)")
+	mergeCmd.Flags().StringVarP(&mergeFlags.outputPath, "output", "o", "", "Output path for the merged log (default: stdout)")
+	return mergeCmd
+}
+
+func runMerge(cmd *cobra.Command, args []string) error {
+	switch mergeFlags.strategy {
+	case "worst", "latest", "confidence":
+	default:
+		return fmt.Errorf("unsupported --strategy %q (expected worst, latest, or confidence)", mergeFlags.strategy)
+	}
+
+	var logs []sourceLog
+	for _, file := range args {
+		doc, err := readDocument(file)
+		if err != nil {
+			return err
+		}
+		if typ := mapString(mapMap(doc, "metadata"), "type"); typ != "EvaluationLog" {
+			return fmt.Errorf("%s is a %s, expected an EvaluationLog", file, typ)
+		}
+		target := mapString(mapMap(doc, "target"), "id")
+		if mergeFlags.target != "" && target != mergeFlags.target {
+			fmt.Fprintf(os.Stderr, "%s: skipped, it evaluates target %q\n", file, target)
+			continue
+		}
+		logs = append(logs, sourceLog{File: file, Doc: doc})
+	}
+	if len(logs) == 0 {
+		return fmt.Errorf("no EvaluationLog evaluates target %q", mergeFlags.target)
+	}
+
+	merged, err := mergeLogs(logs, mergeFlags.strategy, mergeFlags.id, outputDir(mergeFlags.outputPath))
+	for _, note := range merged.notes {
+		fmt.Fprintln(os.Stderr, note)
+	}
+	if err != nil {
+		return err
+	}
+
+	out := mergeFlags.outputPath
+	format := outputFormat(mergeFlags.format, out, args[0])
+	data, err := encodeDocument(merged.doc, format)
+	if err != nil {
+		return err
+	}
+	if err := writeGenerated(mergeFlags.schemaDir, "", out, "merged."+format, data); err != nil {
+		return fmt.Errorf("merged log: %w", err)
+	}
+	return nil
+}
+
+// sourceLog is an EvaluationLog given to merge.
+type sourceLog struct {
+	File string
+	Doc  yaml.MapSlice
+}
+
+func (l sourceLog) id() string {
+	return mapString(mapMap(l.Doc, "metadata"), "id")
+}
+
+// mergedLog is the consolidated EvaluationLog.
+type mergedLog struct {
+	doc   yaml.MapSlice
+	notes []string
+}
+
+// mergedControl collects the control evaluations of one control.
+type mergedControl struct {
+	evals       []yaml.MapSlice
+	assessments []*mergedAssessment
+	byKey       map[string]*mergedAssessment
+}
+
+// mergedAssessment is the assessment log kept for one requirement.
+type mergedAssessment struct {
+	log    yaml.MapSlice
+	source string
+}
+
+// provenancePrefix matches the prefix provenance adds, so that merging a
+// merged log keeps naming the log an assessment first came from.
+var provenancePrefix = regexp.MustCompile(`^From [^\s:]+: `)
+
+// provenance returns the assessment log with its message prefixed by the
+// id of the log it came from.
+func (a *mergedAssessment) provenance() yaml.MapSlice {
+	message := mapString(a.log, "message")
+	if provenancePrefix.MatchString(message) {
+		return a.log
+	}
+	log := append(yaml.MapSlice(nil), a.log...)
+	return mapSet(log, "message", "From "+a.source+": "+message)
+}
+
+// mergeLogs combines logs, which must share a target, resolving conflicting
+// assessments with strategy. id names the merged log, and outDir is where
+// it will be written.
+func mergeLogs(logs []sourceLog, strategy, id, outDir string) (*mergedLog, error) {
+	m := &mergedLog{}
+	target := mapMap(logs[0].Doc, "target")
+	for _, l := range logs[1:] {
+		if other := mapString(mapMap(l.Doc, "target"), "id"); other != mapString(target, "id") {
+			return m, fmt.Errorf("%s evaluates target %q but %s evaluates %q (select one with --target)",
+				logs[0].File, mapString(target, "id"), l.File, other)
+		}
+	}
+
+	controls := make(map[string]*mergedControl)
+	var order []string
+	for _, l := range logs {
+		for _, eval := range listMaps(mapList(l.Doc, "evaluations")) {
+			control := mapMap(eval, "control")
+			refID := mapString(control, "reference-id")
+			key := refID + "/" + mapString(control, "entry-id")
+			c, ok := controls[key]
+			if !ok {
+				c = &mergedControl{byKey: make(map[string]*mergedAssessment)}
+				controls[key] = c
+				order = append(order, key)
+			}
+			c.evals = append(c.evals, eval)
+			for _, log := range listMaps(mapList(eval, "assessment-logs")) {
+				a := &mergedAssessment{log: log, source: l.id()}
+				k := assessmentKey(refID, log)
+				prev, ok := c.byKey[k]
+				if !ok {
+					c.byKey[k] = a
+					c.assessments = append(c.assessments, a)
+					continue
+				}
+				keep := preferAssessment(prev, a, strategy)
+				if r1, r2 := mapString(prev.log, "result"), mapString(a.log, "result"); r1 != r2 {
+					drop := a
+					if keep == a {
+						drop = prev
+					}
+					m.notes = append(m.notes, fmt.Sprintf("%s: kept %s from %s over %s from %s (%s)", k,
+						mapString(keep.log, "result"), keep.source, mapString(drop.log, "result"), drop.source, strategy))
+				}
+				*prev = *keep
+			}
+		}
+	}
+
+	var evaluations []interface{}
+	var controlResults []string
+	for _, key := range order {
+		c := controls[key]
+		var logs []interface{}
+		var assessments []string
+		for _, a := range c.assessments {
+			logs = append(logs, a.provenance())
+			assessments = append(assessments, mapString(a.log, "result"))
+		}
+		result := aggregateResult(assessments)
+		eval := append(yaml.MapSlice(nil), c.evals[0]...)
+		for _, e := range c.evals {
+			if mapString(e, "result") == result {
+				eval = mapSet(eval, "message", mapString(e, "message"))
+				break
+			}
+		}
+		eval = mapSet(eval, "result", result)
+		eval = mapSet(eval, "assessment-logs", logs)
+		evaluations = append(evaluations, eval)
+		controlResults = append(controlResults, result)
+	}
+
+	meta := mergedMetadata(logs, id, outDir, &m.notes)
+	m.doc = yaml.MapSlice{
+		{Key: "metadata", Value: meta},
+		{Key: "result", Value: aggregateResult(controlResults)},
+		{Key: "target", Value: target},
+		{Key: "evaluations", Value: evaluations},
+	}
+	return m, nil
+}
+
+// mergedMetadata starts from the first log's metadata and lists every
+// input log, and every artifact the inputs reference, as a mapping
+// reference.
+func mergedMetadata(logs []sourceLog, id, outDir string, notes *[]string) yaml.MapSlice {
+	meta := append(yaml.MapSlice(nil), mapMap(logs[0].Doc, "metadata")...)
+	if id == "" {
+		id = mapString(mapMap(logs[0].Doc, "target"), "id") + "-merged"
+	}
+	meta = mapSet(meta, "id", id)
+	meta = mapDelete(meta, "version")
+	meta = mapDelete(meta, "mapping-references")
+
+	var ids []string
+	var latest string
+	for _, l := range logs {
+		ids = append(ids, l.id())
+		if date := mapString(mapMap(l.Doc, "metadata"), "date"); date > latest {
+			latest = date
+		}
+	}
+	if latest != "" {
+		meta = mapSet(meta, "date", latest)
+	}
+	meta = mapSet(meta, "description", "Merged from "+strings.Join(ids, ", ")+".")
+
+	for _, l := range logs {
+		for _, ref := range listMaps(mapList(mapMap(l.Doc, "metadata"), "mapping-references")) {
+			meta = mergeByID(notes, meta, "mapping-references", rebaseReference(ref, filepath.Dir(l.File), outDir), l.File)
+		}
+	}
+	for _, l := range logs {
+		meta = mergeByID(notes, meta, "mapping-references", artifactReference(l.File, l.Doc, outDir), l.File)
+	}
+	return meta
+}
+
+// artifactReference describes the artifact doc read from file as a
+// mapping reference, so that a generated artifact written to outDir can
+// point back at it.
+func artifactReference(file string, doc yaml.MapSlice, outDir string) yaml.MapSlice {
+	meta := mapMap(doc, "metadata")
+	id := mapString(meta, "id")
+	version := mapString(meta, "version")
+	if version == "" {
+		version = mapString(meta, "date")
+	}
+	if version == "" {
+		version = "unversioned"
+	}
+	title := mapString(doc, "title")
+	if title == "" {
+		title = mapString(meta, "type") + " " + id
+		if name := mapString(mapMap(meta, "author"), "name"); name != "" {
+			title += " by " + name
+		}
+	}
+	ref := yaml.MapSlice{
+		{Key: "id", Value: id},
+		{Key: "title", Value: title},
+		{Key: "version", Value: version},
+	}
+	if desc := mapString(meta, "description"); desc != "" {
+		ref = append(ref, yaml.MapItem{Key: "description", Value: desc})
+	}
+	return append(ref, yaml.MapItem{Key: "url", Value: fileURL(file, outDir)})
+}
+
+// assessmentKey identifies the requirement and plan an assessment log
+// covers; the requirement's reference-id defaults to the control's.
+func assessmentKey(controlRef string, log yaml.MapSlice) string {
+	req := mapMap(log, "requirement")
+	refID := mapString(req, "reference-id")
+	if refID == "" {
+		refID = controlRef
+	}
+	key := refID + "/" + mapString(req, "entry-id")
+	if plan := mapMap(log, "plan"); plan != nil {
+		key += "@" + mapString(plan, "reference-id") + "/" + mapString(plan, "entry-id")
+	}
+	return key
+}
+
+// preferAssessment returns the one of a and b that strategy keeps; a wins
+// ties, so the earlier log is preferred.
+func preferAssessment(a, b *mergedAssessment, strategy string) *mergedAssessment {
+	worse := func() int {
+		return resultRank[mapString(b.log, "result")] - resultRank[mapString(a.log, "result")]
+	}
+	later := func() int {
+		ta, tb := assessmentTime(a.log), assessmentTime(b.log)
+		switch {
+		case tb.After(ta):
+			return -1
+		case ta.After(tb):
+			return 1
+		}
+		return 0
+	}
+	var order []func() int
+	switch strategy {
+	case "latest":
+		order = []func() int{later, worse}
+	case "confidence":
+		order = []func() int{func() int {
+			return confidenceRank[mapString(a.log, "confidence-level")] - confidenceRank[mapString(b.log, "confidence-level")]
+		}, worse}
+	default:
+		order = []func() int{worse, later}
+	}
+	for _, cmp := range order {
+		if c := cmp(); c < 0 {
+			return b
+		} else if c > 0 {
+			return a
+		}
+	}
+	return a
+}
+
+// assessmentTime is when an assessment concluded, or began if it has no
+// end.
+func assessmentTime(log yaml.MapSlice) time.Time {
+	if t, ok := timeValue(log, "end"); ok {
+		return t
+	}
+	t, _ := timeValue(log, "start")
+	return t
+}
@@ -0,0 +1,101 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+)
+
+func TestMergeLogs(t *testing.T) {
+	var logs []sourceLog
+	for _, file := range []string{"testdata/coverage-evaluation-log.yaml", "testdata/merge-scanner-log.yaml"} {
+		doc, err := readDocument(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logs = append(logs, sourceLog{File: file, Doc: doc})
+	}
+
+	tests := []struct {
+		strategy string
+		ar02     string
+		source   string
+		result   string
+	}{
+		{"worst", "Needs Review", "COVERAGE-LOG", "Needs Review"},
+		{"latest", "Passed", "SCANNER-LOG", "Passed"},
+		{"confidence", "Passed", "SCANNER-LOG", "Passed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			m, err := mergeLogs(logs, tt.strategy, "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			evals := listMaps(mapList(m.doc, "evaluations"))
+			if len(evals) != 3 {
+				t.Fatalf("got %d control evaluations, want 3", len(evals))
+			}
+			mfa := listMaps(mapList(evals[0], "assessment-logs"))
+			if len(mfa) != 3 {
+				t.Fatalf("got %d assessment logs for LV-01, want 3", len(mfa))
+			}
+			if got := mapString(mfa[1], "result"); got != tt.ar02 {
+				t.Errorf("LV-01.AR02 result %q, want %q", got, tt.ar02)
+			}
+			if got := mapString(mfa[1], "message"); !strings.HasPrefix(got, "From "+tt.source+": ") {
+				t.Errorf("LV-01.AR02 message %q, want it to name %s", got, tt.source)
+			}
+			if got := mapString(evals[0], "result"); got != tt.result {
+				t.Errorf("LV-01 result %q, want %q", got, tt.result)
+			}
+			if len(m.notes) != 1 {
+				t.Errorf("got notes %q, want one conflict", m.notes)
+			}
+			if got := mapString(m.doc, "result"); got != tt.result {
+				t.Errorf("log result %q, want %q", got, tt.result)
+			}
+			if refs := mapList(mapMap(m.doc, "metadata"), "mapping-references"); len(refs) != 2 {
+				t.Errorf("got %d mapping references, want 2", len(refs))
+			}
+		})
+	}
+}
+
+func TestMergeLogsMergedAgain(t *testing.T) {
+	var logs []sourceLog
+	for _, file := range []string{"testdata/coverage-evaluation-log.yaml", "testdata/merge-scanner-log.yaml"} {
+		doc, err := readDocument(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logs = append(logs, sourceLog{File: file, Doc: doc})
+	}
+	first, err := mergeLogs(logs, "worst", "MERGED-LOG", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := mergeLogs([]sourceLog{{File: "merged.yaml", Doc: first.doc}, logs[1]}, "worst", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mfa := listMaps(mapList(listMaps(mapList(again.doc, "evaluations"))[0], "assessment-logs"))
+	if got := mapString(mfa[1], "message"); !strings.HasPrefix(got, "From COVERAGE-LOG: ") || strings.Count(got, "From ") != 1 {
+		t.Errorf("LV-01.AR02 message %q, want one prefix naming COVERAGE-LOG", got)
+	}
+}
+
+func TestMergeLogsTargetMismatch(t *testing.T) {
+	doc, err := readDocument("testdata/coverage-evaluation-log.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := append(yaml.MapSlice(nil), doc...)
+	other = mapSet(other, "target", yaml.MapSlice{{Key: "id", Value: "other-repo"}})
+	if _, err := mergeLogs([]sourceLog{{File: "a.yaml", Doc: doc}, {File: "b.yaml", Doc: other}}, "worst", "", ""); err == nil {
+		t.Error("expected an error for logs of different targets")
+	}
+}
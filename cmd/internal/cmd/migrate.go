@@ -0,0 +1,524 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+	"github.com/spf13/cobra"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate [file]",
+	Short: "Upgrade a Gemara artifact to a newer gemara-version",
+	Long: `Upgrade a Gemara YAML or JSON artifact from its declared gemara-version to a
+newer version by applying the registered schema migrations in sequence.
+Each migration rewrites metadata.gemara-version, and the result is validated
+against the schema in --schema. Changes that cannot be made safely are listed
+as manual follow-ups in the migration report.
+
+YAML artifacts are edited in place, so comments and formatting are kept. A
+result that does not validate is not written to --output or, with
+--in-place, over the original.`,
+	Args:          migrateArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE:          runMigrate,
+}
+
+var migrateFlags struct {
+	schemaDir  string
+	to         string
+	outputPath string
+	inPlace    bool
+	reportPath string
+	noValidate bool
+	list       bool
+}
+
+func newMigrateCmd() *cobra.Command {
+	migrateCmd.Flags().StringVarP(&migrateFlags.schemaDir, "schema", "s", "..", "Path to the CUE package directory used to validate the result")
+	migrateCmd.Flags().StringVarP(&migrateFlags.to, "to", "t", "", "Target gemara-version (default: latest registered version)")
+	migrateCmd.Flags().StringVarP(&migrateFlags.outputPath, "output", "o", "", "Output path for the migrated artifact (default: stdout)")
+	migrateCmd.Flags().BoolVarP(&migrateFlags.inPlace, "in-place", "i", false, "Overwrite the input file")
+	migrateCmd.Flags().StringVarP(&migrateFlags.reportPath, "report", "r", "", "Write the migration report to this file (default: stderr)")
+	migrateCmd.Flags().BoolVar(&migrateFlags.noValidate, "no-validate", false, "Skip schema validation of the migrated artifact")
+	migrateCmd.Flags().BoolVar(&migrateFlags.list, "list", false, "List registered migrations and exit")
+	return migrateCmd
+}
+
+func migrateArgs(cmd *cobra.Command, args []string) error {
+	if migrateFlags.list {
+		return cobra.NoArgs(cmd, args)
+	}
+	return cobra.ExactArgs(1)(cmd, args)
+}
+
+// migration upgrades an artifact from one gemara-version to the next.
+type migration struct {
+	From  string
+	To    string
+	Steps []migrationStep
+}
+
+// migrationStep is a single, independently testable transform. Apply edits
+// doc in place where it can, returning the (possibly reallocated) document,
+// and records anything it cannot change safely as a follow-up.
+type migrationStep struct {
+	Name        string
+	Description string
+	Apply       func(doc yaml.MapSlice, report *migrationReport) yaml.MapSlice
+}
+
+// migrationReport collects what a migration changed and what is left to do.
+type migrationReport struct {
+	File      string
+	From      string
+	To        string
+	Applied   []string
+	Changes   []string
+	FollowUps []string
+	Problems  []Diagnostic
+
+	// Edits replays the changes on the YAML source, so that comments and
+	// formatting survive.
+	Edits []migrationEdit
+}
+
+// migrationEdit renames the key at Path to Key or, without Key, sets the
+// scalar at Path to Value.
+type migrationEdit struct {
+	Path  []string
+	Key   string
+	Value string
+}
+
+func (r *migrationReport) change(format string, args ...interface{}) {
+	r.Changes = append(r.Changes, fmt.Sprintf(format, args...))
+}
+
+// rename records that the key at path was renamed to key.
+func (r *migrationReport) rename(path []string, key string) {
+	r.Edits = append(r.Edits, migrationEdit{Path: path, Key: key})
+}
+
+// set records that the scalar at path was set to value.
+func (r *migrationReport) set(path []string, value string) {
+	r.Edits = append(r.Edits, migrationEdit{Path: path, Value: value})
+}
+
+func (r *migrationReport) followUp(format string, args ...interface{}) {
+	r.FollowUps = append(r.FollowUps, fmt.Sprintf(format, args...))
+}
+
+// migrations is the registry of schema migrations, ordered by version.
+var migrations = []migration{
+	{
+		From: "1.0.0",
+		To:   "1.1.0",
+		Steps: []migrationStep{
+			{
+				Name:        "rename-groups",
+				Description: "Rename families and categories to groups (ADR 0020)",
+				Apply:       migrateRenameGroups,
+			},
+			{
+				Name:        "promote-capabilities",
+				Description: "Move inline capabilities to a CapabilityCatalog (ADR 0019)",
+				Apply:       migratePromoteCapabilities,
+			},
+		},
+	},
+}
+
+func runMigrate(cmd *cobra.Command, args []string) error {
+	if migrateFlags.list {
+		for _, m := range migrations {
+			fmt.Printf("%s -> %s\n", m.From, m.To)
+			for _, s := range m.Steps {
+				fmt.Printf("  %-22s %s\n", s.Name, s.Description)
+			}
+		}
+		return nil
+	}
+
+	file := args[0]
+	out := migrateFlags.outputPath
+	if migrateFlags.inPlace {
+		out = file
+	}
+	schemaDir := migrateFlags.schemaDir
+	if migrateFlags.noValidate {
+		schemaDir = ""
+	}
+	report, data, err := migrateFile(file, out, migrateFlags.to, schemaDir)
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		if _, err := os.Stdout.Write(data); err != nil {
+			return err
+		}
+	}
+
+	if migrateFlags.reportPath != "" {
+		if err := writeReport(migrateFlags.reportPath, report.write); err != nil {
+			return err
+		}
+	} else if err := report.write(os.Stderr); err != nil {
+		return err
+	}
+
+	if len(report.Problems) > 0 {
+		if out != "" {
+			return fmt.Errorf("migrated artifact does not validate: %d problem(s); %s was not written", len(report.Problems), out)
+		}
+		return fmt.Errorf("migrated artifact does not validate: %d problem(s)", len(report.Problems))
+	}
+	return nil
+}
+
+// migrateFile migrates file and returns the report and the migrated
+// artifact, in the format of out (default: that of file). YAML is edited in
+// place so that comments survive. Unless schemaDir is empty, the result is
+// validated against it. out, when given, is written only when the result
+// validates, so a bad migration never replaces the original.
+func migrateFile(file, out, to, schemaDir string) (*migrationReport, []byte, error) {
+	doc, err := readDocument(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	report, doc, err := migrateDocument(doc, to)
+	if err != nil {
+		return nil, nil, err
+	}
+	report.File = file
+
+	format := documentFormat(file)
+	if out != "" {
+		format = documentFormat(out)
+	}
+	data, err := encodeDocument(doc, format)
+	if err != nil {
+		return nil, nil, err
+	}
+	if format == "yaml" && documentFormat(file) == "yaml" && len(report.Edits) > 0 {
+		if data, err = migrateYAML(file, data, report.Edits); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if schemaDir != "" && len(report.Applied) > 0 {
+		ctx := cuecontext.New()
+		schema, err := loadSchema(ctx, schemaDir)
+		if err != nil {
+			return nil, nil, err
+		}
+		name := file
+		if out != "" {
+			name = out
+		}
+		src, err := parseArtifactSource(ctx, name, data)
+		if err != nil {
+			report.Problems = fileDiagnostics(err, name, ruleSyntax)
+		} else {
+			report.Problems = validateSource(schema, src, "", ruleSchema).Diagnostics
+		}
+	}
+
+	if out != "" && len(report.Problems) == 0 {
+		if err := os.WriteFile(out, data, 0644); err != nil {
+			return nil, nil, fmt.Errorf("write %s: %w", out, err)
+		}
+	}
+	return report, data, nil
+}
+
+// migrateDocument applies every registered migration between the document's
+// declared gemara-version and target (default: the latest version).
+func migrateDocument(doc yaml.MapSlice, target string) (*migrationReport, yaml.MapSlice, error) {
+	metadata := mapMap(doc, "metadata")
+	if metadata == nil {
+		return nil, doc, fmt.Errorf("artifact has no metadata")
+	}
+	declared, ok := mapGet(metadata, "gemara-version")
+	if !ok {
+		return nil, doc, fmt.Errorf("artifact has no metadata.gemara-version")
+	}
+	from := strings.TrimPrefix(fmt.Sprint(declared), "v")
+	if from == "" {
+		return nil, doc, fmt.Errorf("artifact has no metadata.gemara-version")
+	}
+
+	plan, err := planMigrations(from, strings.TrimPrefix(target, "v"))
+	if err != nil {
+		return nil, doc, err
+	}
+
+	report := &migrationReport{From: from, To: from}
+	for _, m := range plan {
+		for _, step := range m.Steps {
+			doc = step.Apply(doc, report)
+			report.Applied = append(report.Applied, fmt.Sprintf("%s (%s -> %s)", step.Name, m.From, m.To))
+		}
+		metadata := mapMap(doc, "metadata")
+		mapSet(metadata, "gemara-version", m.To)
+		report.set([]string{"metadata", "gemara-version"}, strconv.Quote(m.To))
+		report.change("metadata.gemara-version: %s -> %s", m.From, m.To)
+		report.To = m.To
+	}
+	return report, doc, nil
+}
+
+// migrateYAML replays edits on the YAML source of file so that comments and
+// formatting survive, and checks the result holds the same data as want,
+// the migrated document encoded from scratch.
+func migrateYAML(file string, want []byte, edits []migrationEdit) ([]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", file, err)
+	}
+	f, err := parser.ParseBytes(data, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", file, err)
+	}
+	for _, e := range edits {
+		if e.Key != "" {
+			err = renameKey(f, e.Path, e.Key)
+		} else {
+			err = replaceScalar(f, e.Path, e.Value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("migrate %s at %s: %w", file, formatPath(e.Path), err)
+		}
+	}
+	out := []byte(f.String())
+	if len(out) > 0 && out[len(out)-1] != '\n' {
+		out = append(out, '\n')
+	}
+	if err := sameDocumentData(want, out); err != nil {
+		return nil, fmt.Errorf("migrate %s: %w", file, err)
+	}
+	return out, nil
+}
+
+// renameKey renames the mapping key at path in f, keeping its value and
+// comments.
+func renameKey(f *ast.File, path []string, key string) error {
+	if len(f.Docs) == 0 {
+		return fmt.Errorf("empty document")
+	}
+	parent := f.Docs[0].Body
+	if len(path) > 1 {
+		p, err := yaml.PathString(yamlPath(path[:len(path)-1]))
+		if err != nil {
+			return err
+		}
+		if parent, err = p.FilterFile(f); err != nil {
+			return err
+		}
+	}
+	var values []*ast.MappingValueNode
+	switch n := parent.(type) {
+	case *ast.MappingNode:
+		values = n.Values
+	case *ast.MappingValueNode:
+		values = []*ast.MappingValueNode{n}
+	}
+	old := path[len(path)-1]
+	for _, mv := range values {
+		k, ok := mv.Key.(*ast.StringNode)
+		if !ok || k.Value != old {
+			continue
+		}
+		k.Value = key
+		k.Token.Value = key
+		k.Token.Origin = strings.Replace(k.Token.Origin, old, key, 1)
+		return nil
+	}
+	return fmt.Errorf("no key %q", old)
+}
+
+// planMigrations returns the chain of migrations from one version to
+// another. An empty target means the latest registered version.
+func planMigrations(from, to string) ([]migration, error) {
+	if to == "" {
+		for _, m := range migrations {
+			if compareVersions(m.To, to) > 0 {
+				to = m.To
+			}
+		}
+	}
+	if compareVersions(from, to) >= 0 {
+		return nil, nil
+	}
+
+	var plan []migration
+	current := from
+	for current != to {
+		next := -1
+		for i, m := range migrations {
+			if m.From == current {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			return nil, fmt.Errorf("no migration registered from gemara-version %s (target %s)", current, to)
+		}
+		plan = append(plan, migrations[next])
+		current = migrations[next].To
+		if compareVersions(current, to) > 0 {
+			return nil, fmt.Errorf("no migration path from %s that stops at %s", from, to)
+		}
+	}
+	return plan, nil
+}
+
+// compareVersions compares dotted numeric versions such as 1.1.0; missing
+// or non-numeric components compare as zero.
+func compareVersions(a, b string) int {
+	pa := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	pb := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			fmt.Sscanf(pa[i], "%d", &x)
+		}
+		if i < len(pb) {
+			fmt.Sscanf(pb[i], "%d", &y)
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// entryListKeys names the catalog lists whose entries reference a group.
+var entryListKeys = []string{"controls", "guidelines", "threats", "risks", "capabilities", "principles", "vectors"}
+
+// migrateRenameGroups renames families/categories to groups and
+// family/category to group on entries (ADR 0020).
+func migrateRenameGroups(doc yaml.MapSlice, report *migrationReport) yaml.MapSlice {
+	for _, old := range []string{"families", "categories"} {
+		if _, ok := mapGet(doc, old); !ok {
+			continue
+		}
+		if mapRename(doc, old, "groups") {
+			report.rename([]string{old}, "groups")
+			report.change("%s -> groups", old)
+		} else {
+			report.followUp("both %s and groups are present; merge %s into groups by hand", old, old)
+		}
+	}
+
+	if metadata := mapMap(doc, "metadata"); metadata != nil {
+		if _, ok := mapGet(metadata, "applicability-categories"); ok {
+			if mapRename(metadata, "applicability-categories", "applicability-groups") {
+				report.rename([]string{"metadata", "applicability-categories"}, "applicability-groups")
+				report.change("metadata.applicability-categories -> metadata.applicability-groups")
+			} else {
+				report.followUp("both metadata.applicability-categories and metadata.applicability-groups are present; merge them by hand")
+			}
+		}
+	}
+
+	for _, key := range entryListKeys {
+		for i, entry := range listMaps(mapList(doc, key)) {
+			for _, old := range []string{"family", "category"} {
+				if _, ok := mapGet(entry, old); !ok {
+					continue
+				}
+				if mapRename(entry, old, "group") {
+					report.rename([]string{key, strconv.Itoa(i), old}, "group")
+					report.change("%s[%d].%s -> group", key, i, old)
+				} else {
+					report.followUp("%s[%d] has both %s and group; keep one by hand", key, i, old)
+				}
+			}
+		}
+	}
+	return doc
+}
+
+// migratePromoteCapabilities flags capabilities defined inline in threat
+// catalogs. Moving them to a CapabilityCatalog needs a new file and a
+// mapping-reference, so it is reported rather than performed (ADR 0019).
+func migratePromoteCapabilities(doc yaml.MapSlice, report *migrationReport) yaml.MapSlice {
+	if mapString(mapMap(doc, "metadata"), "type") != "ThreatCatalog" {
+		return doc
+	}
+
+	if inline := listMaps(mapList(doc, "capabilities")); len(inline) > 0 {
+		ids := make([]string, 0, len(inline))
+		for _, c := range inline {
+			ids = append(ids, mapString(c, "id"))
+		}
+		report.followUp("move the %d inline capabilities (%s) to a CapabilityCatalog, add it to metadata.mapping-references, and remove the top-level capabilities list",
+			len(ids), strings.Join(ids, ", "))
+	}
+
+	for i, threat := range listMaps(mapList(doc, "threats")) {
+		for _, c := range mapList(threat, "capabilities") {
+			if id, ok := c.(string); ok {
+				report.followUp("threats[%d].capabilities references %q by bare id; rewrite it as a mapping with reference-id and entries", i, id)
+			}
+		}
+	}
+	return doc
+}
+
+func (r *migrationReport) write(w io.Writer) error {
+	fmt.Fprintf(w, "# Migration report: %s\n\n", r.File)
+	if len(r.Applied) == 0 {
+		fmt.Fprintf(w, "Already at gemara-version %s; nothing to migrate.\n", r.From)
+		return nil
+	}
+	fmt.Fprintf(w, "gemara-version %s -> %s\n\n", r.From, r.To)
+
+	fmt.Fprintln(w, "## Applied migrations")
+	fmt.Fprintln(w)
+	for _, a := range r.Applied {
+		fmt.Fprintf(w, "- %s\n", a)
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "## Changes")
+	fmt.Fprintln(w)
+	for _, c := range r.Changes {
+		fmt.Fprintf(w, "- %s\n", c)
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "## Manual follow-ups")
+	fmt.Fprintln(w)
+	if len(r.FollowUps) == 0 {
+		fmt.Fprintln(w, "None.")
+	}
+	for _, f := range r.FollowUps {
+		fmt.Fprintf(w, "- [ ] %s\n", f)
+	}
+
+	if len(r.Problems) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "## Validation problems")
+		fmt.Fprintln(w)
+		sortDiagnostics(r.Problems)
+		for _, d := range r.Problems {
+			fmt.Fprintf(w, "- line %d: %s: %s\n", d.Line, d.Path, d.Message)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMigrateDocument(t *testing.T) {
+	tests := []struct {
+		name          string
+		file          string
+		wantKeys      []string
+		wantFollowUps int
+	}{
+		{"families and applicability categories", "testdata/legacy-control-catalog.yaml", []string{"groups"}, 0},
+		{"inline capabilities need a follow-up", "testdata/legacy-threat-catalog.yaml", []string{"groups"}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := readDocument(tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			report, doc, err := migrateDocument(doc, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := mapString(mapMap(doc, "metadata"), "gemara-version"); got != "1.1.0" {
+				t.Errorf("gemara-version = %q, want 1.1.0", got)
+			}
+			for _, key := range tt.wantKeys {
+				if _, ok := mapGet(doc, key); !ok {
+					t.Errorf("missing key %q after migration", key)
+				}
+			}
+			for _, entry := range listMaps(mapList(doc, "controls")) {
+				if _, ok := mapGet(entry, "family"); ok {
+					t.Errorf("control %s still has family", mapString(entry, "id"))
+				}
+			}
+			if len(report.FollowUps) != tt.wantFollowUps {
+				t.Errorf("got %d follow-ups, want %d: %s", len(report.FollowUps), tt.wantFollowUps, strings.Join(report.FollowUps, "; "))
+			}
+		})
+	}
+}
+
+func TestPlanMigrations(t *testing.T) {
+	plan, err := planMigrations("1.1.0", "")
+	if err != nil || len(plan) != 0 {
+		t.Errorf("current version: got %d migrations, err %v", len(plan), err)
+	}
+	if _, err := planMigrations("0.9.0", "1.1.0"); err == nil {
+		t.Error("expected an error for an unregistered starting version")
+	}
+}
+
+func TestMigrateFileKeepsComments(t *testing.T) {
+	data, err := os.ReadFile("testdata/legacy-control-catalog.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "catalog.yaml")
+	commented := strings.Replace(string(data), "families:\n", "# Families became groups in 1.1.0.\nfamilies: # renamed\n", 1)
+	if err := os.WriteFile(file, []byte(commented), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, _, err := migrateFile(file, file, "", "../../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) > 0 {
+		t.Fatalf("migrated catalog does not validate: %+v", report.Problems)
+	}
+	got, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"# Families became groups in 1.1.0.\n", "groups: # renamed\n", "gemara-version: \"1.1.0\"", "group: dp"} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("migrated file lacks %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestMigrateFileRefusesInvalidResult(t *testing.T) {
+	data, err := os.ReadFile("testdata/legacy-control-catalog.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A control without a title migrates but does not validate.
+	broken := strings.Replace(string(data), "    title: Encrypt Data at Rest\n", "", 1)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "catalog.yaml")
+	if err := os.WriteFile(file, []byte(broken), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, out := range map[string]string{"in place": file, "output": filepath.Join(dir, "out.yaml")} {
+		t.Run(name, func(t *testing.T) {
+			report, _, err := migrateFile(file, out, "", "../../..")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Problems) == 0 {
+				t.Fatal("expected validation problems")
+			}
+			if out == file {
+				if got, _ := os.ReadFile(file); string(got) != broken {
+					t.Error("the original was overwritten")
+				}
+			} else if _, err := os.Stat(out); !os.IsNotExist(err) {
+				t.Errorf("%s was written: %v", out, err)
+			}
+		})
+	}
+}
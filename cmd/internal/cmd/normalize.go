@@ -0,0 +1,231 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/goccy/go-yaml"
+	"github.com/spf13/cobra"
+)
+
+var normalizeCmd = &cobra.Command{
+	Use:   "normalize [file]",
+	Short: "Rewrite a Gemara artifact into its canonical flat shape",
+	Long: `Rewrite a Gemara YAML or JSON artifact into one stable shape so that
+artifacts can be compared with ordinary diff tooling:
+
+  - a document wrapped under a single top-level key (for example
+    "catalog: {metadata: ..., controls: ...}") is unwrapped;
+  - fields the schema defaults are filled in (state: Active on controls,
+    assessment requirements, and guidelines; required: false on accepted
+    methods);
+  - keys are ordered as the CUE definition declares them, with fields the
+    schema does not know about kept after them in their original order.
+
+The schema definition is inferred from metadata.type unless --definition is
+set. The output format follows --format, then the output file extension,
+then the input file extension.`,
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE:          runNormalize,
+}
+
+var normalizeFlags struct {
+	schemaDir  string
+	definition string
+	format     string
+	outputPath string
+	inPlace    bool
+}
+
+func newNormalizeCmd() *cobra.Command {
+	normalizeCmd.Flags().StringVarP(&normalizeFlags.schemaDir, "schema", "s", "..", "Path to the CUE package directory")
+	normalizeCmd.Flags().StringVarP(&normalizeFlags.definition, "definition", "d", "", "Schema definition that declares the key order (default: inferred from metadata.type)")
+	normalizeCmd.Flags().StringVarP(&normalizeFlags.format, "format", "f", "", "Output format: yaml or json (default: from the output or input extension)")
+	normalizeCmd.Flags().StringVarP(&normalizeFlags.outputPath, "output", "o", "", "Output path for the normalized artifact (default: stdout)")
+	normalizeCmd.Flags().BoolVarP(&normalizeFlags.inPlace, "in-place", "i", false, "Overwrite the input file")
+	return normalizeCmd
+}
+
+func runNormalize(cmd *cobra.Command, args []string) error {
+	file := args[0]
+	doc, err := readDocument(file)
+	if err != nil {
+		return err
+	}
+
+	ctx := cuecontext.New()
+	schema, err := loadSchema(ctx, normalizeFlags.schemaDir)
+	if err != nil {
+		return err
+	}
+	doc, unwrapped, err := normalizeDocument(ctx, schema, doc, normalizeFlags.definition)
+	if err != nil {
+		return fmt.Errorf("normalize %s: %w", file, err)
+	}
+	for _, key := range unwrapped {
+		fmt.Fprintf(os.Stderr, "%s: unwrapped top-level key %q\n", file, key)
+	}
+
+	out := normalizeFlags.outputPath
+	if normalizeFlags.inPlace {
+		out = file
+	}
+	data, err := encodeDocument(doc, outputFormat(normalizeFlags.format, out, file))
+	if err != nil {
+		return err
+	}
+
+	if out == "" || out == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(out, data, 0644); err != nil {
+		return fmt.Errorf("write %s: %w", out, err)
+	}
+	return nil
+}
+
+// normalizeDocument unwraps doc, then reorders it as the schema definition
+// declares and fills the defaults the definition resolves to. It returns
+// the wrapper keys it removed, outermost first.
+func normalizeDocument(ctx *cue.Context, schema cue.Value, doc yaml.MapSlice, definition string) (yaml.MapSlice, []string, error) {
+	doc, unwrapped := unwrapDocument(doc)
+
+	data, err := encodeDocument(doc, "json")
+	if err != nil {
+		return nil, nil, err
+	}
+	value := ctx.CompileBytes(data)
+	if err := value.Err(); err != nil {
+		return nil, nil, err
+	}
+	def, _, err := lookupDefinition(schema, value, definition)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	normalized, _ := normalizeValue(doc, def, def.Unify(value)).(yaml.MapSlice)
+	return normalized, unwrapped, nil
+}
+
+// unwrapDocument strips top-level wrapper keys: a document without metadata
+// whose only key holds a mapping that has metadata.
+func unwrapDocument(doc yaml.MapSlice) (yaml.MapSlice, []string) {
+	var unwrapped []string
+	for len(doc) == 1 && mapIndex(doc, "metadata") < 0 {
+		inner, ok := doc[0].Value.(yaml.MapSlice)
+		if !ok || mapIndex(inner, "metadata") < 0 {
+			break
+		}
+		unwrapped = append(unwrapped, fmt.Sprint(doc[0].Key))
+		doc = inner
+	}
+	return doc, unwrapped
+}
+
+// normalizeValue walks doc alongside the schema value s, which declares the
+// key order, and the document unified with the schema u, which supplies
+// defaults. Values the schema has nothing to say about are returned as is.
+func normalizeValue(doc interface{}, s, u cue.Value) interface{} {
+	switch d := doc.(type) {
+	case yaml.MapSlice:
+		return normalizeMap(d, s, u)
+	case []interface{}:
+		elem := s.LookupPath(cue.MakePath(cue.AnyIndex))
+		out := make([]interface{}, len(d))
+		for i, value := range d {
+			out[i] = normalizeValue(value, elem, u.LookupPath(cue.MakePath(cue.Index(i))))
+		}
+		return out
+	default:
+		return doc
+	}
+}
+
+func normalizeMap(m yaml.MapSlice, s, u cue.Value) yaml.MapSlice {
+	fields := schemaFields(s)
+	if len(fields) == 0 {
+		// Disjunctions and other values without a single declared
+		// shape fall back to the resolved value.
+		fields = schemaFields(u)
+	}
+
+	out := make(yaml.MapSlice, 0, len(m))
+	seen := make(map[string]bool, len(m))
+	for _, f := range fields {
+		resolved := u.LookupPath(cue.MakePath(cue.Str(f.name)))
+		if value, ok := mapGet(m, f.name); ok {
+			out = append(out, yaml.MapItem{Key: f.name, Value: normalizeValue(value, f.value, resolved)})
+			seen[f.name] = true
+			continue
+		}
+		if f.optional {
+			continue
+		}
+		if !resolved.Exists() {
+			resolved = f.value
+		}
+		if value, ok := defaultScalar(resolved); ok {
+			out = append(out, yaml.MapItem{Key: f.name, Value: value})
+		}
+	}
+	for _, item := range m {
+		if k, ok := item.Key.(string); ok && seen[k] {
+			continue
+		}
+		out = append(out, item)
+	}
+	return out
+}
+
+type schemaField struct {
+	name     string
+	optional bool
+	value    cue.Value
+}
+
+// schemaFields lists the regular and optional fields of v in declaration
+// order.
+func schemaFields(v cue.Value) []schemaField {
+	if !v.Exists() || v.IncompleteKind()&cue.StructKind == 0 {
+		return nil
+	}
+	iter, err := v.Fields(cue.Optional(true))
+	if err != nil {
+		return nil
+	}
+	var fields []schemaField
+	for iter.Next() {
+		sel := iter.Selector()
+		if sel.LabelType() != cue.StringLabel {
+			continue
+		}
+		fields = append(fields, schemaField{name: sel.Unquoted(), optional: iter.IsOptional(), value: iter.Value()})
+	}
+	return fields
+}
+
+// defaultScalar returns the schema default of a field that is missing from
+// the document, such as *"Active" or *false.
+func defaultScalar(v cue.Value) (interface{}, bool) {
+	d, ok := v.Default()
+	if !ok || !d.IsConcrete() {
+		return nil, false
+	}
+	switch d.Kind() {
+	case cue.BoolKind, cue.StringKind, cue.IntKind, cue.FloatKind:
+	default:
+		return nil, false
+	}
+	var value interface{}
+	if err := d.Decode(&value); err != nil {
+		return nil, false
+	}
+	return value, true
+}
@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/goccy/go-yaml"
+)
+
+func TestNormalizeDocument(t *testing.T) {
+	ctx := cuecontext.New()
+	schema, err := loadSchema(ctx, "../../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := readDocument("testdata/wrapped-control-catalog.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc, unwrapped, err := normalizeDocument(ctx, schema, doc, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(unwrapped) != "[catalog]" {
+		t.Errorf("unwrapped = %v, want [catalog]", unwrapped)
+	}
+	if got := fmt.Sprint(mapKeys(doc)); got != "[title metadata controls groups]" {
+		t.Errorf("top-level keys = %s", got)
+	}
+
+	control := listMaps(mapList(doc, "controls"))[0]
+	if got := fmt.Sprint(mapKeys(control)); got != "[id title objective group assessment-requirements state]" {
+		t.Errorf("control keys = %s", got)
+	}
+	if got := mapString(control, "state"); got != "Active" {
+		t.Errorf("control state = %q, want Active", got)
+	}
+	requirement := listMaps(mapList(control, "assessment-requirements"))[0]
+	if got := mapString(requirement, "state"); got != "Active" {
+		t.Errorf("assessment requirement state = %q, want Active", got)
+	}
+
+	first, err := encodeDocument(doc, "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _, err := normalizeDocument(ctx, schema, doc, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := encodeDocument(again, "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Errorf("normalize is not idempotent:\n%s\n---\n%s", first, second)
+	}
+}
+
+func mapKeys(m yaml.MapSlice) []string {
+	out := make([]string, len(m))
+	for i, item := range m {
+		out[i] = fmt.Sprint(item.Key)
+	}
+	return out
+}
@@ -0,0 +1,207 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// parameterValues is a parameter-values file: values for the parameters
+// of assessment plans, for every target or only for one target or
+// environment.
+//
+//	target: example-repo     # optional
+//	environment: production  # optional
+//	values:
+//	  min-reviewers: "2"
+type parameterValues struct {
+	Target      string            `yaml:"target"`
+	Environment string            `yaml:"environment"`
+	Values      map[string]string `yaml:"values"`
+
+	path string
+}
+
+func loadParameterValues(path string) (*parameterValues, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read parameter values: %w", err)
+	}
+	pv := &parameterValues{}
+	if err := yaml.UnmarshalWithOptions(data, pv, yaml.Strict()); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if len(pv.Values) == 0 {
+		return nil, fmt.Errorf("%s: values is empty", path)
+	}
+	pv.path = path
+	return pv, nil
+}
+
+// bindValues merges the parameter-values files that apply to the target
+// and environment given. More specific files win: values for every target
+// are overridden by those for the environment, which are overridden by
+// those for the target; among equally specific files, the later wins.
+func bindValues(paths []string, target, environment string) (map[string]string, error) {
+	var levels [3][]*parameterValues
+	for _, path := range paths {
+		pv, err := loadParameterValues(path)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case pv.Target != "" && pv.Target != target,
+			pv.Environment != "" && pv.Environment != environment:
+			continue
+		case pv.Target != "":
+			levels[2] = append(levels[2], pv)
+		case pv.Environment != "":
+			levels[1] = append(levels[1], pv)
+		default:
+			levels[0] = append(levels[0], pv)
+		}
+	}
+	values := make(map[string]string)
+	for _, level := range levels {
+		for _, pv := range level {
+			for id, v := range pv.Values {
+				values[id] = v
+			}
+		}
+	}
+	return values, nil
+}
+
+// checkParameterValues reports values that are not among the
+// accepted-values of the plan parameters they bind, parameters without a
+// value, and values for parameters no plan declares.
+func checkParameterValues(file string, doc yaml.MapSlice, src *artifactSource, values map[string]string) []Diagnostic {
+	var diags []Diagnostic
+	report := func(severity string, path []string, value, msg string) {
+		diags = append(diags, diagnosticAt(file, src, ruleParameter, severity, path, value, msg))
+	}
+
+	declared := make(map[string]bool)
+	for i, plan := range listMaps(mapList(mapMap(doc, "adherence"), "assessment-plans")) {
+		for j, p := range listMaps(mapList(plan, "parameters")) {
+			path := []string{"adherence", "assessment-plans", strconv.Itoa(i), "parameters", strconv.Itoa(j)}
+			id := mapString(p, "id")
+			declared[id] = true
+			value, ok := values[id]
+			if !ok {
+				report(severityWarning, path, id, fmt.Sprintf("parameter %s of plan %s has no value", id, mapString(plan, "id")))
+				continue
+			}
+			if accepted := stringList(mapList(p, "accepted-values")); len(accepted) > 0 && !containsString(accepted, value) {
+				report(severityError, appendPath(path, "accepted-values"), value,
+					fmt.Sprintf("%q is not an accepted value of parameter %s (expected %s)", value, id, strings.Join(accepted, ", ")))
+			}
+		}
+	}
+	var unknown []string
+	for id := range values {
+		if !declared[id] {
+			unknown = append(unknown, id)
+		}
+	}
+	sort.Strings(unknown)
+	for _, id := range unknown {
+		report(severityWarning, []string{"adherence"}, id, fmt.Sprintf("a value is given for parameter %s, which no assessment plan declares", id))
+	}
+	sortDiagnostics(diags)
+	return diags
+}
+
+var placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.-]+)\s*\}\}`)
+
+// substituteParameters replaces the {{param}} placeholders of text with
+// their values, leaving those without a value in place. It returns the
+// names of the placeholders left.
+func substituteParameters(text string, values map[string]string) (string, []string) {
+	var unbound []string
+	out := placeholder.ReplaceAllStringFunc(text, func(m string) string {
+		name := placeholder.FindStringSubmatch(m)[1]
+		if v, ok := values[name]; ok {
+			return v
+		}
+		if !containsString(unbound, name) {
+			unbound = append(unbound, name)
+		}
+		return m
+	})
+	return out, unbound
+}
+
+// bindParameters substitutes values into the requirement text,
+// recommendations, and constraint text of the effective policy and records
+// them. It returns a note for every placeholder left without a value.
+func (p *effectivePolicy) bindParameters(values map[string]string) []string {
+	p.Parameters = values
+	notes := bindCatalogParameters(p.Catalogs, values)
+	for i := range p.Guidance {
+		for j := range p.Guidance[i].Guidelines {
+			g := &p.Guidance[i].Guidelines[j]
+			notes = append(notes, bindConstraints(g.ID, g.Constraints, values)...)
+		}
+	}
+	return notes
+}
+
+// bindCatalogParameters substitutes values into the requirements and
+// constraints of catalogs, returning a note for every placeholder left.
+func bindCatalogParameters(catalogs []effectiveCatalog, values map[string]string) []string {
+	var notes []string
+	bind := func(owner, field string, text *string) {
+		var unbound []string
+		*text, unbound = substituteParameters(*text, values)
+		for _, name := range unbound {
+			notes = append(notes, fmt.Sprintf("%s %s: {{%s}} has no value", owner, field, name))
+		}
+	}
+	for i := range catalogs {
+		for j := range catalogs[i].Controls {
+			ctl := &catalogs[i].Controls[j]
+			notes = append(notes, bindConstraints(ctl.ID, ctl.Constraints, values)...)
+			for k := range ctl.Requirements {
+				ar := &ctl.Requirements[k]
+				bind(ar.ID, "text", &ar.Text)
+				bind(ar.ID, "recommendation", &ar.Recommendation)
+				notes = append(notes, bindConstraints(ar.ID, ar.Constraints, values)...)
+			}
+		}
+	}
+	return notes
+}
+
+func bindConstraints(owner string, constraints []effectiveConstraint, values map[string]string) []string {
+	var notes []string
+	for i := range constraints {
+		var unbound []string
+		constraints[i].Text, unbound = substituteParameters(constraints[i].Text, values)
+		for _, name := range unbound {
+			notes = append(notes, fmt.Sprintf("%s constraint %s: {{%s}} has no value", owner, constraints[i].ID, name))
+		}
+	}
+	return notes
+}
+
+// formatParameters lists bound values as id=value, sorted by id.
+func formatParameters(values map[string]string) string {
+	var ids []string
+	for id := range values {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var parts []string
+	for _, id := range ids {
+		parts = append(parts, id+"="+values[id])
+	}
+	return strings.Join(parts, ", ")
+}
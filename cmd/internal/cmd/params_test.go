@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBindValues(t *testing.T) {
+	files := []string{
+		"testdata/parameters/example-repo.yaml",
+		"testdata/parameters/production.yaml",
+		"testdata/parameters/defaults.yaml",
+	}
+	for _, tc := range []struct {
+		target, environment string
+		want                map[string]string
+	}{
+		{"", "", map[string]string{"branch": "main", "min-reviewers": "1"}},
+		{"other-repo", "production", map[string]string{"branch": "release", "min-reviewers": "2"}},
+		{"example-repo", "production", map[string]string{"branch": "release", "min-reviewers": "3"}},
+		{"example-repo", "staging", map[string]string{"branch": "main", "min-reviewers": "3"}},
+	} {
+		got, err := bindValues(files, tc.target, tc.environment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("bindValues(%q, %q) = %v, want %v", tc.target, tc.environment, got, tc.want)
+		}
+	}
+}
+
+func TestSubstituteParameters(t *testing.T) {
+	got, unbound := substituteParameters("At least {{min-reviewers}} of {{ team }} review {{branch}}; {{team}} signs.",
+		map[string]string{"min-reviewers": "2", "branch": "main"})
+	if want := "At least 2 of {{ team }} review main; {{team}} signs."; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if !reflect.DeepEqual(unbound, []string{"team"}) {
+		t.Errorf("unbound %v, want [team]", unbound)
+	}
+}
+
+func TestPolicyParameters(t *testing.T) {
+	file := "testdata/parameters-policy.yaml"
+	doc, err := readDocument(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	effective, diags := compilePolicy(file, doc, nil, newArtifactResolver("", "", false))
+	if hasErrors(diags) {
+		t.Fatalf("policy does not compile: %+v", diags)
+	}
+
+	values, err := bindValues([]string{"testdata/parameters/invalid.yaml"}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range checkParameterValues(file, doc, nil, values) {
+		got = append(got, d.Severity+" "+d.Path+" "+d.Value)
+	}
+	want := []string{
+		`error adherence."assessment-plans"[1].parameters[0]."accepted-values" 10`,
+		`warning adherence."assessment-plans"[3].parameters[0] branch`,
+		`warning adherence approvers`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diagnostics:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	notes := effective.bindParameters(map[string]string{"min-reviewers": "2"})
+	if len(notes) != 1 || !strings.Contains(notes[0], "LV-02.AR01 text: {{branch}}") {
+		t.Errorf("unexpected notes: %v", notes)
+	}
+	_, ctl := findEffectiveControl(effective.Catalogs, "LEVELS", "LV-01")
+	if ctl == nil || len(ctl.Constraints) != 1 || ctl.Constraints[0].Text != "Access reviews MUST have at least 2 reviewers." {
+		t.Errorf("constraint not bound: %+v", ctl)
+	}
+	if effective.Parameters["min-reviewers"] != "2" {
+		t.Errorf("parameters not recorded: %v", effective.Parameters)
+	}
+}
@@ -0,0 +1,550 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/goccy/go-yaml"
+	"github.com/spf13/cobra"
+)
+
+var policyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Work with Gemara policies",
+}
+
+var policyCompileCmd = &cobra.Command{
+	Use:   "compile [policy]",
+	Short: "Resolve a policy's imports into the effective requirement set",
+	Long: `Resolve the catalogs and guidance a Gemara policy imports and write the
+controls, assessment requirements, and guidelines the organization must meet.
+
+Each imported catalog is flattened (see flatten), then the policy is applied
+in this order:
+
+  1. exclusions remove controls, assessment requirements, or guidelines;
+  2. assessment-requirement-modifications apply in the order listed:
+       Add       adds a requirement (id from the modification) to the
+                 target control;
+       Modify    updates the target requirement with the fields given;
+       Override  is Modify for changes that relax the catalog;
+       Replace   swaps the target requirement for a new one with the
+                 modification's id and fields;
+       Remove    removes the target requirement;
+  3. constraints attach to their target control, requirement, or guideline;
+  4. Retired controls and assessment requirements are dropped.
+
+Modifications and constraints whose target-id does not exist are reported
+and nothing is written. Exclusions that match nothing are reported as
+warnings.
+
+--values binds parameter-values files to the parameters of the assessment
+plans. A file may name a target or an environment; it then applies only
+when --target or --environment match, and overrides files for every target
+(a target file overrides an environment file). Values outside a
+parameter's accepted-values are errors. The values replace {{param}}
+placeholders in requirement text, recommendations, and constraint text, and
+are recorded under parameters.`,
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE:          runPolicyCompile,
+}
+
+var policyCompileFlags struct {
+	format      string
+	outputPath  string
+	values      []string
+	target      string
+	environment string
+	mirrorDir   string
+	cacheDir    string
+	fetch       bool
+}
+
+func newPolicyCmd() *cobra.Command {
+	policyCompileCmd.Flags().StringVarP(&policyCompileFlags.format, "format", "f", "", "Output format: yaml or json (default: from the output extension, else yaml)")
+	policyCompileCmd.Flags().StringVarP(&policyCompileFlags.outputPath, "output", "o", "", "Output path for the effective requirement set (default: stdout)")
+	policyCompileCmd.Flags().StringSliceVar(&policyCompileFlags.values, "values", nil, "Parameter-values files to bind (repeatable)")
+	policyCompileCmd.Flags().StringVar(&policyCompileFlags.target, "target", "", "Target id that selects target-specific parameter values")
+	policyCompileCmd.Flags().StringVar(&policyCompileFlags.environment, "environment", "", "Environment that selects environment-specific parameter values")
+	policyCompileCmd.Flags().StringVar(&policyCompileFlags.mirrorDir, "mirror", "", "Read-only directory mirroring http(s) artifacts as host/path")
+	policyCompileCmd.Flags().StringVar(&policyCompileFlags.cacheDir, "cache", "", "Directory where downloaded http(s) artifacts are cached")
+	policyCompileCmd.Flags().BoolVar(&policyCompileFlags.fetch, "fetch", false, "Download http(s) artifacts missing from the mirror and cache")
+	policyCmd.AddCommand(policyCompileCmd)
+	policyCmd.AddCommand(newPolicyApplicabilityCmd())
+	policyCmd.AddCommand(newPolicyConflictsCmd())
+	return policyCmd
+}
+
+func runPolicyCompile(cmd *cobra.Command, args []string) error {
+	file := args[0]
+	doc, err := readDocument(file)
+	if err != nil {
+		return err
+	}
+	src, err := loadArtifactSource(cuecontext.New(), file)
+	if err != nil {
+		src = nil
+	}
+
+	resolver := newArtifactResolver(policyCompileFlags.mirrorDir, policyCompileFlags.cacheDir, policyCompileFlags.fetch)
+	effective, diags := compilePolicy(file, doc, src, resolver)
+	if len(policyCompileFlags.values) > 0 {
+		values, err := bindValues(policyCompileFlags.values, policyCompileFlags.target, policyCompileFlags.environment)
+		if err != nil {
+			return err
+		}
+		diags = append(diags, checkParameterValues(file, doc, src, values)...)
+		for _, note := range effective.bindParameters(values) {
+			diags = append(diags, Diagnostic{File: file, Rule: ruleParameter, Severity: severityWarning, Message: note})
+		}
+	}
+	if len(diags) > 0 {
+		if err := writeTextDiagnostics(os.Stderr, []ValidationResult{{File: file, Diagnostics: diags}}); err != nil {
+			return err
+		}
+	}
+	if hasErrors(diags) {
+		return fmt.Errorf("compile %s: policy does not apply cleanly", file)
+	}
+
+	out := policyCompileFlags.outputPath
+	format := policyCompileFlags.format
+	if format == "" {
+		format = "yaml"
+		if out != "" && out != "-" {
+			format = documentFormat(out)
+		}
+	}
+	data, err := encodeDocument(effective, format)
+	if err != nil {
+		return err
+	}
+	if out == "" || out == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(out, data, 0644); err != nil {
+		return fmt.Errorf("write %s: %w", out, err)
+	}
+	return nil
+}
+
+// effectivePolicy is the requirement set a compiled policy asks for.
+type effectivePolicy struct {
+	Policy   string              `json:"policy" yaml:"policy"`
+	Title    string              `json:"title" yaml:"title"`
+	Catalogs []effectiveCatalog  `json:"catalogs,omitempty" yaml:"catalogs,omitempty"`
+	Guidance []effectiveGuidance `json:"guidance,omitempty" yaml:"guidance,omitempty"`
+
+	// Parameters are the values bound to the {{param}} placeholders.
+	Parameters map[string]string `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+}
+
+type effectiveCatalog struct {
+	ReferenceID string             `json:"reference-id" yaml:"reference-id"`
+	ID          string             `json:"id" yaml:"id"`
+	Title       string             `json:"title" yaml:"title"`
+	Controls    []effectiveControl `json:"controls" yaml:"controls"`
+
+	// index describes the flattened catalog, for following its references.
+	index *entryIndex
+}
+
+type effectiveControl struct {
+	ID           string                 `json:"id" yaml:"id"`
+	Title        string                 `json:"title" yaml:"title"`
+	Objective    string                 `json:"objective" yaml:"objective"`
+	Group        string                 `json:"group,omitempty" yaml:"group,omitempty"`
+	State        string                 `json:"state,omitempty" yaml:"state,omitempty"`
+	Requirements []effectiveRequirement `json:"assessment-requirements" yaml:"assessment-requirements"`
+	Constraints  []effectiveConstraint  `json:"constraints,omitempty" yaml:"constraints,omitempty"`
+
+	// threats are the threat entries the control maps to, as declared.
+	threats []entryRef
+}
+
+type effectiveRequirement struct {
+	ID             string                `json:"id" yaml:"id"`
+	Text           string                `json:"text" yaml:"text"`
+	Applicability  []string              `json:"applicability,omitempty" yaml:"applicability,omitempty"`
+	Recommendation string                `json:"recommendation,omitempty" yaml:"recommendation,omitempty"`
+	State          string                `json:"state,omitempty" yaml:"state,omitempty"`
+	ModifiedBy     []string              `json:"modified-by,omitempty" yaml:"modified-by,omitempty"`
+	Constraints    []effectiveConstraint `json:"constraints,omitempty" yaml:"constraints,omitempty"`
+}
+
+type effectiveGuidance struct {
+	ReferenceID string               `json:"reference-id" yaml:"reference-id"`
+	ID          string               `json:"id" yaml:"id"`
+	Title       string               `json:"title" yaml:"title"`
+	Guidelines  []effectiveGuideline `json:"guidelines" yaml:"guidelines"`
+}
+
+type effectiveGuideline struct {
+	ID          string                `json:"id" yaml:"id"`
+	Title       string                `json:"title" yaml:"title"`
+	Objective   string                `json:"objective" yaml:"objective"`
+	State       string                `json:"state,omitempty" yaml:"state,omitempty"`
+	Constraints []effectiveConstraint `json:"constraints,omitempty" yaml:"constraints,omitempty"`
+}
+
+type effectiveConstraint struct {
+	ID   string `json:"id" yaml:"id"`
+	Text string `json:"text" yaml:"text"`
+}
+
+// policyCompiler applies one policy to the catalogs it imports.
+type policyCompiler struct {
+	file     string
+	src      *artifactSource
+	resolver *artifactResolver
+	self     *entryIndex
+	diags    []Diagnostic
+}
+
+// compilePolicyFile compiles the policy doc read from file for a command
+// that builds on the effective policy. Diagnostics are printed to stderr,
+// and an error is returned when the policy does not compile. The parsed
+// source is returned for positioning later diagnostics; it is nil when the
+// file could not be loaded as CUE.
+func compilePolicyFile(file string, doc yaml.MapSlice, resolver *artifactResolver) (*effectivePolicy, *artifactSource, error) {
+	src, err := loadArtifactSource(cuecontext.New(), file)
+	if err != nil {
+		src = nil
+	}
+	effective, diags := compilePolicy(file, doc, src, resolver)
+	if len(diags) > 0 {
+		if err := writeTextDiagnostics(os.Stderr, []ValidationResult{{File: file, Diagnostics: diags}}); err != nil {
+			return nil, nil, err
+		}
+	}
+	if hasErrors(diags) {
+		return nil, nil, fmt.Errorf("%s does not compile", file)
+	}
+	return effective, src, nil
+}
+
+// compilePolicy resolves the catalog and guidance imports of the policy doc
+// and applies its exclusions, modifications, and constraints. Problems are
+// returned as diagnostics against the policy.
+func compilePolicy(file string, doc yaml.MapSlice, src *artifactSource, resolver *artifactResolver) (*effectivePolicy, []Diagnostic) {
+	c := &policyCompiler{file: file, src: src, resolver: resolver, self: indexEntries(doc)}
+	c.self.Dir = filepath.Dir(file)
+
+	effective := &effectivePolicy{Policy: c.self.ID, Title: mapString(doc, "title")}
+	imports := mapMap(doc, "imports")
+	for i, imp := range listMaps(mapList(imports, "catalogs")) {
+		path := []string{"imports", "catalogs", strconv.Itoa(i)}
+		if cat, ok := c.compileCatalog(imp, path); ok {
+			effective.Catalogs = append(effective.Catalogs, cat)
+		}
+	}
+	for i, imp := range listMaps(mapList(imports, "guidance")) {
+		path := []string{"imports", "guidance", strconv.Itoa(i)}
+		if g, ok := c.compileGuidance(imp, path); ok {
+			effective.Guidance = append(effective.Guidance, g)
+		}
+	}
+	sortDiagnostics(c.diags)
+	return effective, c.diags
+}
+
+// load resolves and flattens an imported catalog of the given type. The
+// returned index describes the flattened catalog.
+func (c *policyCompiler) load(refID, wantType string, path []string) (*entryIndex, bool) {
+	idx, err := c.resolver.follow(c.self, refID)
+	if err != nil {
+		c.report(severityError, appendPath(path, "reference-id"), refID, fmt.Sprintf("cannot load import: %v", err))
+		return nil, false
+	}
+	if idx.Type != wantType {
+		c.report(severityError, appendPath(path, "reference-id"), refID, fmt.Sprintf("%s is a %s, expected a %s", refID, idx.Type, wantType))
+		return nil, false
+	}
+	f := &flattener{resolver: c.resolver}
+	flat, err := f.flatten(idx, idx.Doc)
+	if err != nil {
+		c.report(severityError, appendPath(path, "reference-id"), refID, fmt.Sprintf("cannot flatten %s: %v", refID, err))
+		return nil, false
+	}
+	flatIdx := indexEntries(flat.doc)
+	flatIdx.Dir, flatIdx.Doc = idx.Dir, flat.doc
+	return flatIdx, true
+}
+
+func (c *policyCompiler) compileCatalog(imp yaml.MapSlice, path []string) (effectiveCatalog, bool) {
+	refID := mapString(imp, "reference-id")
+	idx, ok := c.load(refID, "ControlCatalog", path)
+	if !ok {
+		return effectiveCatalog{}, false
+	}
+	cat := effectiveCatalog{ReferenceID: refID, ID: idx.ID, Title: mapString(idx.Doc, "title"), index: idx}
+	for _, m := range listMaps(mapList(idx.Doc, "controls")) {
+		cat.Controls = append(cat.Controls, controlFromMap(m))
+	}
+
+	owner := make(map[string]string)
+	for _, ctl := range cat.Controls {
+		for _, ar := range ctl.Requirements {
+			owner[ar.ID] = ctl.ID
+		}
+	}
+	excluded := make(map[string]bool)
+	for i, id := range stringList(mapList(imp, "exclusions")) {
+		if !cat.exclude(id) {
+			c.report(severityWarning, appendPath(path, "exclusions", strconv.Itoa(i)), id,
+				fmt.Sprintf("exclusion %q matches no control or assessment requirement of %s", id, refID))
+		}
+		excluded[id] = true
+	}
+
+	for i, mod := range listMaps(mapList(imp, "assessment-requirement-modifications")) {
+		p := appendPath(path, "assessment-requirement-modifications", strconv.Itoa(i))
+		if msg := cat.modify(mod); msg != "" {
+			target := mapString(mod, "target-id")
+			if excluded[target] || excluded[owner[target]] {
+				msg = fmt.Sprintf("target-id %q is excluded by this import", target)
+			}
+			c.report(severityError, appendPath(p, "target-id"), target, msg)
+		}
+	}
+
+	for i, con := range listMaps(mapList(imp, "constraints")) {
+		target := mapString(con, "target-id")
+		if !cat.constrain(target, effectiveConstraint{ID: mapString(con, "id"), Text: mapString(con, "text")}) {
+			c.report(severityError, appendPath(path, "constraints", strconv.Itoa(i), "target-id"), target,
+				fmt.Sprintf("constraint target %q is not a control or assessment requirement of %s", target, refID))
+		}
+	}
+
+	cat.dropRetired()
+	return cat, true
+}
+
+func (c *policyCompiler) compileGuidance(imp yaml.MapSlice, path []string) (effectiveGuidance, bool) {
+	refID := mapString(imp, "reference-id")
+	idx, ok := c.load(refID, "GuidanceCatalog", path)
+	if !ok {
+		return effectiveGuidance{}, false
+	}
+	g := effectiveGuidance{ReferenceID: refID, ID: idx.ID, Title: mapString(idx.Doc, "title")}
+	for _, m := range listMaps(mapList(idx.Doc, "guidelines")) {
+		g.Guidelines = append(g.Guidelines, effectiveGuideline{
+			ID:        mapString(m, "id"),
+			Title:     mapString(m, "title"),
+			Objective: mapString(m, "objective"),
+			State:     mapString(m, "state"),
+		})
+	}
+
+	for i, id := range stringList(mapList(imp, "exclusions")) {
+		n := len(g.Guidelines)
+		g.Guidelines = removeGuideline(g.Guidelines, id)
+		if len(g.Guidelines) == n {
+			c.report(severityWarning, appendPath(path, "exclusions", strconv.Itoa(i)), id,
+				fmt.Sprintf("exclusion %q matches no guideline of %s", id, refID))
+		}
+	}
+	for i, con := range listMaps(mapList(imp, "constraints")) {
+		target := mapString(con, "target-id")
+		found := false
+		for j := range g.Guidelines {
+			if g.Guidelines[j].ID == target {
+				g.Guidelines[j].Constraints = append(g.Guidelines[j].Constraints, effectiveConstraint{ID: mapString(con, "id"), Text: mapString(con, "text")})
+				found = true
+			}
+		}
+		if !found {
+			c.report(severityError, appendPath(path, "constraints", strconv.Itoa(i), "target-id"), target,
+				fmt.Sprintf("constraint target %q is not a guideline of %s", target, refID))
+		}
+	}
+
+	kept := g.Guidelines[:0]
+	for _, gl := range g.Guidelines {
+		if gl.State != "Retired" {
+			kept = append(kept, gl)
+		}
+	}
+	g.Guidelines = kept
+	return g, true
+}
+
+func controlFromMap(m yaml.MapSlice) effectiveControl {
+	ctl := effectiveControl{
+		ID:        mapString(m, "id"),
+		Title:     mapString(m, "title"),
+		Objective: mapString(m, "objective"),
+		Group:     mapString(m, "group"),
+		State:     mapString(m, "state"),
+	}
+	for _, mapping := range listMaps(mapList(m, "threats")) {
+		for _, entry := range listMaps(mapList(mapping, "entries")) {
+			ctl.threats = append(ctl.threats, entryRef{RefID: mapString(mapping, "reference-id"), EntryID: mapString(entry, "reference-id")})
+		}
+	}
+	for _, ar := range listMaps(mapList(m, "assessment-requirements")) {
+		ctl.Requirements = append(ctl.Requirements, effectiveRequirement{
+			ID:             mapString(ar, "id"),
+			Text:           mapString(ar, "text"),
+			Applicability:  stringList(mapList(ar, "applicability")),
+			Recommendation: mapString(ar, "recommendation"),
+			State:          mapString(ar, "state"),
+		})
+	}
+	return ctl
+}
+
+// exclude removes the control or assessment requirement with id, reporting
+// whether there was one.
+func (cat *effectiveCatalog) exclude(id string) bool {
+	for i, ctl := range cat.Controls {
+		if ctl.ID == id {
+			cat.Controls = append(cat.Controls[:i], cat.Controls[i+1:]...)
+			return true
+		}
+	}
+	for i := range cat.Controls {
+		if j := cat.Controls[i].requirement(id); j >= 0 {
+			cat.Controls[i].Requirements = append(cat.Controls[i].Requirements[:j], cat.Controls[i].Requirements[j+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// modify applies one assessment-requirement-modification, returning why it
+// could not be applied.
+func (cat *effectiveCatalog) modify(mod yaml.MapSlice) string {
+	id, target := mapString(mod, "id"), mapString(mod, "target-id")
+	kind := mapString(mod, "modification-type")
+
+	if kind == "Add" {
+		for i := range cat.Controls {
+			ctl := &cat.Controls[i]
+			if ctl.ID != target {
+				continue
+			}
+			if ctl.requirement(id) >= 0 {
+				return fmt.Sprintf("Add would duplicate assessment requirement %q of %s", id, target)
+			}
+			ar := effectiveRequirement{ID: id}
+			ar.apply(mod)
+			ctl.Requirements = append(ctl.Requirements, ar)
+			return ""
+		}
+		return fmt.Sprintf("target-id %q is not a control of %s", target, cat.ReferenceID)
+	}
+
+	for i := range cat.Controls {
+		ctl := &cat.Controls[i]
+		j := ctl.requirement(target)
+		if j < 0 {
+			continue
+		}
+		switch kind {
+		case "Modify", "Override":
+			ctl.Requirements[j].apply(mod)
+		case "Replace":
+			ar := effectiveRequirement{ID: id}
+			ar.apply(mod)
+			ctl.Requirements[j] = ar
+		case "Remove":
+			ctl.Requirements = append(ctl.Requirements[:j], ctl.Requirements[j+1:]...)
+		default:
+			return fmt.Sprintf("unknown modification-type %q", kind)
+		}
+		return ""
+	}
+	return fmt.Sprintf("target-id %q is not an assessment requirement of %s", target, cat.ReferenceID)
+}
+
+// constrain attaches con to the control or assessment requirement target.
+func (cat *effectiveCatalog) constrain(target string, con effectiveConstraint) bool {
+	for i := range cat.Controls {
+		ctl := &cat.Controls[i]
+		if ctl.ID == target {
+			ctl.Constraints = append(ctl.Constraints, con)
+			return true
+		}
+		if j := ctl.requirement(target); j >= 0 {
+			ctl.Requirements[j].Constraints = append(ctl.Requirements[j].Constraints, con)
+			return true
+		}
+	}
+	return false
+}
+
+// dropRetired removes Retired controls and assessment requirements, which
+// the organization no longer has to meet.
+func (cat *effectiveCatalog) dropRetired() {
+	controls := cat.Controls[:0]
+	for _, ctl := range cat.Controls {
+		if ctl.State == "Retired" {
+			continue
+		}
+		reqs := ctl.Requirements[:0]
+		for _, ar := range ctl.Requirements {
+			if ar.State != "Retired" {
+				reqs = append(reqs, ar)
+			}
+		}
+		ctl.Requirements = reqs
+		controls = append(controls, ctl)
+	}
+	cat.Controls = controls
+}
+
+func (ctl *effectiveControl) requirement(id string) int {
+	for i, ar := range ctl.Requirements {
+		if ar.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// apply sets the fields a modification provides and records it.
+func (ar *effectiveRequirement) apply(mod yaml.MapSlice) {
+	if text := mapString(mod, "text"); text != "" {
+		ar.Text = text
+	}
+	if applicability := stringList(mapList(mod, "applicability")); len(applicability) > 0 {
+		ar.Applicability = applicability
+	}
+	if rec := mapString(mod, "recommendation"); rec != "" {
+		ar.Recommendation = rec
+	}
+	ar.ModifiedBy = append(ar.ModifiedBy, mapString(mod, "id"))
+}
+
+func removeGuideline(list []effectiveGuideline, id string) []effectiveGuideline {
+	for i, g := range list {
+		if g.ID == id {
+			return append(list[:i], list[i+1:]...)
+		}
+	}
+	return list
+}
+
+// stringList returns the string elements of a list.
+func stringList(l []interface{}) []string {
+	var out []string
+	for _, v := range l {
+		if s, ok := v.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func (c *policyCompiler) report(severity string, path []string, value, msg string) {
+	c.diags = append(c.diags, diagnosticAt(c.file, c.src, rulePolicy, severity, path, value, msg))
+}
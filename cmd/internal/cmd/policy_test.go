@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompilePolicy(t *testing.T) {
+	file := "testdata/compile-policy.yaml"
+	doc, err := readDocument(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	effective, diags := compilePolicy(file, doc, nil, newArtifactResolver("", "", false))
+
+	want := map[string]string{
+		`imports.catalogs[0].exclusions[1]`:                                         severityWarning,
+		`imports.catalogs[0].constraints[2]."target-id"`:                            severityError,
+		`imports.catalogs[0]."assessment-requirement-modifications"[4]."target-id"`: severityError,
+	}
+	for _, d := range diags {
+		severity, ok := want[d.Path]
+		if !ok {
+			t.Errorf("unexpected diagnostic at %s: %s", d.Path, d.Message)
+			continue
+		}
+		if d.Severity != severity {
+			t.Errorf("%s: severity %s, want %s", d.Path, d.Severity, severity)
+		}
+		delete(want, d.Path)
+	}
+	for path := range want {
+		t.Errorf("missing diagnostic at %s", path)
+	}
+
+	if len(effective.Catalogs) != 1 || len(effective.Guidance) != 1 {
+		t.Fatalf("expected one catalog and one guidance import, got %d and %d", len(effective.Catalogs), len(effective.Guidance))
+	}
+	var got []string
+	for _, ctl := range effective.Catalogs[0].Controls {
+		var reqs []string
+		for _, ar := range ctl.Requirements {
+			reqs = append(reqs, ar.ID)
+		}
+		got = append(got, ctl.ID+"["+strings.Join(reqs, ",")+"]")
+	}
+	if got, want := strings.Join(got, " "), "FB-02[] FB-01[FB-01.AR01,FB-01.AR02] FX-01[FX-01.AR02]"; got != want {
+		t.Errorf("controls = %s, want %s", got, want)
+	}
+	fb01 := effective.Catalogs[0].Controls[1]
+	if fb01.Requirements[0].Text != "Stored data MUST be encrypted with AES-256." || len(fb01.Constraints) != 1 {
+		t.Errorf("FB-01 not modified and constrained: %+v", fb01)
+	}
+
+	guidelines := effective.Guidance[0].Guidelines
+	if len(guidelines) != 1 || guidelines[0].ID != "GL-01" || len(guidelines[0].Constraints) != 1 {
+		t.Errorf("unexpected guidelines: %+v", guidelines)
+	}
+}
@@ -0,0 +1,557 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+)
+
+// artifactResolver loads the artifacts that mapping-reference urls point
+// at. file:// urls are read directly (relative paths resolve against the
+// referencing artifact); http(s) urls are looked up in a read-only mirror
+// directory, then in a cache directory, and are only downloaded (into the
+// cache) when fetching is enabled. Both directories use the host/path
+// layout of the url, e.g. mirror/aigf.finos.org/risks.yaml. Local paths
+// registered for a mapping-reference id (by a workspace) take precedence
+// over the url.
+type artifactResolver struct {
+	mirrorDir string
+	cacheDir  string
+	fetch     bool
+	client    *http.Client
+	maxSize   int64
+	local     map[string]string
+
+	loaded map[string]*entryIndex
+	failed map[string]error
+}
+
+// maxArtifactSize caps how much of a downloaded artifact is read; Gemara
+// artifacts are far smaller, so anything larger is not one.
+const maxArtifactSize = 32 << 20
+
+func newArtifactResolver(mirrorDir, cacheDir string, fetch bool) *artifactResolver {
+	return &artifactResolver{
+		mirrorDir: mirrorDir,
+		cacheDir:  cacheDir,
+		fetch:     fetch,
+		client:    &http.Client{Timeout: 30 * time.Second},
+		maxSize:   maxArtifactSize,
+		local:     make(map[string]string),
+		loaded:    make(map[string]*entryIndex),
+		failed:    make(map[string]error),
+	}
+}
+
+// entryIndex lists the entries an artifact defines, keyed by id, with the
+// collection each one is listed under (controls, threats, ...), along with
+// what is needed to follow references out of the artifact.
+type entryIndex struct {
+	ID      string
+	Type    string
+	Draft   bool
+	Entries map[string]string
+
+	// States holds explicitly set lifecycle states; entries without one
+	// are Active.
+	States map[string]string
+	// ReplacedBy holds the replaced-by mapping of each entry that has one.
+	ReplacedBy map[string]entryRef
+	// URLs maps mapping-reference ids to their urls, and Dir is the
+	// directory relative file:// urls resolve against.
+	URLs map[string]string
+	Dir  string
+
+	// Doc is the decoded artifact; it is shared and must not be modified.
+	Doc yaml.MapSlice
+}
+
+// entryRef names an entry of the artifact behind a mapping reference.
+type entryRef struct {
+	RefID   string
+	EntryID string
+}
+
+// state returns the lifecycle state of an entry, defaulting to Active.
+func (idx *entryIndex) state(id string) string {
+	if s, ok := idx.States[id]; ok {
+		return s
+	}
+	return "Active"
+}
+
+// resolve loads and indexes the artifact at rawURL, at most once per url.
+func (r *artifactResolver) resolve(rawURL, baseDir string) (*entryIndex, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url %q: %w", rawURL, err)
+	}
+	u.Fragment = ""
+
+	key, dir := u.String(), ""
+	if u.Scheme == "file" {
+		key = filePath(u, baseDir)
+		dir = filepath.Dir(key)
+	}
+	return r.cached(key, dir, func() ([]byte, error) {
+		switch u.Scheme {
+		case "file":
+			return os.ReadFile(key)
+		case "http", "https":
+			return r.readRemote(u)
+		default:
+			return nil, fmt.Errorf("unsupported url scheme %q", u.Scheme)
+		}
+	})
+}
+
+// resolveLocal loads the artifact registered for refID, reporting false
+// when no local path is registered.
+func (r *artifactResolver) resolveLocal(refID string) (*entryIndex, bool, error) {
+	path, ok := r.local[refID]
+	if !ok {
+		return nil, false, nil
+	}
+	idx, err := r.cached(path, filepath.Dir(path), func() ([]byte, error) { return os.ReadFile(path) })
+	return idx, true, err
+}
+
+// follow resolves refID as seen from the artifact from: the artifact
+// itself, a locally registered path, or the url from declares for it.
+func (r *artifactResolver) follow(from *entryIndex, refID string) (*entryIndex, error) {
+	if refID == from.ID {
+		return from, nil
+	}
+	if idx, ok, err := r.resolveLocal(refID); ok {
+		return idx, err
+	}
+	u, ok := from.URLs[refID]
+	if !ok {
+		return nil, fmt.Errorf("%s does not declare mapping reference %q", from.ID, refID)
+	}
+	if u == "" {
+		return nil, fmt.Errorf("mapping reference %q has no url", refID)
+	}
+	return r.resolve(u, from.Dir)
+}
+
+func (r *artifactResolver) cached(key, dir string, read func() ([]byte, error)) (*entryIndex, error) {
+	if idx, ok := r.loaded[key]; ok {
+		return idx, nil
+	}
+	if err, ok := r.failed[key]; ok {
+		return nil, err
+	}
+	idx, err := r.load(key, read)
+	if err != nil {
+		r.failed[key] = err
+		return nil, err
+	}
+	idx.Dir = dir
+	r.loaded[key] = idx
+	return idx, nil
+}
+
+func (r *artifactResolver) load(key string, read func() ([]byte, error)) (*entryIndex, error) {
+	data, err := read()
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := decodeDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not YAML or JSON: %w", key, err)
+	}
+	m, ok := doc.(yaml.MapSlice)
+	if !ok || mapMap(m, "metadata") == nil {
+		return nil, fmt.Errorf("%s is not a Gemara artifact", key)
+	}
+	idx := indexEntries(m)
+	idx.Doc = m
+	return idx, nil
+}
+
+// filePath turns a file:// url into a local path. file:///abs/path is
+// absolute; file://rel/path and file://./rel/path are relative to baseDir.
+func filePath(u *url.URL, baseDir string) string {
+	p := filepath.FromSlash(u.Host + u.Path)
+	if u.Host == "" || filepath.IsAbs(p) {
+		return filepath.FromSlash(u.Path)
+	}
+	return filepath.Join(baseDir, p)
+}
+
+// fileURL returns a file:// url for path that resolves from dir: relative
+// when both are on the same volume, so generated artifacts stay portable.
+func fileURL(path, dir string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "file://" + filepath.ToSlash(path)
+	}
+	if base, err := filepath.Abs(dir); err == nil {
+		if rel, err := filepath.Rel(base, abs); err == nil {
+			return "file://" + filepath.ToSlash(rel)
+		}
+	}
+	return "file://" + filepath.ToSlash(abs)
+}
+
+// rebaseReference copies a mapping reference read from an artifact in
+// fromDir into one written to toDir, rewriting a relative file:// url so
+// it still points at the same file.
+func rebaseReference(ref yaml.MapSlice, fromDir, toDir string) yaml.MapSlice {
+	u, err := url.Parse(mapString(ref, "url"))
+	if err != nil || u.Scheme != "file" || u.Host == "" {
+		return ref
+	}
+	return mapSet(append(yaml.MapSlice(nil), ref...), "url", fileURL(filePath(u, fromDir), toDir))
+}
+
+func (r *artifactResolver) readRemote(u *url.URL) ([]byte, error) {
+	rel, err := mirrorPath(u)
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range []string{r.mirrorDir, r.cacheDir} {
+		if dir == "" {
+			continue
+		}
+		for _, p := range mirrorCandidates(dir, rel, u) {
+			if data, err := os.ReadFile(p); err == nil {
+				return data, nil
+			}
+		}
+	}
+	if !r.fetch {
+		return nil, fmt.Errorf("%s is not mirrored or cached (use --mirror, --cache, or --fetch)", u)
+	}
+
+	resp, err := r.client.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %s: %s", u, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, r.maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", u, err)
+	}
+	if int64(len(data)) > r.maxSize {
+		return nil, fmt.Errorf("fetch %s: larger than %d bytes", u, r.maxSize)
+	}
+
+	if r.cacheDir != "" {
+		p := mirrorCandidates(r.cacheDir, rel, u)[0]
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(p, data, 0644); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// mirrorPath is where a url is stored relative to a mirror or cache
+// directory: its host and path, with dot segments resolved. A url whose
+// path climbs out of its host's directory is refused, so that neither a
+// mirror read nor a cached download can reach outside the directory.
+func mirrorPath(u *url.URL) (string, error) {
+	rel := filepath.Join(u.Host, filepath.FromSlash(u.Path))
+	if u.Host == "" || !filepath.IsLocal(rel) || (rel != u.Host && !strings.HasPrefix(rel, u.Host+string(filepath.Separator))) {
+		return "", fmt.Errorf("%s: path leaves the directory of host %q", u, u.Host)
+	}
+	return rel, nil
+}
+
+// mirrorCandidates lists where the url u, stored at rel (see mirrorPath),
+// may be found under dir. The first entry is where downloads are cached;
+// urls naming a directory or lacking an extension may also be stored with
+// a .yaml, .yml, or .json suffix.
+func mirrorCandidates(dir, rel string, u *url.URL) []string {
+	base := filepath.Join(dir, rel)
+	if u.Path == "" || strings.HasSuffix(u.Path, "/") {
+		base = filepath.Join(base, "index")
+	}
+	if u.RawQuery != "" {
+		base += "_" + url.PathEscape(u.RawQuery)
+	}
+	candidates := []string{base}
+	if filepath.Ext(base) == "" || strings.HasSuffix(base, "index") {
+		for _, ext := range []string{".yaml", ".yml", ".json"} {
+			candidates = append(candidates, base+ext)
+		}
+	}
+	return candidates
+}
+
+// indexEntries collects the ids of every list entry outside metadata,
+// recording the key of the list that holds it and its lifecycle.
+func indexEntries(doc yaml.MapSlice) *entryIndex {
+	meta := mapMap(doc, "metadata")
+	draft, _ := mapGet(meta, "draft")
+	idx := &entryIndex{
+		ID:         mapString(meta, "id"),
+		Type:       mapString(meta, "type"),
+		Draft:      draft == true,
+		Entries:    make(map[string]string),
+		States:     make(map[string]string),
+		ReplacedBy: make(map[string]entryRef),
+		URLs:       make(map[string]string),
+	}
+	for _, ref := range listMaps(mapList(meta, "mapping-references")) {
+		idx.URLs[mapString(ref, "id")] = mapString(ref, "url")
+	}
+	var walk func(v interface{}, key string)
+	walk = func(v interface{}, key string) {
+		switch d := v.(type) {
+		case yaml.MapSlice:
+			for _, item := range d {
+				k := fmt.Sprint(item.Key)
+				if k != "metadata" {
+					walk(item.Value, k)
+				}
+			}
+		case []interface{}:
+			for _, elem := range d {
+				if m, ok := elem.(yaml.MapSlice); ok {
+					if id := mapString(m, "id"); id != "" {
+						if _, seen := idx.Entries[id]; !seen {
+							idx.Entries[id] = key
+							if state := mapString(m, "state"); state != "" {
+								idx.States[id] = state
+							}
+							if rb := mapMap(m, "replaced-by"); rb != nil {
+								idx.ReplacedBy[id] = entryRef{RefID: mapString(rb, "reference-id"), EntryID: mapString(rb, "entry-id")}
+							}
+						}
+					}
+				}
+				walk(elem, key)
+			}
+		}
+	}
+	walk(doc, "")
+	return idx
+}
+
+// expectedCollections names the collection an entry reference under a key
+// must point into; replaced-by must point into its own entry's collection.
+var expectedCollections = map[string]string{
+	"threats":      "threats",
+	"capabilities": "capabilities",
+	"vectors":      "vectors",
+	"principles":   "principles",
+	"guidelines":   "guidelines",
+	"control":      "controls",
+	"requirement":  "assessment-requirements",
+	"risk":         "risks",
+}
+
+// referenceCheck checks the entry references of one artifact.
+type referenceCheck struct {
+	file     string
+	baseDir  string
+	src      *artifactSource
+	resolver *artifactResolver
+
+	self   *entryIndex
+	refs   map[string]int
+	urls   map[string]string
+	warned map[string]bool
+	diags  []Diagnostic
+}
+
+// checkReferences reports mapping references that are not declared and
+// entry references that do not resolve to an entry of the referenced
+// artifact. References that cannot be loaded are reported as warnings.
+func checkReferences(file string, doc yaml.MapSlice, src *artifactSource, resolver *artifactResolver) []Diagnostic {
+	c := &referenceCheck{
+		file:     file,
+		baseDir:  filepath.Dir(file),
+		src:      src,
+		resolver: resolver,
+		self:     indexEntries(doc),
+		refs:     make(map[string]int),
+		urls:     make(map[string]string),
+		warned:   make(map[string]bool),
+	}
+	for i, ref := range listMaps(mapList(mapMap(doc, "metadata"), "mapping-references")) {
+		id := mapString(ref, "id")
+		c.refs[id] = i
+		c.urls[id] = mapString(ref, "url")
+	}
+
+	c.walk(doc, nil, "", "")
+	c.checkMappings(doc)
+	sortDiagnostics(c.diags)
+	return c.diags
+}
+
+func (c *referenceCheck) walk(v interface{}, path []string, key, collection string) {
+	switch d := v.(type) {
+	case yaml.MapSlice:
+		if refID := mapString(d, "reference-id"); refID != "" && key != "entries" {
+			c.checkMapping(d, refID, path, key, collection)
+		}
+		for _, item := range d {
+			k := fmt.Sprint(item.Key)
+			c.walk(item.Value, appendPath(path, k), k, collection)
+		}
+	case []interface{}:
+		for i, elem := range d {
+			inner := collection
+			if m, ok := elem.(yaml.MapSlice); ok && mapString(m, "id") != "" {
+				inner = key
+			}
+			c.walk(elem, appendPath(path, strconv.Itoa(i)), key, inner)
+		}
+	}
+}
+
+// checkMapping handles the three mapping shapes: #EntryMapping (entry-id),
+// #MultiEntryMapping (entries), and imports with exclusions; a bare
+// #ArtifactMapping only needs its reference-id declared.
+func (c *referenceCheck) checkMapping(m yaml.MapSlice, refID string, path []string, key, collection string) {
+	if !c.declared(refID, appendPath(path, "reference-id")) {
+		return
+	}
+	if key == "log" {
+		// EvaluationLog entries have no ids; verify follows finding logs.
+		return
+	}
+	expected := expectedCollections[key]
+	if key == "replaced-by" {
+		expected = collection
+	}
+
+	if entryID := mapString(m, "entry-id"); entryID != "" {
+		if idx := c.artifact(refID); idx != nil {
+			c.entry(idx, refID, entryID, expected, appendPath(path, "entry-id"))
+		}
+		return
+	}
+	entries := listMaps(mapList(m, "entries"))
+	exclusions := mapList(m, "exclusions")
+	if len(entries) == 0 && len(exclusions) == 0 {
+		return
+	}
+	idx := c.artifact(refID)
+	if idx == nil {
+		return
+	}
+	for i, e := range entries {
+		c.entry(idx, refID, mapString(e, "reference-id"), expected, appendPath(path, "entries", strconv.Itoa(i), "reference-id"))
+	}
+	for i, e := range exclusions {
+		if id, ok := e.(string); ok {
+			c.entry(idx, refID, id, "", appendPath(path, "exclusions", strconv.Itoa(i)))
+		}
+	}
+}
+
+// checkMappings resolves the entries of a MappingDocument against its
+// source and target artifacts.
+func (c *referenceCheck) checkMappings(doc yaml.MapSlice) {
+	sourceRef := mapString(mapMap(doc, "source-reference"), "reference-id")
+	targetRef := mapString(mapMap(doc, "target-reference"), "reference-id")
+	if sourceRef == "" && targetRef == "" {
+		return
+	}
+	var source, target *entryIndex
+	for i, m := range listMaps(mapList(doc, "mappings")) {
+		path := []string{"mappings", strconv.Itoa(i)}
+		if id := mapString(m, "source"); id != "" && c.known(sourceRef) {
+			if source == nil {
+				source = c.artifact(sourceRef)
+			}
+			if source != nil {
+				c.entry(source, sourceRef, id, "", appendPath(path, "source"))
+			}
+		}
+		for j, t := range listMaps(mapList(m, "targets")) {
+			if id := mapString(t, "entry-id"); id != "" && c.known(targetRef) {
+				if target == nil {
+					target = c.artifact(targetRef)
+				}
+				if target != nil {
+					c.entry(target, targetRef, id, "", appendPath(path, "targets", strconv.Itoa(j), "entry-id"))
+				}
+			}
+		}
+	}
+}
+
+func (c *referenceCheck) known(refID string) bool {
+	_, ok := c.refs[refID]
+	return ok || (refID != "" && refID == c.self.ID)
+}
+
+func (c *referenceCheck) declared(refID string, path []string) bool {
+	if c.known(refID) {
+		return true
+	}
+	c.report(severityError, path, refID, fmt.Sprintf("reference-id %q is not declared in metadata.mapping-references", refID))
+	return false
+}
+
+// artifact returns the index of the artifact refID names, warning once per
+// reference when it cannot be loaded.
+func (c *referenceCheck) artifact(refID string) *entryIndex {
+	if refID == c.self.ID {
+		return c.self
+	}
+	refPath := []string{"metadata", "mapping-references", strconv.Itoa(c.refs[refID])}
+	if idx, ok, err := c.resolver.resolveLocal(refID); ok {
+		if err != nil {
+			c.warnOnce(refID, appendPath(refPath, "id"), fmt.Sprintf("cannot load mapping reference %q: %v", refID, err))
+			return nil
+		}
+		return idx
+	}
+	u := c.urls[refID]
+	if u == "" {
+		c.warnOnce(refID, appendPath(refPath, "id"), fmt.Sprintf("mapping reference %q has no url; its entries cannot be checked", refID))
+		return nil
+	}
+	idx, err := c.resolver.resolve(u, c.baseDir)
+	if err != nil {
+		c.warnOnce(refID, appendPath(refPath, "url"), fmt.Sprintf("cannot load mapping reference %q: %v", refID, err))
+		return nil
+	}
+	return idx
+}
+
+func (c *referenceCheck) entry(idx *entryIndex, refID, entryID, expected string, path []string) {
+	collection, ok := idx.Entries[entryID]
+	switch {
+	case !ok:
+		c.report(severityError, path, entryID, fmt.Sprintf("dangling reference: %q is not an entry of %s", entryID, refID))
+	case expected != "" && collection != expected:
+		c.report(severityError, path, entryID, fmt.Sprintf("%q is listed under %s in %s, expected one of its %s", entryID, collection, refID, expected))
+	}
+}
+
+func (c *referenceCheck) warnOnce(refID string, path []string, msg string) {
+	if c.warned[refID] {
+		return
+	}
+	c.warned[refID] = true
+	c.report(severityWarning, path, "", msg)
+}
+
+func (c *referenceCheck) report(severity string, path []string, value, msg string) {
+	c.diags = append(c.diags, diagnosticAt(c.file, c.src, ruleReference, severity, path, value, msg))
+}
@@ -0,0 +1,159 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+)
+
+func TestCheckReferences(t *testing.T) {
+	file := "testdata/refs-control-catalog.yaml"
+	doc, err := readDocument(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diags := checkReferences(file, doc, nil, newArtifactResolver("", "", false))
+
+	want := map[string]string{
+		`controls[0].threats[0].entries[1]."reference-id"`: "TH-999",
+		`controls[0].threats[0].entries[2]."reference-id"`: "tampering",
+		`controls[0].threats[1]."reference-id"`:            "UNDECLARED",
+		`controls[1]."replaced-by"."entry-id"`:             "RC-404",
+	}
+	for _, d := range diags {
+		if d.Severity != severityError {
+			t.Errorf("unexpected %s at %s: %s", d.Severity, d.Path, d.Message)
+			continue
+		}
+		value, ok := want[d.Path]
+		if !ok {
+			t.Errorf("unexpected diagnostic at %s: %s", d.Path, d.Message)
+			continue
+		}
+		if d.Value != value {
+			t.Errorf("%s: value %q, want %q", d.Path, d.Value, value)
+		}
+		delete(want, d.Path)
+	}
+	for path := range want {
+		t.Errorf("missing diagnostic at %s", path)
+	}
+}
+
+func TestResolveReferencedArtifact(t *testing.T) {
+	r := newArtifactResolver("", "", false)
+	idx, err := r.resolve("file://refs-threat-catalog.yaml", "testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.Entries["TH-001"] != "threats" || idx.Entries["tampering"] != "groups" {
+		t.Errorf("unexpected entries: %v", idx.Entries)
+	}
+	if _, err := r.resolve("https://example.com/catalog.yaml", "testdata"); err == nil {
+		t.Error("expected an error for an http url that is not mirrored")
+	}
+}
+
+func TestRebaseReference(t *testing.T) {
+	for _, tc := range []struct {
+		url, from, to, want string
+	}{
+		{"file://catalog.yaml", "testdata", ".", "file://testdata/catalog.yaml"},
+		{"file://./catalog.yaml", "testdata", "testdata", "file://catalog.yaml"},
+		{"file://../catalog.yaml", "testdata/policies", "out", "file://../testdata/catalog.yaml"},
+		{"file:///srv/catalog.yaml", "testdata", "out", "file:///srv/catalog.yaml"},
+		{"https://example.com/catalog.yaml", "testdata", "out", "https://example.com/catalog.yaml"},
+	} {
+		ref := yaml.MapSlice{{Key: "id", Value: "CAT"}, {Key: "url", Value: tc.url}}
+		if got := mapString(rebaseReference(ref, tc.from, tc.to), "url"); got != tc.want {
+			t.Errorf("rebase %s from %s to %s = %s, want %s", tc.url, tc.from, tc.to, got, tc.want)
+		}
+		if mapString(ref, "url") != tc.url {
+			t.Errorf("rebase %s modified its input", tc.url)
+		}
+	}
+}
+
+func TestReadRemoteLimit(t *testing.T) {
+	data, err := os.ReadFile("testdata/refs-threat-catalog.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write(data)
+	}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL + "/catalog.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newArtifactResolver("", t.TempDir(), true)
+	r.maxSize = int64(len(data))
+	if got, err := r.readRemote(u); err != nil || len(got) != len(data) {
+		t.Errorf("artifact at the cap: %d bytes, %v", len(got), err)
+	}
+
+	cache := t.TempDir()
+	r = newArtifactResolver("", cache, true)
+	r.maxSize = int64(len(data)) - 1
+	if _, err := r.readRemote(u); err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Errorf("expected a size error, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cache, u.Host, "catalog.yaml")); !os.IsNotExist(err) {
+		t.Errorf("oversized artifact was cached: %v", err)
+	}
+}
+
+func TestReadRemoteDotSegments(t *testing.T) {
+	fetched := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fetched = true
+		_, _ = w.Write([]byte("metadata: {}\n"))
+	}))
+	defer srv.Close()
+
+	root := t.TempDir()
+	cache := filepath.Join(root, "cache")
+	host := strings.TrimPrefix(srv.URL, "http://")
+	for _, raw := range []string{
+		srv.URL + "/../../pwned.yaml",
+		srv.URL + "/a/../../other-host/pwned.yaml",
+	} {
+		// url.Parse keeps the dot segments of the path.
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := newArtifactResolver(root, cache, true)
+		if _, err := r.readRemote(u); err == nil {
+			t.Errorf("%s: expected the reference to be refused", raw)
+		}
+	}
+	if fetched {
+		t.Error("a refused reference was downloaded")
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 0 {
+		t.Errorf("files were written: %v", entries)
+	}
+
+	u, err := url.Parse(srv.URL + "/a/../catalog.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newArtifactResolver("", cache, true).readRemote(u); err != nil {
+		t.Errorf("dot segments inside the host directory: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cache, host, "catalog.yaml")); err != nil {
+		t.Errorf("download was not cached under the host directory: %v", err)
+	}
+}
@@ -0,0 +1,333 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+	"github.com/spf13/cobra"
+)
+
+var resultsCmd = &cobra.Command{
+	Use:   "results [files...]",
+	Short: "Check that EvaluationLog results agree with the assessments they aggregate",
+	Long: `Check the results recorded in EvaluationLogs for internal consistency:
+
+  result-aggregate  Each control evaluation's result must be the aggregate
+                    of its assessment logs, and the log's result the
+                    aggregate of its control evaluations.
+  result-steps      steps-executed must not exceed the number of steps.
+  result-timing     An assessment's end must not be before its start.
+
+Results aggregate by precedence, the first one present winning:
+
+  Failed > Needs Review > Unknown > Passed > Not Applicable > Not Run
+
+so a control with one Failed assessment is Failed, and one whose
+assessments were all Not Applicable is Not Applicable.
+
+With --fix, control and log results that disagree are recomputed and the
+files are rewritten in place; comments and formatting of YAML files are
+kept. Step and timing problems cannot be derived and are still reported.`,
+	Args:          cobra.MinimumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE:          runResults,
+}
+
+var resultsFlags struct {
+	format     string
+	outputPath string
+	fix        bool
+}
+
+func newResultsCmd() *cobra.Command {
+	resultsCmd.Flags().StringVarP(&resultsFlags.format, "format", "f", "text", "Output format: text, json, sarif, or github")
+	resultsCmd.Flags().StringVarP(&resultsFlags.outputPath, "output", "o", "", "Write the report to a file instead of stdout")
+	resultsCmd.Flags().BoolVar(&resultsFlags.fix, "fix", false, "Recompute control and log results and rewrite the files")
+	return resultsCmd
+}
+
+func runResults(cmd *cobra.Command, args []string) error {
+	ctx := cuecontext.New()
+	var results []ValidationResult
+	for _, file := range args {
+		result, err := checkResultFile(ctx, file, resultsFlags.fix)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+	}
+
+	if err := writeReport(resultsFlags.outputPath, func(w io.Writer) error {
+		return writeDiagnostics(w, resultsFlags.format, results)
+	}); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, r := range results {
+		if !r.Valid {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d log(s) have inconsistent results", failed, len(results))
+	}
+	return nil
+}
+
+// checkResultFile checks the results of the EvaluationLog in file and, with
+// fix, rewrites the ones it can derive. A file that cannot be read or is
+// not an EvaluationLog is reported in the result, so that the remaining
+// files are still checked (and possibly fixed).
+func checkResultFile(ctx *cue.Context, file string, fix bool) (ValidationResult, error) {
+	result := ValidationResult{File: file, Definition: "result rules"}
+	doc, err := readDocument(file)
+	if err != nil {
+		result.Diagnostics = fileDiagnostics(err, file, ruleSyntax)
+		return result, nil
+	}
+	src, err := loadArtifactSource(ctx, file)
+	if err != nil {
+		src = nil
+	}
+	if typ := mapString(mapMap(doc, "metadata"), "type"); typ != "EvaluationLog" {
+		result.Diagnostics = []Diagnostic{diagnosticAt(file, src, ruleSchema, severityError, []string{"metadata", "type"}, typ,
+			fmt.Sprintf("%s is a %s, expected an EvaluationLog", file, typ))}
+		return result, nil
+	}
+
+	diags, fixes := checkResults(file, doc, src)
+	if fix && len(fixes) > 0 {
+		if err := applyResultFixes(file, doc, fixes); err != nil {
+			return result, err
+		}
+		fmt.Fprintf(os.Stderr, "%s: fixed %d result(s)\n", file, len(fixes))
+		diags = withoutRule(diags, ruleResultAggregate)
+	}
+	result.Diagnostics = diags
+	result.Valid = !hasErrors(diags)
+	return result, nil
+}
+
+// aggregateResult combines results by resultRank: the result with the
+// lowest rank wins. No results, or only unrecognised ones, aggregate to
+// Not Run.
+func aggregateResult(results []string) string {
+	out := "Not Run"
+	for _, r := range results {
+		if rank, ok := resultRank[r]; ok && rank < resultRank[out] {
+			out = r
+		}
+	}
+	return out
+}
+
+// resultFix replaces the result at a YAML path with a recomputed one.
+type resultFix struct {
+	Path  []string
+	Value string
+}
+
+// resultCheck runs the result rules over one EvaluationLog.
+type resultCheck struct {
+	file  string
+	src   *artifactSource
+	diags []Diagnostic
+	fixes []resultFix
+}
+
+// checkResults returns the result diagnostics for the EvaluationLog doc
+// and the fixes that would make its aggregate results consistent.
+func checkResults(file string, doc yaml.MapSlice, src *artifactSource) ([]Diagnostic, []resultFix) {
+	c := &resultCheck{file: file, src: src}
+
+	var controls []string
+	for i, eval := range listMaps(mapList(doc, "evaluations")) {
+		path := []string{"evaluations", strconv.Itoa(i)}
+		var assessments []string
+		for j, log := range listMaps(mapList(eval, "assessment-logs")) {
+			c.checkAssessment(appendPath(path, "assessment-logs", strconv.Itoa(j)), log)
+			assessments = append(assessments, mapString(log, "result"))
+		}
+		derived := aggregateResult(assessments)
+		if got := mapString(eval, "result"); got != derived {
+			c.mismatch(appendPath(path, "result"), got, derived,
+				fmt.Sprintf("control evaluation %q is %s but its assessment logs aggregate to %s", mapString(eval, "name"), got, derived))
+		}
+		controls = append(controls, derived)
+	}
+
+	derived := aggregateResult(controls)
+	if got := mapString(doc, "result"); got != derived {
+		c.mismatch([]string{"result"}, got, derived,
+			fmt.Sprintf("log result is %s but its control evaluations aggregate to %s", got, derived))
+	}
+	sortDiagnostics(c.diags)
+	return c.diags, c.fixes
+}
+
+func (c *resultCheck) checkAssessment(path []string, log yaml.MapSlice) {
+	id := mapString(mapMap(log, "requirement"), "entry-id")
+	if executed, ok := intValue(log, "steps-executed"); ok {
+		if steps := len(mapList(log, "steps")); executed > steps {
+			c.report(ruleResultSteps, appendPath(path, "steps-executed"), strconv.Itoa(executed),
+				fmt.Sprintf("assessment of %s executed %d step(s) but lists only %d", id, executed, steps))
+		}
+	}
+	start, okStart := timeValue(log, "start")
+	end, okEnd := timeValue(log, "end")
+	if okStart && okEnd && end.Before(start) {
+		c.report(ruleResultTiming, appendPath(path, "end"), end.Format(time.RFC3339),
+			fmt.Sprintf("assessment of %s ends at %s, before it starts at %s", id, end.Format(time.RFC3339), start.Format(time.RFC3339)))
+	}
+}
+
+func (c *resultCheck) mismatch(path []string, got, derived, msg string) {
+	c.report(ruleResultAggregate, path, got, msg)
+	c.fixes = append(c.fixes, resultFix{Path: path, Value: derived})
+}
+
+func (c *resultCheck) report(rule string, path []string, value, msg string) {
+	c.diags = append(c.diags, diagnosticAt(c.file, c.src, rule, severityError, path, value, msg))
+}
+
+// applyResultFixes writes fixes to file. YAML files are edited node by
+// node so comments and formatting survive; JSON files are re-encoded from
+// doc.
+func applyResultFixes(file string, doc yaml.MapSlice, fixes []resultFix) error {
+	var data []byte
+	if documentFormat(file) == "json" {
+		for _, fix := range fixes {
+			doc = setPath(doc, fix.Path, fix.Value)
+		}
+		out, err := encodeDocument(doc, "json")
+		if err != nil {
+			return err
+		}
+		data = out
+	} else {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", file, err)
+		}
+		f, err := parser.ParseBytes(src, parser.ParseComments)
+		if err != nil {
+			return fmt.Errorf("parse %s: %w", file, err)
+		}
+		for _, fix := range fixes {
+			if err := replaceScalar(f, fix.Path, fix.Value); err != nil {
+				return fmt.Errorf("fix %s at %s: %w", file, formatPath(fix.Path), err)
+			}
+		}
+		data = []byte(f.String())
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			data = append(data, '\n')
+		}
+	}
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		return fmt.Errorf("write %s: %w", file, err)
+	}
+	return nil
+}
+
+// setPath sets the value at path, whose elements are mapping keys and
+// list indexes, and returns the updated document.
+func setPath(m yaml.MapSlice, path []string, value interface{}) yaml.MapSlice {
+	if len(path) == 1 {
+		return mapSet(m, path[0], value)
+	}
+	list := mapList(m, path[0])
+	i, err := strconv.Atoi(path[1])
+	if err != nil || i >= len(list) {
+		return m
+	}
+	if elem, ok := list[i].(yaml.MapSlice); ok && len(path) > 2 {
+		list[i] = setPath(elem, path[2:], value)
+	}
+	return m
+}
+
+// yamlPath converts a diagnostic path into a goccy YAML path.
+func yamlPath(path []string) string {
+	var b strings.Builder
+	b.WriteString("$")
+	for _, p := range path {
+		if _, err := strconv.Atoi(p); err == nil {
+			fmt.Fprintf(&b, "[%s]", p)
+		} else {
+			b.WriteString("." + p)
+		}
+	}
+	return b.String()
+}
+
+// replaceScalar replaces the scalar at path in f, keeping its comment.
+func replaceScalar(f *ast.File, path []string, value string) error {
+	p, err := yaml.PathString(yamlPath(path))
+	if err != nil {
+		return err
+	}
+	var comment *ast.CommentGroupNode
+	if node, err := p.FilterFile(f); err == nil {
+		comment = node.GetComment()
+	}
+	if err := p.ReplaceWithReader(f, strings.NewReader(value)); err != nil {
+		return err
+	}
+	if comment != nil {
+		if node, err := p.FilterFile(f); err == nil {
+			return node.SetComment(comment)
+		}
+	}
+	return nil
+}
+
+func intValue(m yaml.MapSlice, key string) (int, bool) {
+	v, _ := mapGet(m, key)
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int64:
+		return int(n), true
+	case uint64:
+		return int(n), true
+	case float64:
+		return int(n), true
+	}
+	return 0, false
+}
+
+func timeValue(m yaml.MapSlice, key string) (time.Time, bool) {
+	v, _ := mapGet(m, key)
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case string:
+		parsed, err := time.Parse(time.RFC3339, t)
+		return parsed, err == nil
+	}
+	return time.Time{}, false
+}
+
+// withoutRule returns diags without those of rule.
+func withoutRule(diags []Diagnostic, rule string) []Diagnostic {
+	var out []Diagnostic
+	for _, d := range diags {
+		if d.Rule != rule {
+			out = append(out, d)
+		}
+	}
+	return out
+}
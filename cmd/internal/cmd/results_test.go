@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cuelang.org/go/cue/cuecontext"
+)
+
+func TestAggregateResult(t *testing.T) {
+	tests := []struct {
+		results []string
+		want    string
+	}{
+		{nil, "Not Run"},
+		{[]string{"Passed", "Not Applicable"}, "Passed"},
+		{[]string{"Not Applicable", "Not Run"}, "Not Applicable"},
+		{[]string{"Passed", "Unknown"}, "Unknown"},
+		{[]string{"Unknown", "Needs Review", "Passed"}, "Needs Review"},
+		{[]string{"Needs Review", "Failed"}, "Failed"},
+	}
+	for _, tt := range tests {
+		if got := aggregateResult(tt.results); got != tt.want {
+			t.Errorf("aggregateResult(%q) = %q, want %q", tt.results, got, tt.want)
+		}
+	}
+}
+
+func TestCheckResults(t *testing.T) {
+	file := "testdata/inconsistent-evaluation-log.yaml"
+	doc, err := readDocument(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diags, fixes := checkResults(file, doc, nil)
+
+	want := map[string]string{
+		"result":                ruleResultAggregate,
+		"evaluations[0].result": ruleResultAggregate,
+		`evaluations[0]."assessment-logs"[0]."steps-executed"`: ruleResultSteps,
+		`evaluations[0]."assessment-logs"[1].end`:              ruleResultTiming,
+	}
+	for _, d := range diags {
+		if want[d.Path] != d.Rule {
+			t.Errorf("unexpected %s diagnostic at %s: %s", d.Rule, d.Path, d.Message)
+		}
+		delete(want, d.Path)
+	}
+	for path, rule := range want {
+		t.Errorf("missing %s diagnostic at %s", rule, path)
+	}
+
+	if len(fixes) != 2 || fixes[0].Value != "Failed" || fixes[1].Value != "Failed" {
+		t.Errorf("unexpected fixes: %+v", fixes)
+	}
+}
+
+func TestApplyResultFixes(t *testing.T) {
+	data, err := os.ReadFile("testdata/inconsistent-evaluation-log.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "log.yaml")
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := readDocument(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, fixes := checkResults(file, doc, nil)
+
+	if err := applyResultFixes(file, doc, fixes); err != nil {
+		t.Fatal(err)
+	}
+
+	fixed, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"# Results here disagree", "result: Failed # set by the dashboard exporter"} {
+		if !strings.Contains(string(fixed), s) {
+			t.Errorf("fixed file does not contain %q:\n%s", s, fixed)
+		}
+	}
+	doc, err = readDocument(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diags, fixes := checkResults(file, doc, nil)
+	if len(fixes) != 0 || len(withoutRule(withoutRule(diags, ruleResultSteps), ruleResultTiming)) != 0 {
+		t.Errorf("results still inconsistent after fix: %+v", diags)
+	}
+}
+
+func TestCheckResultFileWrongType(t *testing.T) {
+	ctx := cuecontext.New()
+	result, err := checkResultFile(ctx, "testdata/disposition-policy.yaml", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Valid || len(result.Diagnostics) != 1 {
+		t.Fatalf("result = %+v, want one problem", result)
+	}
+	if d := result.Diagnostics[0]; d.Path != "metadata.type" || d.Value != "Policy" || d.Line == 0 {
+		t.Errorf("diagnostic = %+v, want one at metadata.type", d)
+	}
+
+	// A later log is still fixed.
+	data, err := os.ReadFile("testdata/inconsistent-evaluation-log.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "log.yaml")
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := checkResultFile(ctx, file, true); err != nil {
+		t.Fatal(err)
+	}
+	if fixed, _ := os.ReadFile(file); string(fixed) == string(data) {
+		t.Error("log was not fixed")
+	}
+}
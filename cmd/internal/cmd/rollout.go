@@ -0,0 +1,407 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/spf13/cobra"
+)
+
+var rolloutCmd = &cobra.Command{
+	Use:   "rollout [policy] [logs-or-directories...]",
+	Short: "Report a Policy's rollout status per target against its implementation plan",
+	Long: `Compare the evaluation-timeline and enforcement-timeline of a Policy's
+implementation-plan with the EvaluationLogs and EnforcementLogs of its
+targets, as of --at (default: now), and report the rollout status of every
+target:
+
+  Not Started         the evaluation window has not opened;
+  Evaluation Missing  the evaluation window is open but the target has no
+                      evaluation since it opened;
+  Evaluating          evaluated; the enforcement window has not opened;
+  Awaiting Enforcement
+                      evaluated; the enforcement window is open but no
+                      action was taken;
+  Enforcing           evaluated, with actions in the enforcement window;
+  Ended               both windows have closed.
+
+Issues are flagged along the way:
+
+  early-enforcement   an action was taken before the enforcement window
+                      opened (error);
+  missing-evaluation  no evaluation since the evaluation window opened
+                      (error);
+  window-ended        a window has closed; the policy needs renewing or
+                      retiring (warning).
+
+EvaluationLogs count when they evaluate a control of the compiled policy;
+EnforcementLog actions count when their method is one of the policy's.
+Actions are dated by their start, logs by their date (see trend). Targets
+are taken from the logs; --target adds targets that have none. Warnings
+only fail the run with --strict.`,
+	Args:          cobra.MinimumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE:          runRollout,
+}
+
+var rolloutFlags struct {
+	format     string
+	outputPath string
+	at         string
+	targets    []string
+	mirrorDir  string
+	cacheDir   string
+	fetch      bool
+	strict     bool
+}
+
+const (
+	rolloutNotStarted          = "Not Started"
+	rolloutEvaluationMissing   = "Evaluation Missing"
+	rolloutEvaluating          = "Evaluating"
+	rolloutAwaitingEnforcement = "Awaiting Enforcement"
+	rolloutEnforcing           = "Enforcing"
+	rolloutEnded               = "Ended"
+
+	issueEarlyEnforcement  = "early-enforcement"
+	issueMissingEvaluation = "missing-evaluation"
+	issueWindowEnded       = "window-ended"
+)
+
+func newRolloutCmd() *cobra.Command {
+	rolloutCmd.Flags().StringVarP(&rolloutFlags.format, "format", "f", "text", "Output format: text or json")
+	rolloutCmd.Flags().StringVarP(&rolloutFlags.outputPath, "output", "o", "", "Write the report to a file instead of stdout")
+	rolloutCmd.Flags().StringVar(&rolloutFlags.at, "at", "", "Report as of this time, RFC 3339 or YYYY-MM-DD (default: now)")
+	rolloutCmd.Flags().StringSliceVar(&rolloutFlags.targets, "target", nil, "Also report these target ids, with or without logs")
+	rolloutCmd.Flags().StringVar(&rolloutFlags.mirrorDir, "mirror", "", "Read-only directory mirroring http(s) artifacts as host/path")
+	rolloutCmd.Flags().StringVar(&rolloutFlags.cacheDir, "cache", "", "Directory where downloaded http(s) artifacts are cached")
+	rolloutCmd.Flags().BoolVar(&rolloutFlags.fetch, "fetch", false, "Download http(s) artifacts missing from the mirror and cache")
+	rolloutCmd.Flags().BoolVar(&rolloutFlags.strict, "strict", false, "Fail on warnings as well as errors")
+	return rolloutCmd
+}
+
+func runRollout(cmd *cobra.Command, args []string) error {
+	policyFile := args[0]
+	if rolloutFlags.format != "text" && rolloutFlags.format != "json" {
+		return fmt.Errorf("unsupported --format %q (expected text or json)", rolloutFlags.format)
+	}
+	at := time.Now().UTC()
+	if rolloutFlags.at != "" {
+		t, err := parsePeriodBound(rolloutFlags.at, false)
+		if err != nil {
+			return fmt.Errorf("invalid --at: %w", err)
+		}
+		at = t
+	}
+
+	policy, err := readDocument(policyFile)
+	if err != nil {
+		return err
+	}
+	if typ := mapString(mapMap(policy, "metadata"), "type"); typ != "Policy" {
+		return fmt.Errorf("%s is a %s, expected a Policy", policyFile, typ)
+	}
+	var logs []datedLog
+	if len(args) > 1 {
+		if logs, err = collectLogs(args[1:], "EvaluationLog", "EnforcementLog"); err != nil {
+			return err
+		}
+	}
+
+	resolver := newArtifactResolver(rolloutFlags.mirrorDir, rolloutFlags.cacheDir, rolloutFlags.fetch)
+	effective, _, err := compilePolicyFile(policyFile, policy, resolver)
+	if err != nil {
+		return err
+	}
+
+	report, err := computeRollout(policy, effective, logs, rolloutFlags.targets, at)
+	if err != nil {
+		return fmt.Errorf("%s: %w", policyFile, err)
+	}
+	if err := writeReport(rolloutFlags.outputPath, func(w io.Writer) error {
+		if rolloutFlags.format == "json" {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(report)
+		}
+		return writeRolloutText(w, report)
+	}); err != nil {
+		return err
+	}
+
+	errs, warnings := report.count()
+	if errs > 0 || (rolloutFlags.strict && warnings > 0) {
+		return fmt.Errorf("rollout of %s has %d error(s) and %d warning(s)", report.Policy, errs, warnings)
+	}
+	return nil
+}
+
+// rolloutReport is the rollout status of a Policy across its targets.
+type rolloutReport struct {
+	Policy      string          `json:"policy"`
+	At          time.Time       `json:"at"`
+	Evaluation  rolloutWindow   `json:"evaluation-timeline"`
+	Enforcement rolloutWindow   `json:"enforcement-timeline"`
+	Issues      []rolloutIssue  `json:"issues,omitempty"`
+	Targets     []rolloutTarget `json:"targets"`
+}
+
+// rolloutWindow is one timeline of the implementation plan.
+type rolloutWindow struct {
+	Start time.Time  `json:"start"`
+	End   *time.Time `json:"end,omitempty"`
+	Notes string     `json:"notes,omitempty"`
+	State string     `json:"state"`
+}
+
+type rolloutTarget struct {
+	ID              string         `json:"id"`
+	Name            string         `json:"name,omitempty"`
+	Status          string         `json:"status"`
+	Evaluations     int            `json:"evaluations"`
+	LastEvaluation  *time.Time     `json:"last-evaluation,omitempty"`
+	Actions         int            `json:"actions"`
+	LastAction      *time.Time     `json:"last-action,omitempty"`
+	Issues          []rolloutIssue `json:"issues,omitempty"`
+	evaluatedInTime bool
+}
+
+type rolloutIssue struct {
+	Kind     string `json:"kind"`
+	Severity string `json:"severity"`
+	Log      string `json:"log,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Message  string `json:"message"`
+}
+
+const (
+	windowPending = "Pending"
+	windowOpen    = "Open"
+	windowClosed  = "Closed"
+)
+
+// readWindow reads a timeline of the implementation plan and places at
+// in it.
+func readWindow(plan yaml.MapSlice, key string, at time.Time) (rolloutWindow, error) {
+	m := mapMap(plan, key)
+	start, ok := timeValue(m, "start")
+	if !ok {
+		return rolloutWindow{}, fmt.Errorf("implementation-plan.%s has no start", key)
+	}
+	w := rolloutWindow{Start: start, Notes: mapString(m, "notes"), State: windowOpen}
+	if end, ok := timeValue(m, "end"); ok {
+		w.End = &end
+	}
+	switch {
+	case at.Before(w.Start):
+		w.State = windowPending
+	case w.End != nil && !at.Before(*w.End):
+		w.State = windowClosed
+	}
+	return w, nil
+}
+
+// computeRollout places the logs of every target in the windows of the
+// policy's implementation plan.
+func computeRollout(policy yaml.MapSlice, effective *effectivePolicy, logs []datedLog, extra []string, at time.Time) (*rolloutReport, error) {
+	plan := mapMap(policy, "implementation-plan")
+	if plan == nil {
+		return nil, fmt.Errorf("policy has no implementation-plan")
+	}
+	report := &rolloutReport{Policy: effective.Policy, At: at}
+	var err error
+	if report.Evaluation, err = readWindow(plan, "evaluation-timeline", at); err != nil {
+		return nil, err
+	}
+	if report.Enforcement, err = readWindow(plan, "enforcement-timeline", at); err != nil {
+		return nil, err
+	}
+	for _, w := range []struct {
+		name   string
+		window rolloutWindow
+	}{{"evaluation", report.Evaluation}, {"enforcement", report.Enforcement}} {
+		if w.window.State == windowClosed {
+			report.Issues = append(report.Issues, rolloutIssue{
+				Kind:     issueWindowEnded,
+				Severity: severityWarning,
+				Path:     "implementation-plan." + w.name + "-timeline.end",
+				Message:  fmt.Sprintf("the %s window ended on %s; renew or retire the policy", w.name, w.window.End.UTC().Format("2006-01-02")),
+			})
+		}
+	}
+
+	targets := make(map[string]*rolloutTarget)
+	target := func(m yaml.MapSlice) *rolloutTarget {
+		id := mapString(m, "id")
+		t := targets[id]
+		if t == nil {
+			t = &rolloutTarget{ID: id}
+			targets[id] = t
+		}
+		if t.Name == "" {
+			t.Name = mapString(m, "name")
+		}
+		return t
+	}
+	for _, id := range extra {
+		target(yaml.MapSlice{{Key: "id", Value: id}})
+	}
+
+	for _, l := range logs {
+		switch mapString(mapMap(l.Doc, "metadata"), "type") {
+		case "EvaluationLog":
+			if !evaluatesPolicy(l.Doc, effective) {
+				continue
+			}
+			t := target(mapMap(l.Doc, "target"))
+			t.Evaluations++
+			if t.LastEvaluation == nil || l.Date.After(*t.LastEvaluation) {
+				d := l.Date
+				t.LastEvaluation = &d
+			}
+			if !l.Date.Before(report.Evaluation.Start) && !l.Date.After(at) {
+				t.evaluatedInTime = true
+			}
+		case "EnforcementLog":
+			var t *rolloutTarget
+			for i, action := range listMaps(mapList(l.Doc, "actions")) {
+				if mapString(mapMap(action, "method"), "reference-id") != effective.Policy {
+					continue
+				}
+				if t == nil {
+					t = target(mapMap(l.Doc, "target"))
+				}
+				when, ok := timeValue(action, "start")
+				if !ok {
+					when = l.Date
+				}
+				t.Actions++
+				if t.LastAction == nil || when.After(*t.LastAction) {
+					w := when
+					t.LastAction = &w
+				}
+				if when.Before(report.Enforcement.Start) {
+					t.Issues = append(t.Issues, rolloutIssue{
+						Kind:     issueEarlyEnforcement,
+						Severity: severityError,
+						Log:      l.id(),
+						Path:     formatPath([]string{"actions", strconv.Itoa(i)}),
+						Message: fmt.Sprintf("%s action on %s precedes the enforcement window, which opens on %s",
+							mapString(action, "disposition"), when.UTC().Format("2006-01-02"), report.Enforcement.Start.UTC().Format("2006-01-02")),
+					})
+				}
+			}
+		}
+	}
+
+	for _, t := range targets {
+		switch {
+		case report.Evaluation.State == windowPending:
+			t.Status = rolloutNotStarted
+		case report.Evaluation.State == windowClosed && report.Enforcement.State == windowClosed:
+			t.Status = rolloutEnded
+		case !t.evaluatedInTime:
+			t.Status = rolloutEvaluationMissing
+			t.Issues = append(t.Issues, rolloutIssue{
+				Kind:     issueMissingEvaluation,
+				Severity: severityError,
+				Message:  fmt.Sprintf("no evaluation since the evaluation window opened on %s", report.Evaluation.Start.UTC().Format("2006-01-02")),
+			})
+		case report.Enforcement.State == windowPending:
+			t.Status = rolloutEvaluating
+		case t.Actions == 0:
+			t.Status = rolloutAwaitingEnforcement
+		default:
+			t.Status = rolloutEnforcing
+		}
+		report.Targets = append(report.Targets, *t)
+	}
+	sort.Slice(report.Targets, func(i, j int) bool { return report.Targets[i].ID < report.Targets[j].ID })
+	return report, nil
+}
+
+// evaluatesPolicy reports whether an EvaluationLog evaluates a control of
+// the compiled policy.
+func evaluatesPolicy(log yaml.MapSlice, effective *effectivePolicy) bool {
+	for _, eval := range listMaps(mapList(log, "evaluations")) {
+		control := mapMap(eval, "control")
+		if _, ctl := findEffectiveControl(effective.Catalogs, mapString(control, "reference-id"), mapString(control, "entry-id")); ctl != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// count returns the number of error and warning issues.
+func (r *rolloutReport) count() (errs, warnings int) {
+	issues := r.Issues
+	for _, t := range r.Targets {
+		issues = append(issues, t.Issues...)
+	}
+	for _, i := range issues {
+		if i.Severity == severityError {
+			errs++
+		} else {
+			warnings++
+		}
+	}
+	return errs, warnings
+}
+
+func writeRolloutText(w io.Writer, r *rolloutReport) error {
+	fmt.Fprintf(w, "Rollout of %s as of %s\n\n", r.Policy, r.At.UTC().Format("2006-01-02"))
+	for _, win := range []struct {
+		name   string
+		window rolloutWindow
+	}{{"evaluation", r.Evaluation}, {"enforcement", r.Enforcement}} {
+		end := "open-ended"
+		if win.window.End != nil {
+			end = win.window.End.UTC().Format("2006-01-02")
+		}
+		fmt.Fprintf(w, "  %-12s %s to %s (%s)\n", win.name, win.window.Start.UTC().Format("2006-01-02"), end, win.window.State)
+	}
+	for _, i := range r.Issues {
+		fmt.Fprintf(w, "  %s: %s [%s]\n", i.Severity, i.Message, i.Kind)
+	}
+
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TARGET\tSTATUS\tEVALUATIONS\tLAST EVALUATION\tACTIONS\tLAST ACTION")
+	for _, t := range r.Targets {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%d\t%s\n", t.ID, t.Status, t.Evaluations, formatDay(t.LastEvaluation), t.Actions, formatDay(t.LastAction))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, t := range r.Targets {
+		if len(t.Issues) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n%s:\n", t.ID)
+		for _, i := range t.Issues {
+			where := ""
+			if i.Log != "" {
+				where = i.Log + " " + i.Path + ": "
+			}
+			fmt.Fprintf(w, "  %s: %s%s [%s]\n", i.Severity, where, i.Message, i.Kind)
+		}
+	}
+	return nil
+}
+
+func formatDay(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.UTC().Format("2006-01-02")
+}
@@ -0,0 +1,101 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func rolloutFor(t *testing.T, at time.Time, extra []string, logFiles ...string) *rolloutReport {
+	t.Helper()
+	file := "testdata/disposition-policy.yaml"
+	policy, err := readDocument(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	effective, diags := compilePolicy(file, policy, nil, newArtifactResolver("", "", false))
+	if hasErrors(diags) {
+		t.Fatalf("policy does not compile: %+v", diags)
+	}
+	logs, err := collectLogs(logFiles, "EvaluationLog", "EnforcementLog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := computeRollout(policy, effective, logs, extra, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func TestComputeRollout(t *testing.T) {
+	at := time.Date(2026, 4, 15, 0, 0, 0, 0, time.UTC)
+	report := rolloutFor(t, at, []string{"new-repo"},
+		"testdata/disposition-evaluation-log.yaml",
+		"testdata/audit-evaluation-log.yaml",
+		"testdata/linked-enforcement-log.yaml")
+
+	if report.Evaluation.State != windowClosed || report.Enforcement.State != windowOpen {
+		t.Errorf("windows = %s, %s; want Closed, Open", report.Evaluation.State, report.Enforcement.State)
+	}
+	if len(report.Issues) != 1 || report.Issues[0].Kind != issueWindowEnded {
+		t.Errorf("policy issues = %+v, want one window-ended", report.Issues)
+	}
+	if len(report.Targets) != 2 {
+		t.Fatalf("got %d targets, want 2: %+v", len(report.Targets), report.Targets)
+	}
+
+	repo := report.Targets[0]
+	if repo.ID != "example-repo" || repo.Status != rolloutEnforcing || repo.Evaluations != 2 || repo.Actions != 4 {
+		t.Errorf("example-repo = %+v", repo)
+	}
+	// Every action of the log was taken on 2026-01-06, before enforcement
+	// opened on 2026-01-10.
+	if len(repo.Issues) != 4 {
+		t.Errorf("got %d example-repo issues, want 4: %+v", len(repo.Issues), repo.Issues)
+	}
+	for _, i := range repo.Issues {
+		if i.Kind != issueEarlyEnforcement || i.Severity != severityError || i.Log != "LINKED-ENFORCEMENT" {
+			t.Errorf("issue = %+v", i)
+		}
+	}
+
+	fresh := report.Targets[1]
+	if fresh.ID != "new-repo" || fresh.Status != rolloutEvaluationMissing {
+		t.Errorf("new-repo = %+v", fresh)
+	}
+	if len(fresh.Issues) != 1 || fresh.Issues[0].Kind != issueMissingEvaluation {
+		t.Errorf("new-repo issues = %+v", fresh.Issues)
+	}
+
+	if errs, warnings := report.count(); errs != 5 || warnings != 1 {
+		t.Errorf("count = %d, %d; want 5, 1", errs, warnings)
+	}
+	var buf bytes.Buffer
+	if err := writeRolloutText(&buf, report); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "new-repo      Evaluation Missing") {
+		t.Errorf("text report:\n%s", buf.String())
+	}
+}
+
+func TestComputeRolloutStatuses(t *testing.T) {
+	logs := []string{"testdata/disposition-evaluation-log.yaml"}
+	for _, tc := range []struct {
+		at   time.Time
+		want string
+	}{
+		{time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC), rolloutNotStarted},
+		{time.Date(2026, 1, 8, 0, 0, 0, 0, time.UTC), rolloutEvaluating},
+		{time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), rolloutAwaitingEnforcement},
+	} {
+		report := rolloutFor(t, tc.at, nil, logs...)
+		if len(report.Targets) != 1 || report.Targets[0].Status != tc.want {
+			t.Errorf("at %s: targets = %+v, want %s", tc.at.Format("2006-01-02"), report.Targets, tc.want)
+		}
+	}
+}
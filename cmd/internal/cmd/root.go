@@ -27,4 +27,23 @@ func init() {
 	rootCmd.AddCommand(newOpenAPI2MDCmd())
 	rootCmd.AddCommand(newLexicon2MDCmd())
 	rootCmd.AddCommand(newTermLinkerCmd())
+	rootCmd.AddCommand(newValidateCmd())
+	rootCmd.AddCommand(newMigrateCmd())
+	rootCmd.AddCommand(newNormalizeCmd())
+	rootCmd.AddCommand(newFmtCmd())
+	rootCmd.AddCommand(newLintCmd())
+	rootCmd.AddCommand(newFlattenCmd())
+	rootCmd.AddCommand(newPolicyCmd())
+	rootCmd.AddCommand(newFilterCmd())
+	rootCmd.AddCommand(newCoverageCmd())
+	rootCmd.AddCommand(newResultsCmd())
+	rootCmd.AddCommand(newMergeCmd())
+	rootCmd.AddCommand(newTrendCmd())
+	rootCmd.AddCommand(newDispositionCmd())
+	rootCmd.AddCommand(newVerifyCmd())
+	rootCmd.AddCommand(newAuditCmd())
+	rootCmd.AddCommand(newFreshnessCmd())
+	rootCmd.AddCommand(newScheduleCmd())
+	rootCmd.AddCommand(newEvaluateCmd())
+	rootCmd.AddCommand(newRolloutCmd())
 }
@@ -0,0 +1,376 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/spf13/cobra"
+)
+
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule [policy] [logs-or-directories...]",
+	Short: "List the assessments a Policy makes due next, per target and executor",
+	Long: `Derive an evaluation schedule from the assessment plans of a Policy. Each
+plan is due one frequency (see freshness) after its requirement was last
+evaluated or evidenced in the given logs, and immediately if it never was.
+Assessments due before --at are Overdue; those due within --horizon after
+it are Upcoming. Later ones are left out.
+
+Targets are taken from the logs, or named with --target. Every evaluation
+method of a plan is scheduled separately and grouped by its executor and
+mode, so manual reviewers can subscribe to their own obligations. Methods
+without an executor are listed as Unassigned. Event-driven plans ("every
+push") are not scheduled.
+
+  text  a table per target, executor, and mode
+  json  the schedule as data
+  ics   an iCalendar file with an all-day event per assessment; overdue
+        assessments are placed on --at`,
+	Args:          cobra.MinimumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE:          runSchedule,
+}
+
+var scheduleFlags struct {
+	format     string
+	outputPath string
+	at         string
+	horizon    string
+	targets    []string
+	mirrorDir  string
+	cacheDir   string
+	fetch      bool
+}
+
+const (
+	scheduleOverdue  = "Overdue"
+	scheduleUpcoming = "Upcoming"
+)
+
+func newScheduleCmd() *cobra.Command {
+	scheduleCmd.Flags().StringVarP(&scheduleFlags.format, "format", "f", "text", "Output format: text, json, or ics (default: from the output extension, else text)")
+	scheduleCmd.Flags().StringVarP(&scheduleFlags.outputPath, "output", "o", "", "Write the schedule to a file instead of stdout")
+	scheduleCmd.Flags().StringVar(&scheduleFlags.at, "at", "", "Schedule as of this time, RFC 3339 or YYYY-MM-DD (default: now)")
+	scheduleCmd.Flags().StringVar(&scheduleFlags.horizon, "horizon", "P30D", "How far ahead to list upcoming assessments, as a frequency")
+	scheduleCmd.Flags().StringSliceVar(&scheduleFlags.targets, "target", nil, "Schedule only these target ids; targets without logs are due immediately")
+	scheduleCmd.Flags().StringVar(&scheduleFlags.mirrorDir, "mirror", "", "Read-only directory mirroring http(s) artifacts as host/path")
+	scheduleCmd.Flags().StringVar(&scheduleFlags.cacheDir, "cache", "", "Directory where downloaded http(s) artifacts are cached")
+	scheduleCmd.Flags().BoolVar(&scheduleFlags.fetch, "fetch", false, "Download http(s) artifacts missing from the mirror and cache")
+	return scheduleCmd
+}
+
+func runSchedule(cmd *cobra.Command, args []string) error {
+	policyFile := args[0]
+	format := scheduleFlags.format
+	if !cmd.Flags().Changed("format") {
+		switch strings.ToLower(strings.TrimPrefix(filepath.Ext(scheduleFlags.outputPath), ".")) {
+		case "ics", "ical":
+			format = "ics"
+		case "json":
+			format = "json"
+		}
+	}
+	if format != "text" && format != "json" && format != "ics" {
+		return fmt.Errorf("unsupported --format %q (expected text, json, or ics)", format)
+	}
+	at := time.Now().UTC()
+	if scheduleFlags.at != "" {
+		t, err := parsePeriodBound(scheduleFlags.at, false)
+		if err != nil {
+			return fmt.Errorf("invalid --at: %w", err)
+		}
+		at = t
+	}
+	horizon, err := parseFrequency(scheduleFlags.horizon)
+	if err != nil {
+		return fmt.Errorf("invalid --horizon: %w", err)
+	}
+
+	policy, err := readDocument(policyFile)
+	if err != nil {
+		return err
+	}
+	if typ := mapString(mapMap(policy, "metadata"), "type"); typ != "Policy" {
+		return fmt.Errorf("%s is a %s, expected a Policy", policyFile, typ)
+	}
+	var logs []datedLog
+	if len(args) > 1 {
+		logs, err = collectLogs(args[1:], "EvaluationLog", "AuditLog")
+		if err != nil {
+			return err
+		}
+	}
+	if len(logs) == 0 && len(scheduleFlags.targets) == 0 {
+		return fmt.Errorf("no logs to take targets from (name them with --target)")
+	}
+
+	resolver := newArtifactResolver(scheduleFlags.mirrorDir, scheduleFlags.cacheDir, scheduleFlags.fetch)
+	effective, _, err := compilePolicyFile(policyFile, policy, resolver)
+	if err != nil {
+		return err
+	}
+
+	report := computeSchedule(policy, effective, logs, scheduleFlags.targets, at, horizon.due(at))
+	for _, note := range report.notes {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", policyFile, note)
+	}
+	return writeReport(scheduleFlags.outputPath, func(w io.Writer) error {
+		switch format {
+		case "json":
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(report)
+		case "ics":
+			return writeScheduleICS(w, report)
+		default:
+			return writeScheduleText(w, report)
+		}
+	})
+}
+
+// scheduleReport lists the assessments due per target, executor, and mode.
+type scheduleReport struct {
+	Policy  string           `json:"policy"`
+	At      time.Time        `json:"at"`
+	Until   time.Time        `json:"until"`
+	Targets []scheduleTarget `json:"targets"`
+	notes   []string
+}
+
+type scheduleTarget struct {
+	ID     string          `json:"id"`
+	Name   string          `json:"name,omitempty"`
+	Groups []scheduleGroup `json:"groups"`
+}
+
+// scheduleGroup is the work of one executor in one mode.
+type scheduleGroup struct {
+	Executor string         `json:"executor"`
+	Email    string         `json:"email,omitempty"`
+	Mode     string         `json:"mode"`
+	Items    []scheduleItem `json:"assessments"`
+}
+
+type scheduleItem struct {
+	Plan          string     `json:"plan"`
+	Requirement   string     `json:"requirement"`
+	Control       string     `json:"control,omitempty"`
+	Method        string     `json:"method"`
+	Frequency     string     `json:"frequency"`
+	Status        string     `json:"status"`
+	Due           time.Time  `json:"due"`
+	LastEvaluated *time.Time `json:"last-evaluated,omitempty"`
+	LastLog       string     `json:"last-log,omitempty"`
+}
+
+// computeSchedule schedules the assessment plans of policy for every
+// target of logs, or for targets when given.
+func computeSchedule(policy yaml.MapSlice, effective *effectivePolicy, logs []datedLog, targets []string, at, until time.Time) *scheduleReport {
+	report := &scheduleReport{Policy: effective.Policy, At: at, Until: until}
+
+	byTarget := make(map[string][]datedLog)
+	names := make(map[string]string)
+	var ids []string
+	for _, l := range logs {
+		t := mapMap(l.Doc, "target")
+		id := mapString(t, "id")
+		if _, ok := byTarget[id]; !ok {
+			ids = append(ids, id)
+			names[id] = mapString(t, "name")
+		}
+		byTarget[id] = append(byTarget[id], l)
+	}
+	if len(targets) > 0 {
+		ids = append([]string(nil), targets...)
+	}
+	sort.Strings(ids)
+
+	type plan struct {
+		id, requirement, control, text string
+		freq                           frequency
+		methods                        []yaml.MapSlice
+	}
+	var plans []plan
+	for _, p := range listMaps(mapList(mapMap(policy, "adherence"), "assessment-plans")) {
+		id, text := mapString(p, "id"), mapString(p, "frequency")
+		freq, err := parseFrequency(text)
+		if errors.Is(err, errEventDriven) {
+			continue
+		}
+		if err != nil {
+			report.notes = append(report.notes, fmt.Sprintf("plan %s is not scheduled: %v", id, err))
+			continue
+		}
+		req := mapString(p, "requirement-id")
+		plans = append(plans, plan{id, req, requirementControl(effective, req), text, freq, listMaps(mapList(p, "evaluation-methods"))})
+	}
+
+	for _, id := range ids {
+		target := scheduleTarget{ID: id, Name: names[id]}
+		groups := make(map[[2]string]*scheduleGroup)
+		for _, p := range plans {
+			item := scheduleItem{Plan: p.id, Requirement: p.requirement, Control: p.control, Frequency: p.text, Status: scheduleOverdue, Due: at}
+			if last, ok := latestEvidence(byTarget[id], p.id, p.requirement, p.control); ok {
+				t := last.Time
+				item.LastEvaluated, item.LastLog, item.Due = &t, last.Log, p.freq.due(last.Time)
+				if !item.Due.Before(at) {
+					item.Status = scheduleUpcoming
+				}
+			}
+			if item.Due.After(until) {
+				continue
+			}
+			for _, m := range p.methods {
+				executor := mapMap(m, "executor")
+				name := mapString(executor, "name")
+				if name == "" {
+					name = "Unassigned"
+				}
+				key := [2]string{name, mapString(m, "mode")}
+				g := groups[key]
+				if g == nil {
+					g = &scheduleGroup{Executor: name, Email: mapString(mapMap(executor, "contact"), "email"), Mode: key[1]}
+					groups[key] = g
+				}
+				it := item
+				it.Method = mapString(m, "id")
+				g.Items = append(g.Items, it)
+			}
+		}
+		for _, g := range groups {
+			sort.SliceStable(g.Items, func(i, j int) bool { return g.Items[i].Due.Before(g.Items[j].Due) })
+			target.Groups = append(target.Groups, *g)
+		}
+		sort.Slice(target.Groups, func(i, j int) bool {
+			a, b := target.Groups[i], target.Groups[j]
+			if (a.Executor == "Unassigned") != (b.Executor == "Unassigned") {
+				return b.Executor == "Unassigned"
+			}
+			if a.Executor != b.Executor {
+				return a.Executor < b.Executor
+			}
+			return a.Mode < b.Mode
+		})
+		report.Targets = append(report.Targets, target)
+	}
+	return report
+}
+
+func writeScheduleText(w io.Writer, report *scheduleReport) error {
+	fmt.Fprintf(w, "Assessments of %s due by %s (as of %s)\n", report.Policy,
+		report.Until.UTC().Format("2006-01-02"), report.At.UTC().Format("2006-01-02"))
+	for _, t := range report.Targets {
+		label := t.ID
+		if t.Name != "" {
+			label += " (" + t.Name + ")"
+		}
+		fmt.Fprintf(w, "\n%s\n", label)
+		if len(t.Groups) == 0 {
+			fmt.Fprintln(w, "  nothing due")
+			continue
+		}
+		for _, g := range t.Groups {
+			fmt.Fprintf(w, "\n  %s, %s\n", g.Executor, g.Mode)
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "    DUE\tSTATUS\tREQUIREMENT\tPLAN\tMETHOD\tFREQUENCY\tLAST EVALUATED")
+			for _, it := range g.Items {
+				last := "never"
+				if it.LastEvaluated != nil {
+					last = it.LastEvaluated.UTC().Format("2006-01-02") + " (" + it.LastLog + ")"
+				}
+				fmt.Fprintf(tw, "    %s\t%s\t%s\t%s\t%s\t%s\t%s\n", it.Due.UTC().Format("2006-01-02"),
+					it.Status, it.Requirement, it.Plan, it.Method, it.Frequency, last)
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeScheduleICS writes the schedule as an iCalendar (RFC 5545) file.
+func writeScheduleICS(w io.Writer, report *scheduleReport) error {
+	var b strings.Builder
+	line := func(s string) {
+		// Fold lines longer than 75 octets, without splitting a rune.
+		for len(s) > 75 {
+			cut := 75
+			for cut > 0 && s[cut]&0xC0 == 0x80 {
+				cut--
+			}
+			b.WriteString(s[:cut] + "\r\n")
+			s = " " + s[cut:]
+		}
+		b.WriteString(s + "\r\n")
+	}
+	stamp := report.At.UTC().Format("20060102T150405Z")
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//gemara-docs//schedule//EN")
+	line("CALSCALE:GREGORIAN")
+	line("X-WR-CALNAME:" + icsText(report.Policy+" assessments"))
+	for _, t := range report.Targets {
+		for _, g := range t.Groups {
+			for _, it := range g.Items {
+				day := it.Due
+				if day.Before(report.At) {
+					day = report.At
+				}
+				summary := fmt.Sprintf("Assess %s for %s", it.Requirement, t.ID)
+				if it.Status == scheduleOverdue {
+					summary = "Overdue: " + summary
+				}
+				desc := fmt.Sprintf("Plan %s of %s (%s), %s method %s.", it.Plan, report.Policy, it.Frequency, g.Mode, it.Method)
+				if it.LastEvaluated != nil {
+					desc += fmt.Sprintf(" Last evaluated %s in %s; due %s.", it.LastEvaluated.UTC().Format("2006-01-02"), it.LastLog, it.Due.UTC().Format("2006-01-02"))
+				} else {
+					desc += " Never evaluated."
+				}
+
+				line("BEGIN:VEVENT")
+				line("UID:" + icsText(strings.Join([]string{report.Policy, t.ID, it.Plan, it.Method}, "-")+"@gemara"))
+				line("DTSTAMP:" + stamp)
+				line("DTSTART;VALUE=DATE:" + day.UTC().Format("20060102"))
+				line("DTEND;VALUE=DATE:" + day.UTC().AddDate(0, 0, 1).Format("20060102"))
+				line("SUMMARY:" + icsText(summary))
+				line("DESCRIPTION:" + icsText(desc))
+				line("CATEGORIES:" + icsText(g.Mode))
+				if g.Email != "" {
+					line("ATTENDEE;CN=" + icsParam(g.Executor) + ":mailto:" + g.Email)
+				}
+				line("END:VEVENT")
+			}
+		}
+	}
+	line("END:VCALENDAR")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// icsText escapes an iCalendar TEXT value.
+func icsText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
+
+// icsParam quotes an iCalendar parameter value when it needs to be.
+func icsParam(s string) string {
+	s = strings.ReplaceAll(s, `"`, "'")
+	if strings.ContainsAny(s, ",;:") {
+		return `"` + s + `"`
+	}
+	return s
+}
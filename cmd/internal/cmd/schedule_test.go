@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testSchedule(t *testing.T, targets []string, at, until time.Time) *scheduleReport {
+	t.Helper()
+	file := "testdata/schedule-policy.yaml"
+	policy, err := readDocument(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	effective, diags := compilePolicy(file, policy, nil, newArtifactResolver("", "", false))
+	if hasErrors(diags) {
+		t.Fatalf("policy does not compile: %+v", diags)
+	}
+	logs, err := collectLogs([]string{
+		"testdata/disposition-evaluation-log.yaml",
+		"testdata/audit-evaluation-log.yaml",
+		"testdata/freshness-audit-log.yaml",
+	}, "EvaluationLog", "AuditLog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return computeSchedule(policy, effective, logs, targets, at, until)
+}
+
+func TestComputeSchedule(t *testing.T) {
+	at := time.Date(2026, 2, 20, 0, 0, 0, 0, time.UTC)
+	report := testSchedule(t, nil, at, time.Date(2026, 4, 30, 0, 0, 0, 0, time.UTC))
+
+	if len(report.notes) != 1 || !strings.Contains(report.notes[0], "factor-review") {
+		t.Errorf("unexpected notes: %v", report.notes)
+	}
+	if len(report.Targets) != 1 || report.Targets[0].ID != "example-repo" {
+		t.Fatalf("unexpected targets: %+v", report.Targets)
+	}
+
+	var got []string
+	for _, g := range report.Targets[0].Groups {
+		for _, it := range g.Items {
+			got = append(got, strings.Join([]string{g.Executor, g.Mode, it.Requirement, it.Method, it.Status, it.Due.Format("2006-01-02")}, " "))
+		}
+	}
+	want := []string{
+		"Alice Reviewer Manual LV-03.AR01 release-review Upcoming 2026-03-12",
+		"Alice Reviewer Manual LV-01.AR01 access-review Upcoming 2026-04-05",
+		"Unassigned Automated LV-02.AR01 scanner Overdue 2026-01-19",
+		"Unassigned Automated LV-01.AR01 scanner Upcoming 2026-04-05",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("schedule:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if email := report.Targets[0].Groups[0].Email; email != "alice@example.com" {
+		t.Errorf("executor email %q", email)
+	}
+}
+
+func TestScheduleUnevaluatedTarget(t *testing.T) {
+	at := time.Date(2026, 2, 20, 0, 0, 0, 0, time.UTC)
+	report := testSchedule(t, []string{"new-repo"}, at, at.AddDate(0, 0, 30))
+
+	if len(report.Targets) != 1 || report.Targets[0].ID != "new-repo" {
+		t.Fatalf("unexpected targets: %+v", report.Targets)
+	}
+	items := 0
+	for _, g := range report.Targets[0].Groups {
+		for _, it := range g.Items {
+			items++
+			if it.Status != scheduleOverdue || !it.Due.Equal(at) || it.LastEvaluated != nil {
+				t.Errorf("%s of a target without logs: %+v", it.Plan, it)
+			}
+		}
+	}
+	// Every method of the four interval plans; factor-review cannot be read
+	// and signature-gate is event-driven.
+	if items != 5 {
+		t.Errorf("scheduled %d assessments, want 5", items)
+	}
+}
+
+func TestWriteScheduleICS(t *testing.T) {
+	at := time.Date(2026, 2, 20, 0, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	if err := writeScheduleICS(&buf, testSchedule(t, nil, at, at.AddDate(0, 0, 30))); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	lines := strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n")
+	if lines[0] != "BEGIN:VCALENDAR" || lines[len(lines)-1] != "END:VCALENDAR" {
+		t.Errorf("not a calendar:\n%s", out)
+	}
+	for _, l := range lines {
+		if len(l) > 75 || strings.Contains(l, "\n") {
+			t.Errorf("line not folded: %q", l)
+		}
+	}
+	if n := strings.Count(out, "BEGIN:VEVENT"); n != 2 {
+		t.Errorf("%d events, want 2", n)
+	}
+	for _, want := range []string{
+		"SUMMARY:Overdue: Assess LV-02.AR01 for example-repo",
+		"DTSTART;VALUE=DATE:20260220",
+		"DTSTART;VALUE=DATE:20260312",
+		"ATTENDEE;CN=Alice Reviewer:mailto:alice@example.com",
+		`(every 30 days)\, Man`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("calendar lacks %q:\n%s", want, out)
+		}
+	}
+}
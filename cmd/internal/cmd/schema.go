@@ -0,0 +1,125 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/build"
+	"cuelang.org/go/cue/load"
+	cuejson "cuelang.org/go/encoding/json"
+	cueyaml "cuelang.org/go/encoding/yaml"
+)
+
+// loadSchema builds the Gemara CUE package found in schemaDir.
+func loadSchema(ctx *cue.Context, schemaDir string) (cue.Value, error) {
+	inst, _, err := loadSchemaInstance(schemaDir)
+	if err != nil {
+		return cue.Value{}, err
+	}
+	schema := ctx.BuildInstance(inst)
+	if err := schema.Err(); err != nil {
+		return cue.Value{}, fmt.Errorf("failed to build CUE schema: %w", err)
+	}
+	return schema, nil
+}
+
+// loadSchemaInstance loads, without building, the CUE package in schemaDir.
+// It also returns schemaDir made absolute.
+func loadSchemaInstance(schemaDir string) (*build.Instance, string, error) {
+	if !filepath.IsAbs(schemaDir) {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get working directory: %w", err)
+		}
+		schemaDir = filepath.Join(wd, schemaDir)
+	}
+
+	insts := load.Instances([]string{"."}, &load.Config{Dir: schemaDir})
+	if len(insts) == 0 || insts[0].Err != nil {
+		err := error(nil)
+		if len(insts) > 0 {
+			err = insts[0].Err
+		}
+		return nil, "", fmt.Errorf("failed to load CUE package: %v", err)
+	}
+	return insts[0], schemaDir, nil
+}
+
+// artifactSource is a parsed YAML or JSON artifact together with the
+// source positions of its fields.
+type artifactSource struct {
+	File      string
+	Value     cue.Value
+	Positions *positionIndex
+}
+
+// loadArtifactSource reads a YAML or JSON artifact into a CUE value whose
+// positions refer back to path.
+func loadArtifactSource(ctx *cue.Context, path string) (*artifactSource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return parseArtifactSource(ctx, path, data)
+}
+
+// parseArtifactSource is loadArtifactSource for data already in memory; the
+// extension of path selects the decoder.
+func parseArtifactSource(ctx *cue.Context, path string, data []byte) (*artifactSource, error) {
+	var node ast.Node
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		file, err := cueyaml.Extract(path, data)
+		if err != nil {
+			return nil, err
+		}
+		node = file
+	case ".json":
+		expr, err := cuejson.Extract(path, data)
+		if err != nil {
+			return nil, err
+		}
+		node = expr
+	default:
+		return nil, fmt.Errorf("unsupported file extension: %s", path)
+	}
+
+	var value cue.Value
+	switch n := node.(type) {
+	case *ast.File:
+		value = ctx.BuildFile(n)
+	case ast.Expr:
+		value = ctx.BuildExpr(n)
+	}
+	if err := value.Err(); err != nil {
+		return nil, err
+	}
+	return &artifactSource{File: path, Value: value, Positions: indexPositions(node)}, nil
+}
+
+// lookupDefinition resolves the schema definition an artifact is validated
+// against. An explicit name wins; otherwise metadata.type selects it.
+func lookupDefinition(schema, data cue.Value, name string) (cue.Value, string, error) {
+	if name == "" {
+		typ, err := data.LookupPath(cue.ParsePath("metadata.type")).String()
+		if err != nil {
+			return cue.Value{}, "", fmt.Errorf("cannot infer definition: metadata.type is not set (use --definition)")
+		}
+		name = "#" + typ
+	}
+	if !strings.HasPrefix(name, "#") {
+		name = "#" + name
+	}
+
+	def := schema.LookupPath(cue.ParsePath(name))
+	if !def.Exists() {
+		return cue.Value{}, name, fmt.Errorf("definition %s not found in schema", name)
+	}
+	return def, name, nil
+}
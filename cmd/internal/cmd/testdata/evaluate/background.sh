@@ -0,0 +1,3 @@
+# Exits while a background child still holds stdout.
+sleep 5 &
+echo "released the lock"
@@ -0,0 +1,6 @@
+if [ "$GEMARA_PARAM_BRANCH" = main ]; then
+  echo '{"result": "Needs Review", "message": "main has protection rules that need review."}'
+else
+  echo "unexpected branch $GEMARA_PARAM_BRANCH" >&2
+  exit 4
+fi
@@ -0,0 +1,2 @@
+echo "SMS is allowed as a second factor."
+exit 1
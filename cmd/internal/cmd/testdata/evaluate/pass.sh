@@ -0,0 +1 @@
+echo "$GEMARA_STEP passed for $GEMARA_REQUIREMENT_ID"
@@ -0,0 +1,30 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// A trimmed stand-in for the 1.0.0 schema, before families became groups.
+package gemara
+
+#ControlCatalog: {
+	title: string
+	metadata: {
+		id:               string
+		type:             "ControlCatalog"
+		"gemara-version": string
+		...
+	}
+	families?: [...#Family]
+	controls?: [...#Control]
+}
+
+#Family: {
+	id:          string
+	title:       string
+	description: string
+}
+
+#Control: {
+	id:        string
+	family:    string
+	title:     string
+	objective: string
+	...
+}
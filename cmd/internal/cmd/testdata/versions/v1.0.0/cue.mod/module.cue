@@ -0,0 +1,4 @@
+module: "github.com/gemaraproj/gemara@v1"
+language: {
+	version: "v0.12.0"
+}
@@ -0,0 +1,575 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/spf13/cobra"
+)
+
+var trendCmd = &cobra.Command{
+	Use:   "trend [logs-or-directories...]",
+	Short: "Report how control results change across a series of EvaluationLogs",
+	Long: `Order a series of EvaluationLogs by date and report how each control's
+result changed from one log to the next:
+
+  regressions   a control that Passed and then Failed;
+  fixes         a control that Failed and then Passed, with the time it
+                took to remediate, measured from the first failing log;
+  flapping      controls with at least --flapping regressions and fixes;
+  failing       controls whose latest result is Failed, since when, and
+                for how long as of the last log.
+
+Directories are searched recursively for EvaluationLogs; other artifacts
+in them are ignored. A log is dated by metadata.date, or else by the
+earliest start of its assessments. Control results are recomputed from the
+assessment logs as by results, and only Passed and Failed move a control
+between passing and failing; other results leave it where it was.
+
+Logs of different targets are reported separately unless --target selects
+one. The report is Markdown, HTML, or CSV with one row per control and log.`,
+	Args:          cobra.MinimumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE:          runTrend,
+}
+
+var trendFlags struct {
+	target     string
+	flapping   int
+	format     string
+	outputPath string
+}
+
+func newTrendCmd() *cobra.Command {
+	trendCmd.Flags().StringVar(&trendFlags.target, "target", "", "Report only the logs of this target id")
+	trendCmd.Flags().IntVar(&trendFlags.flapping, "flapping", 3, "Transitions after which a control counts as flapping")
+	trendCmd.Flags().StringVarP(&trendFlags.format, "format", "f", "", "Output format: markdown, html, or csv (default: from the output extension, else markdown)")
+	trendCmd.Flags().StringVarP(&trendFlags.outputPath, "output", "o", "", "Write the report to a file instead of stdout")
+	return trendCmd
+}
+
+func runTrend(cmd *cobra.Command, args []string) error {
+	format := trendFlags.format
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(trendFlags.outputPath)) {
+		case ".html", ".htm":
+			format = "html"
+		case ".csv":
+			format = "csv"
+		default:
+			format = "markdown"
+		}
+	}
+	if format != "markdown" && format != "html" && format != "csv" {
+		return fmt.Errorf("unsupported --format %q (expected markdown, html, or csv)", format)
+	}
+
+	logs, err := collectLogs(args, "EvaluationLog")
+	if err != nil {
+		return err
+	}
+	byTarget := make(map[string][]datedLog)
+	var targets []string
+	for _, l := range logs {
+		target := mapString(mapMap(l.Doc, "target"), "id")
+		if trendFlags.target != "" && target != trendFlags.target {
+			continue
+		}
+		if _, ok := byTarget[target]; !ok {
+			targets = append(targets, target)
+		}
+		byTarget[target] = append(byTarget[target], l)
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("no EvaluationLog found for target %q", trendFlags.target)
+	}
+	sort.Strings(targets)
+
+	var reports []*trendReport
+	for _, target := range targets {
+		reports = append(reports, computeTrend(target, byTarget[target], trendFlags.flapping))
+	}
+
+	return writeReport(trendFlags.outputPath, func(w io.Writer) error {
+		switch format {
+		case "html":
+			return writeTrendHTML(w, reports)
+		case "csv":
+			return writeTrendCSV(w, reports)
+		}
+		return writeTrendMarkdown(w, reports)
+	})
+}
+
+// datedLog is an EvaluationLog with the date it is ordered by.
+type datedLog struct {
+	File string
+	Doc  yaml.MapSlice
+	Date time.Time
+}
+
+func (l datedLog) id() string {
+	return mapString(mapMap(l.Doc, "metadata"), "id")
+}
+
+// collectLogs reads the logs of the given types named by paths, searching
+// directories recursively, and dates them.
+func collectLogs(paths []string, types ...string) ([]datedLog, error) {
+	var logs []datedLog
+	add := func(file string, explicit bool) error {
+		doc, err := readDocument(file)
+		if err != nil {
+			if explicit {
+				return err
+			}
+			return nil
+		}
+		if typ := mapString(mapMap(doc, "metadata"), "type"); !containsString(types, typ) {
+			if explicit {
+				return fmt.Errorf("%s is a %s, expected %s", file, typ, strings.Join(types, " or "))
+			}
+			return nil
+		}
+		date, ok := logDate(doc)
+		if !ok {
+			return fmt.Errorf("%s has no metadata.date and no start to order it by", file)
+		}
+		logs = append(logs, datedLog{File: file, Doc: doc, Date: date})
+		return nil
+	}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			if err := add(path, true); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		err = filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			switch strings.ToLower(filepath.Ext(file)) {
+			case ".yaml", ".yml", ".json":
+				return add(file, false)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return logs, nil
+}
+
+// logDate is metadata.date, or the earliest start of the log's assessments
+// or actions.
+func logDate(doc yaml.MapSlice) (time.Time, bool) {
+	if t, ok := timeValue(mapMap(doc, "metadata"), "date"); ok {
+		return t, true
+	}
+	var earliest time.Time
+	visit := func(m yaml.MapSlice) {
+		if t, ok := timeValue(m, "start"); ok && (earliest.IsZero() || t.Before(earliest)) {
+			earliest = t
+		}
+	}
+	for _, eval := range listMaps(mapList(doc, "evaluations")) {
+		for _, log := range listMaps(mapList(eval, "assessment-logs")) {
+			visit(log)
+		}
+	}
+	for _, action := range listMaps(mapList(doc, "actions")) {
+		visit(action)
+	}
+	return earliest, !earliest.IsZero()
+}
+
+const (
+	trendRegression = "regression"
+	trendFix        = "fix"
+)
+
+// trendReport is the history of the controls of one target.
+type trendReport struct {
+	Target   string
+	Logs     []datedLog
+	Controls []*controlTrend
+	Summary  trendSummary
+}
+
+type trendSummary struct {
+	Controls            int
+	Failing             int
+	Regressions         int
+	Fixes               int
+	Flapping            int
+	MeanTimeToRemediate time.Duration
+}
+
+// controlTrend is one control's results across the logs. Results has one
+// element per log, empty where the log did not evaluate the control.
+type controlTrend struct {
+	Reference    string
+	Control      string
+	Name         string
+	Results      []string
+	Current      string
+	Transitions  []trendTransition
+	Regressions  int
+	Fixes        int
+	Flapping     bool
+	FailingSince time.Time
+}
+
+// trendTransition is a control moving between passing and failing.
+// Remediation is set for fixes.
+type trendTransition struct {
+	Kind        string
+	Date        time.Time
+	Log         string
+	From        string
+	To          string
+	Remediation time.Duration
+}
+
+// computeTrend orders logs by date and follows each control through them.
+// A control with at least flapping transitions is flapping.
+func computeTrend(target string, logs []datedLog, flapping int) *trendReport {
+	logs = append([]datedLog(nil), logs...)
+	sort.SliceStable(logs, func(i, j int) bool { return logs[i].Date.Before(logs[j].Date) })
+	report := &trendReport{Target: target, Logs: logs}
+
+	controls := make(map[string]*controlTrend)
+	for i, l := range logs {
+		for _, eval := range listMaps(mapList(l.Doc, "evaluations")) {
+			control := mapMap(eval, "control")
+			key := mapString(control, "reference-id") + "/" + mapString(control, "entry-id")
+			ct, ok := controls[key]
+			if !ok {
+				ct = &controlTrend{
+					Reference: mapString(control, "reference-id"),
+					Control:   mapString(control, "entry-id"),
+					Name:      mapString(eval, "name"),
+					Results:   make([]string, len(logs)),
+				}
+				controls[key] = ct
+				report.Controls = append(report.Controls, ct)
+			}
+			var results []string
+			for _, log := range listMaps(mapList(eval, "assessment-logs")) {
+				results = append(results, mapString(log, "result"))
+			}
+			ct.Results[i] = aggregateResult(results)
+		}
+	}
+	sort.Slice(report.Controls, func(i, j int) bool {
+		a, b := report.Controls[i], report.Controls[j]
+		if a.Reference != b.Reference {
+			return a.Reference < b.Reference
+		}
+		return a.Control < b.Control
+	})
+
+	var remediations []time.Duration
+	for _, ct := range report.Controls {
+		ct.follow(logs)
+		ct.Flapping = flapping > 0 && len(ct.Transitions) >= flapping
+		for _, t := range ct.Transitions {
+			if t.Kind == trendFix {
+				remediations = append(remediations, t.Remediation)
+			}
+		}
+
+		s := &report.Summary
+		s.Controls++
+		s.Regressions += ct.Regressions
+		s.Fixes += ct.Fixes
+		if ct.Flapping {
+			s.Flapping++
+		}
+		if !ct.FailingSince.IsZero() {
+			s.Failing++
+		}
+	}
+	if len(remediations) > 0 {
+		var total time.Duration
+		for _, d := range remediations {
+			total += d
+		}
+		report.Summary.MeanTimeToRemediate = total / time.Duration(len(remediations))
+	}
+	return report
+}
+
+// follow records the control's transitions between Passed and Failed.
+func (ct *controlTrend) follow(logs []datedLog) {
+	var last string
+	var failedAt time.Time
+	for i, result := range ct.Results {
+		if result == "" {
+			continue
+		}
+		ct.Current = result
+		switch result {
+		case "Failed":
+			if last == "Passed" {
+				ct.Regressions++
+				ct.Transitions = append(ct.Transitions, trendTransition{
+					Kind: trendRegression, Date: logs[i].Date, Log: logs[i].id(), From: last, To: result,
+				})
+			}
+			if last != "Failed" {
+				failedAt = logs[i].Date
+			}
+			last = result
+		case "Passed":
+			if last == "Failed" {
+				ct.Fixes++
+				ct.Transitions = append(ct.Transitions, trendTransition{
+					Kind: trendFix, Date: logs[i].Date, Log: logs[i].id(), From: last, To: result,
+					Remediation: logs[i].Date.Sub(failedAt),
+				})
+			}
+			last = result
+		}
+	}
+	if last == "Failed" {
+		ct.FailingSince = failedAt
+	}
+}
+
+// trendEvent is a transition with its control, for the report tables.
+type trendEvent struct {
+	*controlTrend
+	trendTransition
+}
+
+// Events lists the transitions of kind across all controls by date.
+func (r *trendReport) Events(kind string) []trendEvent {
+	var out []trendEvent
+	for _, ct := range r.Controls {
+		for _, t := range ct.Transitions {
+			if t.Kind == kind {
+				out = append(out, trendEvent{ct, t})
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Date.Before(out[j].Date) })
+	return out
+}
+
+// Flapping lists the flapping controls.
+func (r *trendReport) Flapping() []*controlTrend {
+	var out []*controlTrend
+	for _, ct := range r.Controls {
+		if ct.Flapping {
+			out = append(out, ct)
+		}
+	}
+	return out
+}
+
+// Failing lists the controls whose latest result is Failed, longest
+// failing first.
+func (r *trendReport) Failing() []*controlTrend {
+	var out []*controlTrend
+	for _, ct := range r.Controls {
+		if !ct.FailingSince.IsZero() {
+			out = append(out, ct)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].FailingSince.Before(out[j].FailingSince) })
+	return out
+}
+
+// Latest is the date of the last log.
+func (r *trendReport) Latest() time.Time {
+	return r.Logs[len(r.Logs)-1].Date
+}
+
+var trendFuncs = template.FuncMap{
+	"date": func(t time.Time) string { return t.UTC().Format("2006-01-02") },
+	"duration": func(d time.Duration) string {
+		if d >= 24*time.Hour {
+			return fmt.Sprintf("%.1f days", d.Hours()/24)
+		}
+		return fmt.Sprintf("%.1f hours", d.Hours())
+	},
+	"since": func(t, now time.Time) time.Duration { return now.Sub(t) },
+	"cell": func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return strings.ReplaceAll(s, "|", `\|`)
+	},
+	"regression": func() string { return trendRegression },
+	"fix":        func() string { return trendFix },
+}
+
+const trendMarkdown = `{{range $i, $r := .}}{{if $i}}
+{{end}}# Evaluation trend for {{cell $r.Target}}
+
+{{len $r.Logs}} log(s) from {{date (index $r.Logs 0).Date}} to {{date $r.Latest}}.
+
+| Controls | Failing | Regressions | Fixes | Flapping | Mean time to remediate |
+| --- | --- | --- | --- | --- | --- |
+| {{$r.Summary.Controls}} | {{$r.Summary.Failing}} | {{$r.Summary.Regressions}} | {{$r.Summary.Fixes}} | {{$r.Summary.Flapping}} | {{if $r.Summary.Fixes}}{{duration $r.Summary.MeanTimeToRemediate}}{{else}}-{{end}} |
+
+## Regressions
+{{with $r.Events regression}}
+| Date | Control | Name | From | To | Log |
+| --- | --- | --- | --- | --- | --- |
+{{range .}}| {{date .Date}} | {{cell .Control}} | {{cell .Name}} | {{.From}} | {{.To}} | {{cell .Log}} |
+{{end}}{{else}}
+None.
+{{end}}
+## Fixes
+{{with $r.Events fix}}
+| Date | Control | Name | Time to remediate | Log |
+| --- | --- | --- | --- | --- |
+{{range .}}| {{date .Date}} | {{cell .Control}} | {{cell .Name}} | {{duration .Remediation}} | {{cell .Log}} |
+{{end}}{{else}}
+None.
+{{end}}
+## Flapping controls
+{{with $r.Flapping}}
+| Control | Name | Regressions | Fixes | Current |
+| --- | --- | --- | --- | --- |
+{{range .}}| {{cell .Control}} | {{cell .Name}} | {{.Regressions}} | {{.Fixes}} | {{.Current}} |
+{{end}}{{else}}
+None.
+{{end}}
+## Currently failing
+{{with $r.Failing}}
+| Control | Name | Failing since | Failing for (as of last log) |
+| --- | --- | --- | --- |
+{{range .}}| {{cell .Control}} | {{cell .Name}} | {{date .FailingSince}} | {{duration (since .FailingSince $r.Latest)}} |
+{{end}}{{else}}
+None.
+{{end}}
+## History
+
+| Control | Name |{{range $r.Logs}} {{date .Date}} |{{end}}
+| --- | --- |{{range $r.Logs}} --- |{{end}}
+{{range $r.Controls}}| {{cell .Control}} | {{cell .Name}} |{{range .Results}} {{cell .}} |{{end}}
+{{end}}{{end}}`
+
+const trendHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Evaluation trend</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+td.Failed { background: #f8d7da; }
+td.Passed { background: #d4edda; }
+</style>
+</head>
+<body>
+{{range $r := .}}<h1>Evaluation trend for {{$r.Target}}</h1>
+<p>{{len $r.Logs}} log(s) from {{date (index $r.Logs 0).Date}} to {{date $r.Latest}}.</p>
+<table>
+<tr><th>Controls</th><th>Failing</th><th>Regressions</th><th>Fixes</th><th>Flapping</th><th>Mean time to remediate</th></tr>
+<tr><td>{{$r.Summary.Controls}}</td><td>{{$r.Summary.Failing}}</td><td>{{$r.Summary.Regressions}}</td><td>{{$r.Summary.Fixes}}</td><td>{{$r.Summary.Flapping}}</td><td>{{if $r.Summary.Fixes}}{{duration $r.Summary.MeanTimeToRemediate}}{{else}}-{{end}}</td></tr>
+</table>
+<h2>Regressions</h2>
+{{with $r.Events regression}}<table>
+<tr><th>Date</th><th>Control</th><th>Name</th><th>From</th><th>To</th><th>Log</th></tr>
+{{range .}}<tr><td>{{date .Date}}</td><td>{{.Control}}</td><td>{{.Name}}</td><td>{{.From}}</td><td>{{.To}}</td><td>{{.Log}}</td></tr>
+{{end}}</table>
+{{else}}<p>None.</p>
+{{end}}<h2>Fixes</h2>
+{{with $r.Events fix}}<table>
+<tr><th>Date</th><th>Control</th><th>Name</th><th>Time to remediate</th><th>Log</th></tr>
+{{range .}}<tr><td>{{date .Date}}</td><td>{{.Control}}</td><td>{{.Name}}</td><td>{{duration .Remediation}}</td><td>{{.Log}}</td></tr>
+{{end}}</table>
+{{else}}<p>None.</p>
+{{end}}<h2>Flapping controls</h2>
+{{with $r.Flapping}}<table>
+<tr><th>Control</th><th>Name</th><th>Regressions</th><th>Fixes</th><th>Current</th></tr>
+{{range .}}<tr><td>{{.Control}}</td><td>{{.Name}}</td><td>{{.Regressions}}</td><td>{{.Fixes}}</td><td>{{.Current}}</td></tr>
+{{end}}</table>
+{{else}}<p>None.</p>
+{{end}}<h2>Currently failing</h2>
+{{with $r.Failing}}<table>
+<tr><th>Control</th><th>Name</th><th>Failing since</th><th>Failing for (as of last log)</th></tr>
+{{range .}}<tr><td>{{.Control}}</td><td>{{.Name}}</td><td>{{date .FailingSince}}</td><td>{{duration (since .FailingSince $r.Latest)}}</td></tr>
+{{end}}</table>
+{{else}}<p>None.</p>
+{{end}}<h2>History</h2>
+<table>
+<tr><th>Control</th><th>Name</th>{{range $r.Logs}}<th>{{date .Date}}</th>{{end}}</tr>
+{{range $r.Controls}}<tr><td>{{.Control}}</td><td>{{.Name}}</td>{{range .Results}}<td class="{{.}}">{{if .}}{{.}}{{else}}-{{end}}</td>{{end}}</tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`
+
+func writeTrendMarkdown(w io.Writer, reports []*trendReport) error {
+	tmpl, err := template.New("trend").Funcs(trendFuncs).Parse(trendMarkdown)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, reports)
+}
+
+func writeTrendHTML(w io.Writer, reports []*trendReport) error {
+	tmpl, err := htmltemplate.New("trend").Funcs(htmltemplate.FuncMap(trendFuncs)).Parse(trendHTML)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, reports)
+}
+
+// writeTrendCSV writes one row per control and log that evaluated it.
+func writeTrendCSV(w io.Writer, reports []*trendReport) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"target", "date", "log", "reference-id", "control", "name", "result", "transition", "time-to-remediate-hours"}); err != nil {
+		return err
+	}
+	for _, r := range reports {
+		for _, ct := range r.Controls {
+			for i, result := range ct.Results {
+				if result == "" {
+					continue
+				}
+				l := r.Logs[i]
+				var kind, remediation string
+				for _, t := range ct.Transitions {
+					if t.Log == l.id() && t.Date.Equal(l.Date) {
+						kind = t.Kind
+						if t.Kind == trendFix {
+							remediation = fmt.Sprintf("%.0f", t.Remediation.Hours())
+						}
+					}
+				}
+				row := []string{r.Target, l.Date.UTC().Format(time.RFC3339), l.id(), ct.Reference, ct.Control, ct.Name, result, kind, remediation}
+				if err := cw.Write(row); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
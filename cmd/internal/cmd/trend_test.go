@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestComputeTrend(t *testing.T) {
+	logs, err := collectLogs([]string{"testdata/trend"}, "EvaluationLog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 4 {
+		t.Fatalf("found %d logs, want 4", len(logs))
+	}
+
+	report := computeTrend("example-repo", logs, 3)
+
+	for i, l := range report.Logs {
+		if want := "WEEKLY-" + string(rune('1'+i)); l.id() != want {
+			t.Errorf("log %d is %s, want %s", i, l.id(), want)
+		}
+	}
+	s := report.Summary
+	if s.Controls != 3 || s.Failing != 2 || s.Regressions != 3 || s.Fixes != 2 || s.Flapping != 1 {
+		t.Errorf("unexpected summary: %+v", s)
+	}
+	if want := 252 * time.Hour; s.MeanTimeToRemediate != want {
+		t.Errorf("mean time to remediate %v, want %v", s.MeanTimeToRemediate, want)
+	}
+
+	fixes := report.Events(trendFix)
+	if len(fixes) != 2 || fixes[1].Control != "LV-02" || fixes[1].Remediation != 14*24*time.Hour {
+		t.Errorf("unexpected fixes: %+v", fixes)
+	}
+	if flapping := report.Flapping(); len(flapping) != 1 || flapping[0].Control != "LV-01" {
+		t.Errorf("unexpected flapping controls: %+v", flapping)
+	}
+	if failing := report.Failing(); len(failing) != 2 || failing[1].Control != "LV-03" {
+		t.Errorf("unexpected failing controls: %+v", failing)
+	}
+}
+
+func TestWriteTrend(t *testing.T) {
+	logs, err := collectLogs([]string{"testdata/trend"}, "EvaluationLog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reports := []*trendReport{computeTrend("example-repo", logs, 3)}
+
+	for name, write := range map[string]func(*bytes.Buffer) error{
+		"markdown": func(b *bytes.Buffer) error { return writeTrendMarkdown(b, reports) },
+		"html":     func(b *bytes.Buffer) error { return writeTrendHTML(b, reports) },
+		"csv":      func(b *bytes.Buffer) error { return writeTrendCSV(b, reports) },
+	} {
+		var buf bytes.Buffer
+		if err := write(&buf); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !strings.Contains(buf.String(), "Branch Protection") {
+			t.Errorf("%s report does not mention the controls:\n%s", name, buf.String())
+		}
+		if name != "csv" && !strings.Contains(buf.String(), "Failing for (as of last log)") {
+			t.Errorf("%s report does not say how long controls have been failing as of the last log:\n%s", name, buf.String())
+		}
+	}
+}
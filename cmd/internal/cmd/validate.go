@@ -0,0 +1,297 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"cuelang.org/go/cue/errors"
+	"github.com/spf13/cobra"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate [files...]",
+	Short: "Validate Gemara artifacts against the CUE schema",
+	Long: `Validate one or more Gemara YAML or JSON artifacts against the CUE schema.
+The schema definition is inferred from metadata.type unless --definition is set.
+Problems are reported as diagnostics with file, line, column, CUE path, the
+failing constraint, and the offending value. Supported formats are text, json,
+sarif (SARIF 2.1.0), and github (workflow annotation commands).
+
+With --declared, each artifact is also validated against the schema version
+named in its metadata.gemara-version, resolved from --versions-dir and/or the
+CUE registry, so pinned artifacts can see what upgrading would break.
+
+With --references, every reference-id must name a declared mapping
+reference, and every entry reference (entry-id, entries, exclusions, and the
+mappings of a MappingDocument) must name an entry of the referenced artifact.
+Referenced artifacts are loaded from file:// urls directly and from http(s)
+urls through --mirror or --cache; --fetch downloads missing ones into the
+cache. References that cannot be loaded are reported as warnings.
+
+With --workspace, the artifacts listed in a gemara.work.yaml manifest are
+validated together with any files given as arguments: each is checked
+against the schema, and references between them resolve to the local
+files, giving one consolidated report for the whole corpus.`,
+	Args:          validateArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE:          runValidate,
+}
+
+var validateFlags struct {
+	schemaDir   string
+	definition  string
+	format      string
+	outputPath  string
+	declared    bool
+	versionsDir string
+	registry    bool
+	references  bool
+	mirrorDir   string
+	cacheDir    string
+	fetch       bool
+	workspace   string
+}
+
+func newValidateCmd() *cobra.Command {
+	validateCmd.Flags().StringVarP(&validateFlags.schemaDir, "schema", "s", "..", "Path to the CUE package directory")
+	validateCmd.Flags().StringVarP(&validateFlags.definition, "definition", "d", "", "Schema definition to validate against (default: inferred from metadata.type)")
+	validateCmd.Flags().StringVarP(&validateFlags.format, "format", "f", "text", "Output format: text, json, sarif, or github")
+	validateCmd.Flags().StringVarP(&validateFlags.outputPath, "output", "o", "", "Write the report to a file instead of stdout")
+	validateCmd.Flags().BoolVar(&validateFlags.declared, "declared", false, "Also validate each artifact against the schema version in its metadata.gemara-version")
+	validateCmd.Flags().StringVar(&validateFlags.versionsDir, "versions-dir", "", "Directory of vendored schema versions (e.g. v1.1.0/) used by --declared")
+	validateCmd.Flags().BoolVar(&validateFlags.registry, "registry", false, "Resolve declared versions from the CUE registry and module cache")
+	validateCmd.Flags().BoolVar(&validateFlags.references, "references", false, "Check that mapping and entry references resolve")
+	validateCmd.Flags().StringVar(&validateFlags.mirrorDir, "mirror", "", "Read-only directory mirroring http(s) artifacts as host/path, used by --references")
+	validateCmd.Flags().StringVar(&validateFlags.cacheDir, "cache", "", "Directory where downloaded http(s) artifacts are cached, used by --references")
+	validateCmd.Flags().BoolVar(&validateFlags.fetch, "fetch", false, "Download http(s) artifacts missing from the mirror and cache")
+	validateCmd.Flags().StringVar(&validateFlags.workspace, "workspace", "", "Validate the artifacts of a workspace manifest (gemara.work.yaml or its directory); implies --references")
+	return validateCmd
+}
+
+func validateArgs(cmd *cobra.Command, args []string) error {
+	if validateFlags.workspace != "" {
+		return nil
+	}
+	return cobra.MinimumNArgs(1)(cmd, args)
+}
+
+func runValidate(cmd *cobra.Command, args []string) error {
+	ctx := cuecontext.New()
+	schema, err := loadSchema(ctx, validateFlags.schemaDir)
+	if err != nil {
+		return err
+	}
+	current := readVersion(validateFlags.schemaDir)
+
+	var resolver *schemaResolver
+	if validateFlags.declared {
+		if validateFlags.versionsDir == "" && !validateFlags.registry {
+			return fmt.Errorf("--declared requires --versions-dir or --registry")
+		}
+		resolver = newSchemaResolver(ctx, validateFlags.versionsDir, validateFlags.registry)
+	}
+
+	var (
+		references *artifactResolver
+		results    []ValidationResult
+		files      = args
+	)
+	if validateFlags.workspace != "" {
+		var problems *ValidationResult
+		files, references, problems, err = openWorkspace(validateFlags.workspace, validateFlags.mirrorDir, validateFlags.cacheDir, validateFlags.fetch, args)
+		if err != nil {
+			return err
+		}
+		if problems != nil {
+			results = append(results, *problems)
+		}
+	} else if validateFlags.references {
+		references = newArtifactResolver(validateFlags.mirrorDir, validateFlags.cacheDir, validateFlags.fetch)
+	}
+
+	for _, file := range files {
+		result := validateArtifact(ctx, schema, file, validateFlags.definition)
+		if references != nil {
+			result = withReferences(ctx, result, references)
+		}
+		if resolver == nil {
+			results = append(results, result)
+			continue
+		}
+		result.Against, result.SchemaVersion = againstCurrent, current
+		results = append(results, result, validateDeclared(ctx, resolver, file, validateFlags.definition))
+	}
+
+	if err := writeReport(validateFlags.outputPath, func(w io.Writer) error {
+		if err := writeDiagnostics(w, validateFlags.format, results); err != nil {
+			return err
+		}
+		if validateFlags.workspace != "" && (validateFlags.format == "" || validateFlags.format == "text") {
+			writeSummary(w, results)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	invalid := 0
+	for _, r := range results {
+		if !r.Valid {
+			invalid++
+		}
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d validation(s) failed", invalid, len(results))
+	}
+	return nil
+}
+
+// validateArtifact checks a single artifact file against schema, returning
+// its diagnostics rather than an error so that reports cover every input.
+func validateArtifact(ctx *cue.Context, schema cue.Value, file, definition string) ValidationResult {
+	src, err := loadArtifactSource(ctx, file)
+	if err != nil {
+		return ValidationResult{File: file, Diagnostics: fileDiagnostics(err, file, ruleSyntax)}
+	}
+	return validateSource(schema, src, definition, ruleSchema)
+}
+
+// validateDeclared checks an artifact against the schema version it
+// declares in metadata.gemara-version.
+func validateDeclared(ctx *cue.Context, resolver *schemaResolver, file, definition string) ValidationResult {
+	result := ValidationResult{File: file, Against: againstDeclared}
+
+	src, err := loadArtifactSource(ctx, file)
+	if err != nil {
+		result.Diagnostics = fileDiagnostics(err, file, ruleSyntax)
+		return result
+	}
+	version, err := declaredVersion(src.Value)
+	if err != nil {
+		result.Diagnostics = fileDiagnostics(err, file, ruleVersion)
+		return result
+	}
+	result.SchemaVersion = version
+
+	schema, err := resolver.resolve(version)
+	if err != nil {
+		result.Diagnostics = fileDiagnostics(err, file, ruleVersion)
+		return result
+	}
+	declared := validateSource(schema, src, definition, ruleDeclaredSchema)
+	declared.Against, declared.SchemaVersion = result.Against, result.SchemaVersion
+	return declared
+}
+
+func validateSource(schema cue.Value, src *artifactSource, definition, rule string) ValidationResult {
+	result := ValidationResult{File: src.File}
+
+	def, name, err := lookupDefinition(schema, src.Value, definition)
+	result.Definition = name
+	if err != nil {
+		result.Diagnostics = fileDiagnostics(err, src.File, rule)
+		return result
+	}
+
+	err = def.Unify(src.Value).Validate(cue.Concrete(true), cue.All())
+	result.Diagnostics = cueDiagnostics(err, src.File, src, rule)
+	sortDiagnostics(result.Diagnostics)
+	result.Valid = len(result.Diagnostics) == 0
+	return result
+}
+
+// validateGenerated checks an artifact a command produced before it is
+// written; name gives the diagnostics a file to point at and selects the
+// decoder. Problems are written to stderr.
+func validateGenerated(schemaDir, definition, name string, data []byte) error {
+	ctx := cuecontext.New()
+	schema, err := loadSchema(ctx, schemaDir)
+	if err != nil {
+		return err
+	}
+	src, err := parseArtifactSource(ctx, name, data)
+	if err != nil {
+		return err
+	}
+	if result := validateSource(schema, src, definition, ruleSchema); !result.Valid {
+		_ = writeTextDiagnostics(os.Stderr, []ValidationResult{result})
+		return fmt.Errorf("result does not validate against %s", result.Definition)
+	}
+	return nil
+}
+
+// withReferences adds the reference diagnostics of an artifact that parsed
+// to its result. Warnings alone do not make the artifact invalid.
+func withReferences(ctx *cue.Context, result ValidationResult, resolver *artifactResolver) ValidationResult {
+	src, err := loadArtifactSource(ctx, result.File)
+	if err != nil {
+		return result
+	}
+	doc, err := readDocument(result.File)
+	if err != nil {
+		return result
+	}
+	result.Diagnostics = append(result.Diagnostics, checkReferences(result.File, doc, src, resolver)...)
+	sortDiagnostics(result.Diagnostics)
+	result.Valid = !hasErrors(result.Diagnostics)
+	return result
+}
+
+// writeSummary closes a text report covering many artifacts.
+func writeSummary(w io.Writer, results []ValidationResult) {
+	var errs, warnings, invalid int
+	for _, r := range results {
+		if !r.Valid {
+			invalid++
+		}
+		for _, d := range r.Diagnostics {
+			if d.Severity == severityError {
+				errs++
+			} else {
+				warnings++
+			}
+		}
+	}
+	fmt.Fprintf(w, "\n%d file(s) checked: %d invalid, %d error(s), %d warning(s)\n", len(results), invalid, errs, warnings)
+}
+
+func hasErrors(diags []Diagnostic) bool {
+	for _, d := range diags {
+		if d.Severity == severityError {
+			return true
+		}
+	}
+	return false
+}
+
+// fileDiagnostics reports an error that has no CUE path, keeping any source
+// position the error carries.
+func fileDiagnostics(err error, file, rule string) []Diagnostic {
+	var cueErr errors.Error
+	if errors.As(err, &cueErr) {
+		return cueDiagnostics(err, file, nil, rule)
+	}
+	return []Diagnostic{{File: file, Rule: rule, Severity: severityError, Message: err.Error()}}
+}
+
+// writeReport writes to path, or to stdout when path is empty.
+func writeReport(path string, write func(io.Writer) error) error {
+	if path == "" {
+		return write(os.Stdout)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", path, err)
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,269 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/goccy/go-yaml"
+	"github.com/spf13/cobra"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify [enforcement-logs...]",
+	Short: "Check that EnforcementLog actions are backed by the logs and policies they cite",
+	Long: `Load the EvaluationLogs and Policies an EnforcementLog references and check
+that its actions are supported by them:
+
+  enforcement-finding    Each finding's log must resolve to an EvaluationLog
+                         that assessed the finding's entry (a requirement or
+                         control entry-id), for the finding's requirement and
+                         plan, with the finding's result. Enforced and
+                         Tolerated actions need a finding that did not pass.
+  enforcement-method     method must name an enforcement method (Gate or
+                         Remediation) of a Policy.
+  enforcement-exception  exceptions must resolve; a Tolerated action should
+                         cite one.
+
+The requirement, plan, method, and exception mappings are also checked as by
+validate --references. Referenced artifacts are resolved through --mirror,
+--cache, and --workspace as by lint. Warnings only fail the run with
+--strict.`,
+	Args:          verifyArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE:          runVerify,
+}
+
+var verifyFlags struct {
+	format     string
+	outputPath string
+	workspace  string
+	mirrorDir  string
+	cacheDir   string
+	fetch      bool
+	strict     bool
+}
+
+func newVerifyCmd() *cobra.Command {
+	verifyCmd.Flags().StringVarP(&verifyFlags.format, "format", "f", "text", "Output format: text, json, sarif, or github")
+	verifyCmd.Flags().StringVarP(&verifyFlags.outputPath, "output", "o", "", "Write the report to a file instead of stdout")
+	verifyCmd.Flags().StringVar(&verifyFlags.workspace, "workspace", "", "Verify the EnforcementLogs of a workspace manifest (gemara.work.yaml or its directory)")
+	verifyCmd.Flags().StringVar(&verifyFlags.mirrorDir, "mirror", "", "Read-only directory mirroring http(s) artifacts as host/path")
+	verifyCmd.Flags().StringVar(&verifyFlags.cacheDir, "cache", "", "Directory where downloaded http(s) artifacts are cached")
+	verifyCmd.Flags().BoolVar(&verifyFlags.fetch, "fetch", false, "Download http(s) artifacts missing from the mirror and cache")
+	verifyCmd.Flags().BoolVar(&verifyFlags.strict, "strict", false, "Fail on warnings as well as errors")
+	return verifyCmd
+}
+
+func verifyArgs(cmd *cobra.Command, args []string) error {
+	if verifyFlags.workspace != "" {
+		return nil
+	}
+	return cobra.MinimumNArgs(1)(cmd, args)
+}
+
+func runVerify(cmd *cobra.Command, args []string) error {
+	var (
+		resolver *artifactResolver
+		results  []ValidationResult
+		files    = args
+		err      error
+	)
+	if verifyFlags.workspace != "" {
+		var problems *ValidationResult
+		files, resolver, problems, err = openWorkspace(verifyFlags.workspace, verifyFlags.mirrorDir, verifyFlags.cacheDir, verifyFlags.fetch, args)
+		if err != nil {
+			return err
+		}
+		if problems != nil {
+			results = append(results, *problems)
+		}
+	} else {
+		resolver = newArtifactResolver(verifyFlags.mirrorDir, verifyFlags.cacheDir, verifyFlags.fetch)
+	}
+
+	ctx := cuecontext.New()
+	for _, file := range files {
+		result := ValidationResult{File: file, Definition: "enforcement linkage"}
+		doc, err := readDocument(file)
+		if err != nil {
+			result.Diagnostics = fileDiagnostics(err, file, ruleSyntax)
+			results = append(results, result)
+			continue
+		}
+		if typ := mapString(mapMap(doc, "metadata"), "type"); typ != "EnforcementLog" {
+			if verifyFlags.workspace != "" {
+				continue
+			}
+			return fmt.Errorf("%s is a %s, expected an EnforcementLog", file, typ)
+		}
+		src, err := loadArtifactSource(ctx, file)
+		if err != nil {
+			src = nil
+		}
+		result.Diagnostics = verifyEnforcement(file, doc, src, resolver)
+		result.Valid = !hasErrors(result.Diagnostics)
+		results = append(results, result)
+	}
+
+	if err := writeReport(verifyFlags.outputPath, func(w io.Writer) error {
+		return writeDiagnostics(w, verifyFlags.format, results)
+	}); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, r := range results {
+		if !r.Valid || (verifyFlags.strict && len(r.Diagnostics) > 0) {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d artifact(s) failed verification", failed, len(results))
+	}
+	return nil
+}
+
+// linkageCheck verifies the actions of one EnforcementLog.
+type linkageCheck struct {
+	file     string
+	src      *artifactSource
+	resolver *artifactResolver
+	self     *entryIndex
+	diags    []Diagnostic
+}
+
+// verifyEnforcement returns the linkage diagnostics for the EnforcementLog
+// doc, along with its reference diagnostics.
+func verifyEnforcement(file string, doc yaml.MapSlice, src *artifactSource, resolver *artifactResolver) []Diagnostic {
+	c := &linkageCheck{file: file, src: src, resolver: resolver, self: indexEntries(doc)}
+	c.self.Dir = filepath.Dir(file)
+	c.self.Doc = doc
+
+	for i, action := range listMaps(mapList(doc, "actions")) {
+		path := []string{"actions", strconv.Itoa(i)}
+		disposition := mapString(action, "disposition")
+		c.checkMethod(appendPath(path, "method"), mapMap(action, "method"))
+
+		justification := mapMap(action, "justification")
+		supported := false
+		for j, finding := range listMaps(mapList(justification, "assessments")) {
+			c.checkFinding(appendPath(path, "justification", "assessments", strconv.Itoa(j)), finding)
+			if r := mapString(finding, "result"); r != "Passed" && r != "Not Applicable" {
+				supported = true
+			}
+		}
+		if (disposition == dispositionEnforced || disposition == dispositionTolerated) && !supported {
+			c.report(ruleEnforcementFinding, severityError, appendPath(path, "disposition"), disposition,
+				fmt.Sprintf("%s action cites no finding that did not pass", disposition))
+		}
+
+		exceptions := listMaps(mapList(justification, "exceptions"))
+		for j, exc := range exceptions {
+			refID := mapString(exc, "reference-id")
+			if _, err := c.resolver.follow(c.self, refID); err != nil {
+				c.report(ruleEnforcementException, severityError,
+					appendPath(path, "justification", "exceptions", strconv.Itoa(j), "reference-id"), refID,
+					fmt.Sprintf("exception does not resolve: %v", err))
+			}
+		}
+		if disposition == dispositionTolerated && len(exceptions) == 0 {
+			c.report(ruleEnforcementException, severityWarning, appendPath(path, "disposition"), disposition,
+				"Tolerated action cites no exception that authorizes it")
+		}
+	}
+
+	diags := append(c.diags, checkReferences(file, doc, src, resolver)...)
+	sortDiagnostics(diags)
+	return diags
+}
+
+// checkMethod confirms that method names an enforcement method of a Policy.
+func (c *linkageCheck) checkMethod(path []string, method yaml.MapSlice) {
+	refID, id := mapString(method, "reference-id"), mapString(method, "entry-id")
+	policy, err := c.resolver.follow(c.self, refID)
+	if err != nil {
+		c.report(ruleEnforcementMethod, severityError, appendPath(path, "reference-id"), refID,
+			fmt.Sprintf("cannot load the policy of method %s: %v", id, err))
+		return
+	}
+	if policy.Type != "Policy" {
+		c.report(ruleEnforcementMethod, severityError, appendPath(path, "reference-id"), refID,
+			fmt.Sprintf("method %s references %s, a %s rather than a Policy", id, refID, policy.Type))
+		return
+	}
+	adherence := mapMap(policy.Doc, "adherence")
+	if m := findEntry(adherence, "enforcement-methods", id); m != nil {
+		if typ := mapString(m, "type"); typ != "Gate" && typ != "Remediation" {
+			c.report(ruleEnforcementMethod, severityError, appendPath(path, "entry-id"), id,
+				fmt.Sprintf("enforcement method %s of %s has type %s, expected Gate or Remediation", id, refID, typ))
+		}
+		return
+	}
+	msg := fmt.Sprintf("%s has no enforcement method %s", refID, id)
+	if findEntry(adherence, "evaluation-methods", id) != nil {
+		msg = fmt.Sprintf("%s of %s is an evaluation method, not an enforcement method", id, refID)
+	}
+	c.report(ruleEnforcementMethod, severityError, appendPath(path, "entry-id"), id, msg)
+}
+
+// checkFinding confirms that the EvaluationLog a finding cites recorded the
+// finding's result for its entry, requirement, and plan.
+func (c *linkageCheck) checkFinding(path []string, finding yaml.MapSlice) {
+	logRef := mapMap(finding, "log")
+	refID, entryID := mapString(logRef, "reference-id"), mapString(logRef, "entry-id")
+	logPath := appendPath(path, "log")
+	idx, err := c.resolver.follow(c.self, refID)
+	if err != nil {
+		c.report(ruleEnforcementFinding, severityError, appendPath(logPath, "reference-id"), refID,
+			fmt.Sprintf("cannot load the evaluation log of this finding: %v", err))
+		return
+	}
+	if idx.Type != "EvaluationLog" {
+		c.report(ruleEnforcementFinding, severityError, appendPath(logPath, "reference-id"), refID,
+			fmt.Sprintf("finding log references %s, a %s rather than an EvaluationLog", refID, idx.Type))
+		return
+	}
+
+	requirement := mapString(mapMap(finding, "requirement"), "entry-id")
+	plan := mapString(mapMap(finding, "plan"), "entry-id")
+	var entries, matched []string
+	for _, eval := range listMaps(mapList(idx.Doc, "evaluations")) {
+		control := mapString(mapMap(eval, "control"), "entry-id")
+		for _, a := range listMaps(mapList(eval, "assessment-logs")) {
+			req := mapString(mapMap(a, "requirement"), "entry-id")
+			if entryID != req && entryID != control {
+				continue
+			}
+			entries = append(entries, req)
+			if (requirement == "" || requirement == req) && (plan == "" || plan == mapString(mapMap(a, "plan"), "entry-id")) {
+				matched = append(matched, mapString(a, "result"))
+			}
+		}
+	}
+	switch {
+	case len(entries) == 0:
+		c.report(ruleEnforcementFinding, severityError, appendPath(logPath, "entry-id"), entryID,
+			fmt.Sprintf("%s has no assessment of %s", refID, entryID))
+	case len(matched) == 0:
+		what := "requirement " + requirement
+		if plan != "" {
+			what += " under plan " + plan
+		}
+		c.report(ruleEnforcementFinding, severityError, path, entryID,
+			fmt.Sprintf("%s has no assessment of %s for %s (it assessed %s)", refID, entryID, what, strings.Join(entries, ", ")))
+	case !containsString(matched, mapString(finding, "result")):
+		c.report(ruleEnforcementFinding, severityError, appendPath(path, "result"), mapString(finding, "result"),
+			fmt.Sprintf("finding result is %s but %s recorded %s for %s", mapString(finding, "result"), refID, strings.Join(matched, ", "), entryID))
+	}
+}
+
+func (c *linkageCheck) report(rule, severity string, path []string, value, msg string) {
+	c.diags = append(c.diags, diagnosticAt(c.file, c.src, rule, severity, path, value, msg))
+}
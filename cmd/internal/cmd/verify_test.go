@@ -0,0 +1,42 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import "testing"
+
+func TestVerifyEnforcement(t *testing.T) {
+	resolver := newArtifactResolver("", "", false)
+
+	file := "testdata/linked-enforcement-log.yaml"
+	doc, err := readDocument(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diags := verifyEnforcement(file, doc, nil, resolver); len(diags) > 0 {
+		t.Errorf("unexpected diagnostics for %s: %+v", file, diags)
+	}
+
+	file = "testdata/forged-enforcement-log.yaml"
+	if doc, err = readDocument(file); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		`actions[0].disposition`:                                 ruleEnforcementException,
+		`actions[0].justification.assessments[0].result`:         ruleEnforcementFinding,
+		`actions[1].method."entry-id"`:                           ruleEnforcementMethod,
+		`actions[1].justification.exceptions[0]."reference-id"`:  ruleEnforcementException,
+		`actions[2].justification.assessments[0].log."entry-id"`: ruleEnforcementFinding,
+	}
+	for _, d := range verifyEnforcement(file, doc, nil, resolver) {
+		if d.Rule == ruleReference {
+			continue
+		}
+		if want[d.Path] != d.Rule {
+			t.Errorf("unexpected %s diagnostic at %s: %s", d.Rule, d.Path, d.Message)
+		}
+		delete(want, d.Path)
+	}
+	for path, rule := range want {
+		t.Errorf("missing %s diagnostic at %s", rule, path)
+	}
+}
@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/load"
+	"cuelang.org/go/mod/modconfig"
+	"cuelang.org/go/mod/module"
+)
+
+const gemaraModulePath = "github.com/gemaraproj/gemara"
+
+// schemaResolver loads released Gemara schemas by version, either from a
+// local directory of vendored module versions or from the CUE registry
+// (which reuses the CUE module cache when the version was fetched before).
+type schemaResolver struct {
+	ctx         *cue.Context
+	versionsDir string
+	useRegistry bool
+
+	registry modconfig.Registry
+	cache    map[string]cue.Value
+	failed   map[string]error
+}
+
+func newSchemaResolver(ctx *cue.Context, versionsDir string, useRegistry bool) *schemaResolver {
+	return &schemaResolver{
+		ctx:         ctx,
+		versionsDir: versionsDir,
+		useRegistry: useRegistry,
+		cache:       make(map[string]cue.Value),
+		failed:      make(map[string]error),
+	}
+}
+
+// canonicalVersion normalizes a gemara-version value such as "1.1.0" to the
+// module version form "v1.1.0".
+func canonicalVersion(v string) string {
+	v = strings.TrimSpace(v)
+	if v != "" && !strings.HasPrefix(v, "v") {
+		v = "v" + v
+	}
+	return v
+}
+
+// declaredVersion returns the gemara-version an artifact claims to conform to.
+func declaredVersion(data cue.Value) (string, error) {
+	v, err := data.LookupPath(cue.ParsePath(`metadata."gemara-version"`)).String()
+	if err != nil {
+		return "", fmt.Errorf("metadata.gemara-version is not set")
+	}
+	return canonicalVersion(v), nil
+}
+
+// resolve returns the schema for version, loading it at most once.
+func (r *schemaResolver) resolve(version string) (cue.Value, error) {
+	version = canonicalVersion(version)
+	if v, ok := r.cache[version]; ok {
+		return v, nil
+	}
+	if err, ok := r.failed[version]; ok {
+		return cue.Value{}, err
+	}
+
+	var (
+		schema cue.Value
+		err    error
+	)
+	switch {
+	case r.versionsDir != "":
+		schema, err = r.loadVendored(version)
+		if err != nil && r.useRegistry {
+			// Keep both reasons: the user needs to learn why --versions-dir
+			// did not match as much as why the registry failed.
+			var regErr error
+			if schema, regErr = r.loadFromRegistry(version); regErr != nil {
+				err = errors.Join(err, fmt.Errorf("registry: %w", regErr))
+			} else {
+				err = nil
+			}
+		}
+	case r.useRegistry:
+		schema, err = r.loadFromRegistry(version)
+	default:
+		err = fmt.Errorf("no schema source configured (use --versions-dir or --registry)")
+	}
+	if err != nil {
+		r.failed[version] = fmt.Errorf("resolve schema %s: %w", version, err)
+		return cue.Value{}, r.failed[version]
+	}
+	r.cache[version] = schema
+	return schema, nil
+}
+
+// loadVendored looks for the version under versionsDir using any of the
+// layouts produced by copying a checkout or the CUE module cache:
+// v1.1.0/, 1.1.0/, gemara@v1.1.0/, or github.com/gemaraproj/gemara@v1.1.0/.
+func (r *schemaResolver) loadVendored(version string) (cue.Value, error) {
+	candidates := []string{
+		version,
+		strings.TrimPrefix(version, "v"),
+		"gemara@" + version,
+		filepath.FromSlash(gemaraModulePath + "@" + version),
+	}
+	for _, c := range candidates {
+		dir := filepath.Join(r.versionsDir, c)
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return loadSchema(r.ctx, dir)
+		}
+	}
+	return cue.Value{}, fmt.Errorf("version not found in %s (looked for %s/)", r.versionsDir, strings.Join(candidates, "/, "))
+}
+
+func (r *schemaResolver) loadFromRegistry(version string) (cue.Value, error) {
+	ver, err := module.NewVersion(gemaraModulePath, version)
+	if err != nil {
+		return cue.Value{}, err
+	}
+	if r.registry == nil {
+		r.registry, err = modconfig.NewRegistry(&modconfig.Config{CUERegistry: modconfig.DefaultRegistry})
+		if err != nil {
+			return cue.Value{}, fmt.Errorf("create registry: %w", err)
+		}
+	}
+
+	insts := load.Instances([]string{ver.String()}, &load.Config{Registry: r.registry})
+	if len(insts) == 0 {
+		return cue.Value{}, fmt.Errorf("no CUE instances returned for %v", ver)
+	}
+	if err := insts[0].Err; err != nil {
+		return cue.Value{}, fmt.Errorf("loading module %v: %w", ver, err)
+	}
+	schema := r.ctx.BuildInstance(insts[0])
+	if err := schema.Err(); err != nil {
+		return cue.Value{}, fmt.Errorf("building schema for %v: %w", ver, err)
+	}
+	return schema, nil
+}
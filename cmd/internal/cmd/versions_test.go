@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+)
+
+func TestCanonicalVersion(t *testing.T) {
+	for in, want := range map[string]string{"1.1.0": "v1.1.0", "v1.1.0": "v1.1.0", " 1.0.0 ": "v1.0.0", "": ""} {
+		if got := canonicalVersion(in); got != want {
+			t.Errorf("canonicalVersion(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSchemaResolverVendored(t *testing.T) {
+	r := newSchemaResolver(cuecontext.New(), "testdata/versions", false)
+	schema, err := r.resolve("1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !schema.LookupPath(cue.ParsePath("#Family")).Exists() {
+		t.Error("vendored v1.0.0 schema has no #Family")
+	}
+	if again, err := r.resolve("v1.0.0"); err != nil || again != schema {
+		t.Errorf("second resolve was not served from the cache: %v", err)
+	}
+
+	_, err = r.resolve("9.9.9")
+	if err == nil || !strings.Contains(err.Error(), "version not found in testdata/versions") {
+		t.Errorf("missing version: err = %v", err)
+	}
+	if _, again := r.resolve("9.9.9"); again != err {
+		t.Errorf("failure was not cached: %v", again)
+	}
+}
+
+func TestSchemaResolverKeepsBothErrors(t *testing.T) {
+	// The version is not vendored, and the registry rejects it before any
+	// network access, so both lookups fail.
+	r := newSchemaResolver(cuecontext.New(), "testdata/versions", true)
+	_, err := r.resolve("not-a-version")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"version not found in testdata/versions", "registry: "} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q lacks %q", err, want)
+		}
+	}
+}
+
+func TestValidateDeclared(t *testing.T) {
+	ctx := cuecontext.New()
+	schema, err := loadSchema(ctx, "../../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := newSchemaResolver(ctx, "testdata/versions", false)
+
+	// legacy-control-catalog.yaml declares 1.0.0: families and family are
+	// gone from the current schema but valid in the version it declares.
+	file := "testdata/legacy-control-catalog.yaml"
+	current := validateArtifact(ctx, schema, file, "")
+	declared := validateDeclared(ctx, resolver, file, "")
+	if current.Valid {
+		t.Error("legacy catalog validates against the current schema")
+	}
+	paths := make(map[string]bool)
+	for _, d := range current.Diagnostics {
+		paths[d.Path] = true
+	}
+	if !paths["families"] || !paths["controls[0].family"] {
+		t.Errorf("current diagnostics = %+v", current.Diagnostics)
+	}
+	if !declared.Valid || declared.Against != againstDeclared || declared.SchemaVersion != "v1.0.0" || declared.Definition != "#ControlCatalog" {
+		t.Errorf("declared result = %+v", declared)
+	}
+
+	// A version that is not vendored is reported against the artifact.
+	missing := validateDeclared(ctx, resolver, "testdata/refs-control-catalog.yaml", "")
+	if missing.Valid || len(missing.Diagnostics) != 1 || missing.Diagnostics[0].Rule != ruleVersion || missing.SchemaVersion != "v1.1.0" {
+		t.Errorf("undeclared version result = %+v", missing)
+	}
+}
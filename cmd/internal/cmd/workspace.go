@@ -0,0 +1,232 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/goccy/go-yaml"
+)
+
+// workspaceFile is the manifest name looked up when --workspace names a
+// directory.
+const workspaceFile = "gemara.work.yaml"
+
+// workspace is a gemara.work.yaml manifest: the artifacts that make up a
+// corpus and where the mapping references between them live locally.
+//
+//	artifacts:
+//	  - catalogs/          # every .yaml, .yml, and .json file below
+//	  - policy.yaml
+//	  - logs/*.yaml        # glob, relative to the manifest
+//	references:
+//	  FINOS-AIR: vendor/aigf.yaml
+//	mirror: .gemara/mirror
+//	cache: .gemara/cache
+//
+// Artifacts in the workspace are also registered under their metadata.id,
+// so references to each other resolve without listing them in references.
+type workspace struct {
+	Artifacts  []string          `yaml:"artifacts"`
+	References map[string]string `yaml:"references"`
+	Mirror     string            `yaml:"mirror"`
+	Cache      string            `yaml:"cache"`
+
+	path string
+	dir  string
+	// src positions diagnostics about the manifest; nil when it could not
+	// be parsed.
+	src *artifactSource
+}
+
+// loadWorkspace reads the manifest at path, or gemara.work.yaml inside path
+// when it is a directory.
+func loadWorkspace(path string) (*workspace, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, workspaceFile)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read workspace: %w", err)
+	}
+	ws := &workspace{}
+	if err := yaml.UnmarshalWithOptions(data, ws, yaml.Strict()); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if len(ws.Artifacts) == 0 {
+		return nil, fmt.Errorf("%s: artifacts is empty", path)
+	}
+	ws.path = path
+	ws.dir = filepath.Dir(path)
+	if src, err := parseArtifactSource(cuecontext.New(), path, data); err == nil {
+		ws.src = src
+	}
+	return ws, nil
+}
+
+// openWorkspace loads the manifest at path and returns the files to check
+// (the workspace artifacts followed by extra), a reference resolver that
+// knows the workspace, and a result holding manifest problems, if any.
+// Non-empty mirror and cache override the manifest's directories.
+func openWorkspace(path, mirror, cache string, fetch bool, extra []string) ([]string, *artifactResolver, *ValidationResult, error) {
+	ws, err := loadWorkspace(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if mirror == "" {
+		mirror = ws.local(ws.Mirror)
+	}
+	if cache == "" {
+		cache = ws.local(ws.Cache)
+	}
+	resolver := newArtifactResolver(mirror, cache, fetch)
+
+	files, diags := ws.files()
+	seen := make(map[string]bool)
+	for _, f := range files {
+		seen[fileKey(f)] = true
+	}
+	for _, f := range extra {
+		if k := fileKey(f); !seen[k] {
+			seen[k] = true
+			files = append(files, f)
+		}
+	}
+	diags = append(diags, ws.register(resolver, files)...)
+	if len(diags) == 0 {
+		return files, resolver, nil, nil
+	}
+	return files, resolver, &ValidationResult{File: ws.path, Diagnostics: diags}, nil
+}
+
+// local resolves a manifest path relative to the manifest directory.
+func (ws *workspace) local(p string) string {
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(ws.dir, filepath.FromSlash(p))
+}
+
+// files expands the artifacts patterns in manifest order, without
+// duplicates. Patterns that match nothing are reported as diagnostics.
+func (ws *workspace) files() ([]string, []Diagnostic) {
+	var (
+		files []string
+		diags []Diagnostic
+		seen  = make(map[string]bool)
+	)
+	add := func(p string) {
+		if k := fileKey(p); !seen[k] {
+			seen[k] = true
+			files = append(files, p)
+		}
+	}
+
+	for i, pattern := range ws.Artifacts {
+		matches, err := filepath.Glob(ws.local(pattern))
+		if err != nil {
+			diags = append(diags, ws.diagnostic([]string{"artifacts", fmt.Sprint(i)}, pattern, fmt.Sprintf("invalid pattern: %v", err)))
+			continue
+		}
+		found := 0
+		for _, m := range matches {
+			info, err := os.Stat(m)
+			if err != nil {
+				continue
+			}
+			if !info.IsDir() {
+				add(m)
+				found++
+				continue
+			}
+			var below []string
+			_ = filepath.WalkDir(m, func(p string, d fs.DirEntry, err error) error {
+				if err == nil && !d.IsDir() && isArtifactFile(p) && p != ws.path {
+					below = append(below, p)
+				}
+				return nil
+			})
+			sort.Strings(below)
+			for _, p := range below {
+				add(p)
+				found++
+			}
+		}
+		if found == 0 {
+			diags = append(diags, ws.diagnostic([]string{"artifacts", fmt.Sprint(i)}, pattern, "pattern matches no artifacts"))
+		}
+	}
+	return files, diags
+}
+
+// fileKey identifies a file however its path is spelled: the cleaned
+// absolute path, or p itself when that cannot be determined.
+func fileKey(p string) string {
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+	return filepath.Clean(p)
+}
+
+func isArtifactFile(p string) bool {
+	switch strings.ToLower(filepath.Ext(p)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// register adds the manifest's reference paths and the ids of the
+// workspace artifacts to resolver. Explicit references win over ids;
+// two artifacts claiming the same id are reported.
+func (ws *workspace) register(resolver *artifactResolver, files []string) []Diagnostic {
+	var diags []Diagnostic
+
+	ids := make([]string, 0, len(ws.References))
+	for id := range ws.References {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		p := ws.local(ws.References[id])
+		if _, err := os.Stat(p); err != nil {
+			diags = append(diags, ws.diagnostic([]string{"references", id}, ws.References[id], fmt.Sprintf("reference %q: %v", id, err)))
+			continue
+		}
+		resolver.local[id] = p
+	}
+
+	owner := make(map[string]string)
+	for _, file := range files {
+		doc, err := readDocument(file)
+		if err != nil {
+			// Reported as a syntax problem when the file is validated.
+			continue
+		}
+		id := mapString(mapMap(doc, "metadata"), "id")
+		if id == "" {
+			continue
+		}
+		if first, ok := owner[id]; ok {
+			src, _ := loadArtifactSource(cuecontext.New(), file)
+			diags = append(diags, diagnosticAt(file, src, ruleWorkspace, severityError, []string{"metadata", "id"}, id,
+				fmt.Sprintf("metadata.id %q is also used by %s", id, first)))
+			continue
+		}
+		owner[id] = file
+		if _, ok := resolver.local[id]; !ok {
+			resolver.local[id] = file
+		}
+	}
+	return diags
+}
+
+func (ws *workspace) diagnostic(path []string, value, msg string) Diagnostic {
+	return diagnosticAt(ws.path, ws.src, ruleWorkspace, severityError, path, value, msg)
+}
@@ -0,0 +1,70 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestWorkspace(t *testing.T) {
+	ws, err := loadWorkspace("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, diags := ws.files()
+	want := []string{
+		filepath.Join("testdata", "refs-control-catalog.yaml"),
+		filepath.Join("testdata", "refs-threat-catalog.yaml"),
+	}
+	if len(files) != len(want) || files[0] != want[0] || files[1] != want[1] {
+		t.Errorf("files = %v, want %v", files, want)
+	}
+	if len(diags) != 1 || diags[0].Path != "artifacts[1]" || diags[0].Line != 3 {
+		t.Errorf("expected one diagnostic for the unmatched pattern on line 3, got %+v", diags)
+	}
+
+	resolver := newArtifactResolver("", "", false)
+	if diags := ws.register(resolver, files); len(diags) != 0 {
+		t.Errorf("unexpected register diagnostics: %+v", diags)
+	}
+	for id, path := range map[string]string{
+		"REFS-CONTROLS":     want[0],
+		"REFS-THREATS":      want[1],
+		"REFS-CAPABILITIES": want[1],
+	} {
+		if resolver.local[id] != path {
+			t.Errorf("local[%s] = %q, want %q", id, resolver.local[id], path)
+		}
+	}
+
+	if diags := ws.register(resolver, append(files, files[0])); len(diags) != 1 || diags[0].Path != "metadata.id" || diags[0].Line == 0 {
+		t.Errorf("expected a positioned duplicate id diagnostic, got %+v", diags)
+	}
+}
+
+func TestOpenWorkspaceExtraFiles(t *testing.T) {
+	extra := []string{
+		"testdata/refs-threat-catalog.yaml",
+		"./testdata/../testdata/refs-control-catalog.yaml",
+		"testdata/levels-control-catalog.yaml",
+	}
+	files, _, result, err := openWorkspace("testdata", "", "", false, extra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join("testdata", "refs-control-catalog.yaml"),
+		filepath.Join("testdata", "refs-threat-catalog.yaml"),
+		"testdata/levels-control-catalog.yaml",
+	}
+	if len(files) != len(want) || files[0] != want[0] || files[1] != want[1] || files[2] != want[2] {
+		t.Errorf("files = %v, want %v", files, want)
+	}
+	// Only the unmatched pattern of the manifest is a problem; workspace
+	// files named again are not flagged against themselves.
+	if result == nil || len(result.Diagnostics) != 1 || result.Diagnostics[0].Path != "artifacts[1]" {
+		t.Errorf("unexpected manifest result: %+v", result)
+	}
+}